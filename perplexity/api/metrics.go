@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// Metrics receives measurements for every service call. Implementations must
+// be safe for concurrent use and should return quickly, since they are called
+// on the request path.
+type Metrics interface {
+	// RecordRequest is called once per service call, after the last attempt.
+	// For streams it is called when the stream body is closed.
+	RecordRequest(ctx context.Context, m RequestMetrics)
+
+	// RecordUsage is called when a response reports token usage. For streams
+	// it is called once with the last usage reported by the stream.
+	RecordUsage(ctx context.Context, u UsageMetrics)
+}
+
+// RequestMetrics describes a completed service call.
+type RequestMetrics struct {
+	// Operation is the logical operation, for example "chat.create".
+	Operation string
+
+	// Method is the HTTP method of the request.
+	Method string
+
+	// Path is the API path of the request, without the base URL or query.
+	Path string
+
+	// Model is the model named in the request body, if any.
+	Model string
+
+	// Stream reports whether the call returned a Server-Sent Events stream.
+	Stream bool
+
+	// Attempts is the number of HTTP attempts made, including retries.
+	Attempts int
+
+	// StatusCode is the status code of the last response, or 0 if no response
+	// was received.
+	StatusCode int
+
+	// StatusClass is the status class of the last response, such as "2xx" or
+	// "5xx", or "error" if no response was received.
+	StatusClass string
+
+	// Duration is the time from the start of the call until the last response
+	// was read. For streams it runs until the stream body is closed.
+	Duration time.Duration
+
+	// TimeToFirstByte is the time from the start of the call until the first
+	// byte of the stream body was read. It is zero for non-streaming calls and
+	// for streams that never produced data.
+	TimeToFirstByte time.Duration
+
+	// Err is the error returned to the caller, if any.
+	Err error
+}
+
+// UsageMetrics is the token usage and cost reported by a response, normalized
+// across response types. Fields the response does not report are zero.
+type UsageMetrics struct {
+	// Operation is the logical operation that produced the usage.
+	Operation string
+
+	// Model is the model that produced the usage.
+	Model string
+
+	// InputTokens is the number of prompt or input tokens.
+	InputTokens int
+
+	// OutputTokens is the number of completion or output tokens.
+	OutputTokens int
+
+	// TotalTokens is the total number of tokens.
+	TotalTokens int
+
+	// ReasoningTokens is the number of reasoning tokens.
+	ReasoningTokens int
+
+	// CitationTokens is the number of citation tokens.
+	CitationTokens int
+
+	// SearchQueries is the number of search queries performed.
+	SearchQueries int
+
+	// InputCost is the cost of input tokens.
+	InputCost float64
+
+	// OutputCost is the cost of output tokens.
+	OutputCost float64
+
+	// TotalCost is the total cost of the call.
+	TotalCost float64
+
+	// Currency is the currency of the cost fields, if reported.
+	Currency string
+
+	// Raw is the usage value from the response: a *types.UsageInfo,
+	// *responses.Usage or *embeddings.Usage.
+	Raw any
+}
+
+// StatusClass returns the class of an HTTP status code, such as "2xx", or
+// "error" for a status code of 0.
+func StatusClass(statusCode int) string {
+	if statusCode <= 0 {
+		return "error"
+	}
+	return strconv.Itoa(statusCode/100) + "xx"
+}
@@ -0,0 +1,36 @@
+package api
+
+import "net/http"
+
+// RequestInfo describes a single HTTP attempt made by the client.
+type RequestInfo struct {
+	// Operation is the logical operation that issued the request, for example
+	// "chat.create" or "responses.create_stream".
+	Operation string
+
+	// Method is the HTTP method of the request.
+	Method string
+
+	// Path is the API path of the request, without the base URL.
+	Path string
+
+	// Attempt is the attempt number, starting at 1 for the first attempt.
+	Attempt int
+
+	// Stream reports whether the request expects a Server-Sent Events response.
+	Stream bool
+
+	// Body is the request body after extra body fields have been merged, or nil
+	// for requests without a body.
+	Body any
+}
+
+// MiddlewareNext sends the request to the next middleware in the chain, or to
+// the underlying HTTP client when called by the innermost middleware.
+type MiddlewareNext func(req *http.Request) (*http.Response, error)
+
+// Middleware wraps every HTTP attempt made by the client. It may inspect or
+// modify the outgoing request before calling next, and inspect or replace the
+// response returned by next. Middleware runs once per attempt, so retried
+// requests pass through the chain again with an incremented Attempt.
+type Middleware func(req *http.Request, info RequestInfo, next MiddlewareNext) (*http.Response, error)
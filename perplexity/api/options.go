@@ -6,10 +6,27 @@ import (
 )
 
 type RequestOptions struct {
-	Headers   map[string]string
-	Query     map[string]any
-	ExtraBody map[string]any
-	Timeout   time.Duration
+	Headers     map[string]string
+	Query       map[string]any
+	ExtraBody   map[string]any
+	Timeout     time.Duration
+	RetryPolicy RetryPolicy
+	MaxRetries  *int
+
+	// ConnectTimeout limits the time until the response headers of each
+	// attempt arrive.
+	ConnectTimeout time.Duration
+
+	// StreamTimeout limits the total duration of a stream. When zero, Timeout
+	// applies to streams as well.
+	StreamTimeout time.Duration
+
+	// StreamIdleTimeout aborts a stream that receives no data for this long.
+	StreamIdleTimeout time.Duration
+
+	// StreamReconnects is how many times a stream is reopened after a
+	// dropped connection. Nil uses the client's setting.
+	StreamReconnects *int
 }
 
 type RequestOption func(*RequestOptions)
@@ -88,6 +105,54 @@ func WithTimeout(timeout time.Duration) RequestOption {
 	}
 }
 
+// WithConnectTimeout limits the time until the response headers of each
+// attempt arrive. Attempts that time out are retried.
+func WithConnectTimeout(timeout time.Duration) RequestOption {
+	return func(o *RequestOptions) {
+		o.ConnectTimeout = timeout
+	}
+}
+
+// WithStreamTimeout limits the total duration of a stream, including
+// reading all of its events.
+func WithStreamTimeout(timeout time.Duration) RequestOption {
+	return func(o *RequestOptions) {
+		o.StreamTimeout = timeout
+	}
+}
+
+// WithStreamIdleTimeout aborts a stream with a stream stall error when no
+// data arrives for the given duration.
+func WithStreamIdleTimeout(timeout time.Duration) RequestOption {
+	return func(o *RequestOptions) {
+		o.StreamIdleTimeout = timeout
+	}
+}
+
+// WithStreamResume makes a stream reconnect up to maxReconnects times after
+// a dropped connection, resuming after the last event received. Zero
+// disables resumption for the request.
+func WithStreamResume(maxReconnects int) RequestOption {
+	return func(o *RequestOptions) {
+		o.StreamReconnects = &maxReconnects
+	}
+}
+
+// WithRetryPolicy overrides the client's retry policy for a single request.
+func WithRetryPolicy(policy RetryPolicy) RequestOption {
+	return func(o *RequestOptions) {
+		o.RetryPolicy = policy
+	}
+}
+
+// WithMaxRetries overrides the client's maximum number of retries for a
+// single request.
+func WithMaxRetries(retries int) RequestOption {
+	return func(o *RequestOptions) {
+		o.MaxRetries = &retries
+	}
+}
+
 func ApplyRequestOptions(opts []RequestOption) RequestOptions {
 	var options RequestOptions
 	for _, opt := range opts {
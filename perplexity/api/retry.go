@@ -0,0 +1,262 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultRetryInitialDelay is the initial delay for exponential backoff.
+	DefaultRetryInitialDelay = 500 * time.Millisecond
+
+	// DefaultRetryMaxDelay is the maximum delay between retries.
+	DefaultRetryMaxDelay = 8 * time.Second
+
+	// DefaultRetryJitter is the fraction of the delay added or removed at random.
+	DefaultRetryJitter = 0.25
+
+	// DefaultRetryMaxRetryAfter is the longest Retry-After delay that is honored.
+	DefaultRetryMaxRetryAfter = 60 * time.Second
+)
+
+// RetryInfo describes a failed attempt that may be retried.
+type RetryInfo struct {
+	// Operation is the logical operation that issued the request.
+	Operation string
+
+	// Method is the HTTP method of the request.
+	Method string
+
+	// Path is the API path of the request, without the base URL.
+	Path string
+
+	// Attempt is the number of the attempt that failed, starting at 1.
+	Attempt int
+
+	// MaxRetries is the maximum number of retries configured for the request.
+	MaxRetries int
+
+	// Elapsed is the time spent since the first attempt started.
+	Elapsed time.Duration
+
+	// StatusCode is the HTTP status code of the response, or 0 if the attempt
+	// failed before a response was received.
+	StatusCode int
+
+	// Headers contains the response headers, if a response was received.
+	Headers http.Header
+
+	// Body contains the response body, if a response was received and read.
+	Body []byte
+
+	// Err is the transport error, if the attempt failed before a response was
+	// received.
+	Err error
+}
+
+// RetryPolicy decides whether a failed attempt is retried and how long the
+// client waits before the next attempt. The client never makes more than
+// MaxRetries retries, regardless of the policy.
+type RetryPolicy interface {
+	// ShouldRetry reports whether the failed attempt should be retried.
+	ShouldRetry(info RetryInfo) bool
+
+	// RetryDelay returns how long to wait before retrying the failed attempt.
+	RetryDelay(info RetryInfo) time.Duration
+}
+
+// RetryDecider is implemented by retry policies that decide whether to retry
+// and how long to wait in a single step. The client prefers RetryDecision
+// over ShouldRetry and RetryDelay, so that a jittered delay is computed once
+// and the decision is based on the delay that is actually waited.
+type RetryDecider interface {
+	// RetryDecision reports whether the failed attempt should be retried and
+	// the delay before the next attempt.
+	RetryDecision(info RetryInfo) (bool, time.Duration)
+}
+
+// ExponentialBackoff is a RetryPolicy that retries connection failures and
+// retryable status codes with exponentially increasing, jittered delays.
+// Use DefaultRetryPolicy to obtain an instance with the SDK defaults.
+type ExponentialBackoff struct {
+	// InitialDelay is the delay before the first retry.
+	InitialDelay time.Duration
+
+	// MaxDelay caps the computed backoff delay. Zero means no cap.
+	MaxDelay time.Duration
+
+	// Jitter is the fraction of the delay added or removed at random (0 to 1).
+	Jitter float64
+
+	// MaxRetryAfter is the longest Retry-After delay that is honored. Longer
+	// server-provided delays fall back to exponential backoff. Zero disables
+	// Retry-After handling.
+	MaxRetryAfter time.Duration
+
+	// MaxElapsed stops retrying once the total time spent, including the next
+	// delay, would exceed it. Zero means no limit.
+	MaxElapsed time.Duration
+
+	// RetryStatus reports whether a status code is retryable. When nil,
+	// 408, 409, 429 and 5xx responses are retried.
+	RetryStatus func(statusCode int) bool
+}
+
+// DefaultRetryPolicy returns the retry policy used when none is configured.
+func DefaultRetryPolicy() *ExponentialBackoff {
+	return &ExponentialBackoff{
+		InitialDelay:  DefaultRetryInitialDelay,
+		MaxDelay:      DefaultRetryMaxDelay,
+		Jitter:        DefaultRetryJitter,
+		MaxRetryAfter: DefaultRetryMaxRetryAfter,
+	}
+}
+
+// ShouldRetry implements RetryPolicy.
+func (p *ExponentialBackoff) ShouldRetry(info RetryInfo) bool {
+	retry, _ := p.RetryDecision(info)
+	return retry
+}
+
+// RetryDecision implements RetryDecider. With MaxElapsed set, the delay that
+// is returned is the one checked against the limit.
+func (p *ExponentialBackoff) RetryDecision(info RetryInfo) (bool, time.Duration) {
+	if !p.retryable(info) {
+		return false, 0
+	}
+	delay := p.RetryDelay(info)
+	if p.MaxElapsed > 0 && info.Elapsed+delay > p.MaxElapsed {
+		return false, 0
+	}
+	return true, delay
+}
+
+// retryable reports whether the failure itself is retryable, regardless of
+// the time spent.
+func (p *ExponentialBackoff) retryable(info RetryInfo) bool {
+	if info.Err != nil {
+		return IsRetryableTransportError(info.Err)
+	}
+	switch info.Headers.Get("x-should-retry") {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if p.RetryStatus != nil {
+		return p.RetryStatus(info.StatusCode)
+	}
+	return IsRetryableStatus(info.StatusCode)
+}
+
+// RetryDelay implements RetryPolicy.
+func (p *ExponentialBackoff) RetryDelay(info RetryInfo) time.Duration {
+	if retryAfter, ok := ParseRetryAfter(info.Headers); ok && retryAfter > 0 && retryAfter <= p.MaxRetryAfter {
+		return retryAfter
+	}
+
+	attempt := info.Attempt
+	if attempt < 1 {
+		attempt = 1
+	}
+	backoff := float64(p.InitialDelay) * math.Pow(2, float64(attempt-1))
+	delay := time.Duration(math.MaxInt64)
+	if backoff < float64(math.MaxInt64) {
+		delay = time.Duration(backoff)
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.Jitter <= 0 {
+		return delay
+	}
+	var randomBytes [8]byte
+	if _, err := rand.Read(randomBytes[:]); err == nil {
+		randomValue := binary.BigEndian.Uint64(randomBytes[:])
+		randomFloat := float64(randomValue) / float64(^uint64(0))
+		jitter := time.Duration(randomFloat * p.Jitter * float64(delay))
+		if randomBytes[0]&1 == 0 {
+			delay += jitter
+		} else {
+			delay -= jitter
+		}
+	}
+
+	return delay
+}
+
+// RetryPolicyFunc adapts a function to a RetryPolicy. The function returns
+// whether to retry and the delay before the next attempt. The client calls
+// it once per failed attempt.
+type RetryPolicyFunc func(info RetryInfo) (bool, time.Duration)
+
+// RetryDecision implements RetryDecider.
+func (f RetryPolicyFunc) RetryDecision(info RetryInfo) (bool, time.Duration) {
+	return f(info)
+}
+
+// ShouldRetry implements RetryPolicy.
+func (f RetryPolicyFunc) ShouldRetry(info RetryInfo) bool {
+	retry, _ := f(info)
+	return retry
+}
+
+// RetryDelay implements RetryPolicy.
+func (f RetryPolicyFunc) RetryDelay(info RetryInfo) time.Duration {
+	_, delay := f(info)
+	return delay
+}
+
+// IsRetryableStatus reports whether the SDK retries a status code by default.
+func IsRetryableStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusRequestTimeout, // 408
+		http.StatusConflict,        // 409
+		http.StatusTooManyRequests: // 429
+		return true
+	default:
+		// Retry on 5xx errors
+		return statusCode >= 500
+	}
+}
+
+// IsRetryableTransportError reports whether the SDK retries a transport error
+// by default. Network errors are retried; context cancellation is not.
+func IsRetryableTransportError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// ParseRetryAfter reads the retry-after-ms and retry-after response headers.
+func ParseRetryAfter(headers http.Header) (time.Duration, bool) {
+	if headers == nil {
+		return 0, false
+	}
+	if retryAfterMS := headers.Get("retry-after-ms"); retryAfterMS != "" {
+		if value, err := strconv.ParseFloat(retryAfterMS, 64); err == nil {
+			return time.Duration(value * float64(time.Millisecond)), true
+		}
+	}
+	if retryAfter := headers.Get("retry-after"); retryAfter != "" {
+		if value, err := strconv.ParseFloat(retryAfter, 64); err == nil {
+			return time.Duration(value * float64(time.Second)), true
+		}
+		if when, err := http.ParseTime(retryAfter); err == nil {
+			return time.Until(when), true
+		}
+	}
+	return 0, false
+}
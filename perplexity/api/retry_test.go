@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestExponentialBackoff_ShouldRetry(t *testing.T) {
+	policy := DefaultRetryPolicy()
+
+	tests := []struct {
+		name string
+		info RetryInfo
+		want bool
+	}{
+		{"rate limited", RetryInfo{StatusCode: http.StatusTooManyRequests}, true},
+		{"server error", RetryInfo{StatusCode: http.StatusBadGateway}, true},
+		{"bad request", RetryInfo{StatusCode: http.StatusBadRequest}, false},
+		{"header forces retry", RetryInfo{StatusCode: http.StatusBadRequest, Headers: http.Header{"X-Should-Retry": []string{"true"}}}, true},
+		{"header suppresses retry", RetryInfo{StatusCode: http.StatusServiceUnavailable, Headers: http.Header{"X-Should-Retry": []string{"false"}}}, false},
+		{"network error", RetryInfo{Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}, true},
+		{"context canceled", RetryInfo{Err: fmt.Errorf("request failed: %w", context.Canceled)}, false},
+		{"other error", RetryInfo{Err: errors.New("boom")}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.ShouldRetry(tt.info); got != tt.want {
+				t.Errorf("ShouldRetry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExponentialBackoff_RetryStatus(t *testing.T) {
+	policy := DefaultRetryPolicy()
+	policy.RetryStatus = func(statusCode int) bool {
+		return statusCode == http.StatusTooManyRequests
+	}
+
+	if !policy.ShouldRetry(RetryInfo{StatusCode: http.StatusTooManyRequests}) {
+		t.Error("Expected 429 to be retried")
+	}
+	if policy.ShouldRetry(RetryInfo{StatusCode: http.StatusInternalServerError}) {
+		t.Error("Expected 500 not to be retried")
+	}
+}
+
+func TestExponentialBackoff_MaxElapsed(t *testing.T) {
+	policy := &ExponentialBackoff{InitialDelay: time.Second, MaxDelay: time.Second, MaxElapsed: 2 * time.Second}
+
+	if !policy.ShouldRetry(RetryInfo{StatusCode: http.StatusServiceUnavailable, Attempt: 1, Elapsed: 500 * time.Millisecond}) {
+		t.Error("Expected retry within the elapsed budget")
+	}
+	if policy.ShouldRetry(RetryInfo{StatusCode: http.StatusServiceUnavailable, Attempt: 1, Elapsed: 1500 * time.Millisecond}) {
+		t.Error("Expected no retry past the elapsed budget")
+	}
+}
+
+func TestExponentialBackoff_RetryDecision(t *testing.T) {
+	policy := &ExponentialBackoff{InitialDelay: time.Second, MaxDelay: 4 * time.Second, Jitter: 1, MaxElapsed: 3 * time.Second}
+
+	for i := 0; i < 100; i++ {
+		info := RetryInfo{StatusCode: http.StatusServiceUnavailable, Attempt: 2, Elapsed: time.Second}
+		retry, delay := policy.RetryDecision(info)
+		if retry && info.Elapsed+delay > policy.MaxElapsed {
+			t.Fatalf("RetryDecision() = true with delay %v past the elapsed budget", delay)
+		}
+		if !retry && delay != 0 {
+			t.Fatalf("RetryDecision() = false with delay %v", delay)
+		}
+	}
+}
+
+func TestExponentialBackoff_RetryDelay(t *testing.T) {
+	policy := &ExponentialBackoff{InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second, MaxRetryAfter: 5 * time.Minute}
+
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second} {
+		if got := policy.RetryDelay(RetryInfo{Attempt: attempt}); got != want {
+			t.Errorf("RetryDelay(attempt %d) = %v, want %v", attempt, got, want)
+		}
+	}
+
+	headers := http.Header{}
+	headers.Set("retry-after", "120")
+	if got := policy.RetryDelay(RetryInfo{Attempt: 1, Headers: headers}); got != 2*time.Minute {
+		t.Errorf("RetryDelay() = %v, want %v", got, 2*time.Minute)
+	}
+
+	policy.MaxRetryAfter = time.Minute
+	if got := policy.RetryDelay(RetryInfo{Attempt: 1, Headers: headers}); got != 100*time.Millisecond {
+		t.Errorf("RetryDelay() = %v, want capped Retry-After to fall back to backoff", got)
+	}
+}
+
+func TestExponentialBackoff_RetryDelayNoMax(t *testing.T) {
+	policy := &ExponentialBackoff{InitialDelay: 100 * time.Millisecond}
+
+	if got := policy.RetryDelay(RetryInfo{Attempt: 10}); got != 51200*time.Millisecond {
+		t.Errorf("RetryDelay() = %v, want uncapped backoff", got)
+	}
+	if got := policy.RetryDelay(RetryInfo{Attempt: 1000}); got != time.Duration(math.MaxInt64) {
+		t.Errorf("RetryDelay() = %v, want the largest duration on overflow", got)
+	}
+}
+
+func TestRetryPolicyFunc(t *testing.T) {
+	policy := RetryPolicyFunc(func(info RetryInfo) (bool, time.Duration) {
+		return info.Attempt < 2, time.Duration(info.Attempt) * time.Second
+	})
+
+	if !policy.ShouldRetry(RetryInfo{Attempt: 1}) || policy.ShouldRetry(RetryInfo{Attempt: 2}) {
+		t.Error("ShouldRetry did not use the function result")
+	}
+	if got := policy.RetryDelay(RetryInfo{Attempt: 3}); got != 3*time.Second {
+		t.Errorf("RetryDelay() = %v, want 3s", got)
+	}
+	if retry, delay := policy.RetryDecision(RetryInfo{Attempt: 1}); !retry || delay != time.Second {
+		t.Errorf("RetryDecision() = %v, %v, want true, 1s", retry, delay)
+	}
+}
@@ -0,0 +1,7 @@
+package api
+
+import "errors"
+
+// ErrStreamClosed is returned by a stream's Next once the stream has been
+// closed, including when Close interrupts a Next that is waiting for data.
+var ErrStreamClosed = errors.New("perplexity: stream closed")
@@ -0,0 +1,23 @@
+package api
+
+import "fmt"
+
+// StructuredOutputError is returned by the CreateStructured helpers when the
+// model's reply still cannot be parsed or does not match the schema after
+// every retry.
+type StructuredOutputError struct {
+	// Attempts is the number of replies requested.
+	Attempts int
+
+	// Content is the text of the last reply.
+	Content string
+
+	// Err is the parse or validation error of the last reply.
+	Err error
+}
+
+func (e *StructuredOutputError) Error() string {
+	return fmt.Sprintf("invalid structured output after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *StructuredOutputError) Unwrap() error { return e.Err }
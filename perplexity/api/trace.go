@@ -0,0 +1,57 @@
+package api
+
+import (
+	"context"
+	"net/http"
+)
+
+// Attribute keys set on spans by the client.
+const (
+	AttrOperation         = "perplexity.operation"
+	AttrMethod            = "http.request.method"
+	AttrPath              = "url.path"
+	AttrModel             = "gen_ai.request.model"
+	AttrStream            = "perplexity.stream"
+	AttrAttempt           = "perplexity.attempt"
+	AttrAttempts          = "perplexity.attempts"
+	AttrStatusCode        = "http.response.status_code"
+	AttrRequestID         = "perplexity.request_id"
+	AttrRetryReason       = "perplexity.retry.reason"
+	AttrInputTokens       = "gen_ai.usage.input_tokens"
+	AttrOutputTokens      = "gen_ai.usage.output_tokens"
+	AttrTotalTokens       = "perplexity.usage.total_tokens"
+	AttrReasoningTokens   = "perplexity.usage.reasoning_tokens"
+	AttrTotalCost         = "perplexity.usage.total_cost"
+	AttrCostCurrency      = "perplexity.usage.currency"
+	AttrTimeToFirstByteMS = "perplexity.time_to_first_byte_ms"
+)
+
+// Attribute is a key-value pair attached to a span. Values are strings, ints,
+// float64s or bools.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// Tracer starts spans for service calls and their HTTP attempts. The client
+// starts one span per service call, named after the operation, and a child
+// span per HTTP attempt. Implementations must be safe for concurrent use.
+type Tracer interface {
+	// StartSpan starts a span as a child of the span in ctx, if any, and
+	// returns a context carrying the new span.
+	StartSpan(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// SetAttributes adds attributes to the span.
+	SetAttributes(attrs ...Attribute)
+
+	// End ends the span, recording err if it is not nil.
+	End(err error)
+}
+
+// HeaderInjector writes the trace context carried by ctx into the headers of
+// an outgoing request, for example as a W3C traceparent header. It is called
+// once per HTTP attempt with the context of the attempt span.
+type HeaderInjector func(ctx context.Context, header http.Header)
@@ -52,10 +52,11 @@ func (s *Service) createWithResponse(ctx context.Context, params *CompletionCrea
 	}
 
 	req := &http.Request{
-		Method:  "POST",
-		Path:    "/async/chat/completions",
-		Body:    params,
-		Options: api.ApplyRequestOptions(opts),
+		Operation: "asyncchat.create",
+		Method:    "POST",
+		Path:      "/async/chat/completions",
+		Body:      params,
+		Options:   api.ApplyRequestOptions(opts),
 	}
 
 	resp, err := s.client.Do(ctx, req)
@@ -91,9 +92,10 @@ func (s *Service) ListRaw(ctx context.Context, opts ...api.RequestOption) (*api.
 
 func (s *Service) listWithResponse(ctx context.Context, opts ...api.RequestOption) (*CompletionListResponse, *http.Response, error) {
 	req := &http.Request{
-		Method:  "GET",
-		Path:    "/async/chat/completions",
-		Options: api.ApplyRequestOptions(opts),
+		Operation: "asyncchat.list",
+		Method:    "GET",
+		Path:      "/async/chat/completions",
+		Options:   api.ApplyRequestOptions(opts),
 	}
 
 	resp, err := s.client.Do(ctx, req)
@@ -162,10 +164,11 @@ func (s *Service) getWithResponse(ctx context.Context, requestID string, params
 	}
 
 	req := &http.Request{
-		Method:  "GET",
-		Path:    path,
-		Headers: headers,
-		Options: api.ApplyRequestOptions(opts),
+		Operation: "asyncchat.get",
+		Method:    "GET",
+		Path:      path,
+		Headers:   headers,
+		Options:   api.ApplyRequestOptions(opts),
 	}
 
 	resp, err := s.client.Do(ctx, req)
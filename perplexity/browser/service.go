@@ -46,10 +46,11 @@ func (s *SessionsService) CreateRaw(ctx context.Context, opts ...api.RequestOpti
 
 func (s *SessionsService) createWithResponse(ctx context.Context, opts ...api.RequestOption) (*SessionResponse, *internalhttp.Response, error) {
 	req := &internalhttp.Request{
-		Method:  http.MethodPost,
-		Path:    "/v1/browser/sessions",
-		Body:    map[string]any{},
-		Options: api.ApplyRequestOptions(opts),
+		Operation: "browser.sessions.create",
+		Method:    http.MethodPost,
+		Path:      "/v1/browser/sessions",
+		Body:      map[string]any{},
+		Options:   api.ApplyRequestOptions(opts),
 	}
 
 	resp, err := s.client.Do(ctx, req)
@@ -89,8 +90,9 @@ func (s *SessionsService) deleteWithResponse(ctx context.Context, sessionID stri
 	}
 
 	req := &internalhttp.Request{
-		Method: http.MethodDelete,
-		Path:   "/v1/browser/sessions/" + url.PathEscape(sessionID),
+		Operation: "browser.sessions.delete",
+		Method:    http.MethodDelete,
+		Path:      "/v1/browser/sessions/" + url.PathEscape(sessionID),
 		Headers: map[string]string{
 			"Accept": "*/*",
 		},
@@ -0,0 +1,240 @@
+package chat
+
+import (
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity/types"
+)
+
+const (
+	objectCompletion      = "chat.completion"
+	objectCompletionChunk = "chat.completion.chunk"
+)
+
+// Accumulator builds a complete chat completion from the chunks of a stream.
+//
+// Each chunk passed to Add is merged into the result: content deltas are
+// joined per choice, reasoning steps are appended, tool call fragments are
+// stitched together by index, and the latest citations, search results,
+// usage and finish reasons are kept. Chunk returns the completion built so
+// far in the shape of a non-streaming Create response.
+//
+// An Accumulator is not safe for concurrent use.
+type Accumulator struct {
+	chunk   types.StreamChunk
+	choices map[int]*choiceAccumulator
+}
+
+type choiceAccumulator struct {
+	role           types.Role
+	content        strings.Builder
+	reasoningSteps []types.ReasoningStep
+	toolCalls      []*toolCallAccumulator
+	finishReason   *types.FinishReason
+}
+
+type toolCallAccumulator struct {
+	index     int
+	id        *string
+	kind      *types.ToolCallType
+	name      strings.Builder
+	arguments strings.Builder
+	function  bool
+}
+
+// NewAccumulator returns an empty Accumulator.
+func NewAccumulator() *Accumulator {
+	return &Accumulator{choices: make(map[int]*choiceAccumulator)}
+}
+
+// Add merges a stream chunk into the accumulated completion.
+func (a *Accumulator) Add(chunk *types.StreamChunk) {
+	if chunk == nil {
+		return
+	}
+	if a.choices == nil {
+		a.choices = make(map[int]*choiceAccumulator)
+	}
+
+	if chunk.ID != "" {
+		a.chunk.ID = chunk.ID
+	}
+	if chunk.Model != "" {
+		a.chunk.Model = chunk.Model
+	}
+	if chunk.Created != 0 {
+		a.chunk.Created = chunk.Created
+	}
+	if chunk.Object != nil {
+		a.chunk.Object = chunk.Object
+	}
+	if chunk.Status != nil {
+		a.chunk.Status = chunk.Status
+	}
+	if chunk.Type != nil {
+		a.chunk.Type = chunk.Type
+	}
+	if chunk.Usage != nil {
+		a.chunk.Usage = chunk.Usage
+	}
+	// Citations and search results are sent in full, so the latest list
+	// replaces the previous one.
+	if len(chunk.Citations) > 0 {
+		a.chunk.Citations = chunk.Citations
+	}
+	if len(chunk.SearchResults) > 0 {
+		a.chunk.SearchResults = chunk.SearchResults
+	}
+
+	for _, choice := range chunk.Choices {
+		a.addChoice(choice)
+	}
+}
+
+func (a *Accumulator) addChoice(choice types.Choice) {
+	acc, ok := a.choices[choice.Index]
+	if !ok {
+		acc = &choiceAccumulator{}
+		a.choices[choice.Index] = acc
+	}
+
+	// A chunk carries either a delta or, for the final chunk of some models,
+	// the complete message.
+	delta := choice.Delta
+	if delta.Role == "" && delta.Content == nil && len(delta.ToolCalls) == 0 && choice.Message.Content != nil {
+		delta = choice.Message
+		acc.content.Reset()
+		acc.reasoningSteps = nil
+		acc.toolCalls = nil
+	}
+
+	if delta.Role != "" {
+		acc.role = delta.Role
+	}
+	acc.content.WriteString(types.ContentText(delta.Content))
+	acc.reasoningSteps = append(acc.reasoningSteps, delta.ReasoningSteps...)
+	for i, call := range delta.ToolCalls {
+		acc.addToolCall(i, call)
+	}
+	if choice.FinishReason != nil {
+		acc.finishReason = choice.FinishReason
+	}
+}
+
+func (c *choiceAccumulator) addToolCall(position int, delta types.ToolCall) {
+	index := position
+	if delta.Index != nil {
+		index = *delta.Index
+	}
+
+	var call *toolCallAccumulator
+	for _, existing := range c.toolCalls {
+		if existing.index == index {
+			call = existing
+			break
+		}
+	}
+	// Without an index, a fragment with a new ID starts another call.
+	if call != nil && delta.Index == nil && delta.ID != nil && call.id != nil && *delta.ID != *call.id {
+		call = nil
+		index = c.toolCalls[len(c.toolCalls)-1].index + 1
+	}
+	if call == nil {
+		call = &toolCallAccumulator{index: index}
+		c.toolCalls = append(c.toolCalls, call)
+	}
+
+	if delta.ID != nil && *delta.ID != "" {
+		call.id = delta.ID
+	}
+	if delta.Type != nil {
+		call.kind = delta.Type
+	}
+	if delta.Function != nil {
+		call.function = true
+		if delta.Function.Name != nil {
+			call.name.WriteString(*delta.Function.Name)
+		}
+		if delta.Function.Arguments != nil {
+			call.arguments.WriteString(*delta.Function.Arguments)
+		}
+	}
+}
+
+// Chunk returns the completion accumulated so far. Each choice holds the
+// complete message in Message, and Object is reported as a non-streaming
+// completion. Later calls to Add do not modify a returned result.
+func (a *Accumulator) Chunk() *types.StreamChunk {
+	result := a.chunk
+	if result.Object != nil && *result.Object == objectCompletionChunk {
+		result.Object = types.String(objectCompletion)
+	}
+	result.Citations = append([]string(nil), a.chunk.Citations...)
+	result.SearchResults = append([]types.SearchResult(nil), a.chunk.SearchResults...)
+	if a.chunk.Usage != nil {
+		usage := *a.chunk.Usage
+		result.Usage = &usage
+	}
+
+	indexes := make([]int, 0, len(a.choices))
+	for index := range a.choices {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	result.Choices = make([]types.Choice, 0, len(indexes))
+	for _, index := range indexes {
+		result.Choices = append(result.Choices, a.choices[index].choice(index))
+	}
+	return &result
+}
+
+func (c *choiceAccumulator) choice(index int) types.Choice {
+	role := c.role
+	if role == "" {
+		role = types.RoleAssistant
+	}
+	message := types.ChatMessage{
+		Role:           role,
+		Content:        types.TextContent(c.content.String()),
+		ReasoningSteps: append([]types.ReasoningStep(nil), c.reasoningSteps...),
+	}
+
+	calls := append([]*toolCallAccumulator(nil), c.toolCalls...)
+	sort.SliceStable(calls, func(i, j int) bool { return calls[i].index < calls[j].index })
+	for _, call := range calls {
+		toolCall := types.ToolCall{ID: call.id, Type: call.kind}
+		if call.function {
+			toolCall.Function = &types.ToolCallFunction{
+				Name:      types.String(call.name.String()),
+				Arguments: types.String(call.arguments.String()),
+			}
+		}
+		message.ToolCalls = append(message.ToolCalls, toolCall)
+	}
+
+	return types.Choice{
+		Index:        index,
+		Message:      message,
+		FinishReason: c.finishReason,
+	}
+}
+
+// Collect reads the stream to the end and returns the accumulated
+// completion. If the stream fails, Collect returns the completion received
+// before the failure along with the error. The stream is not closed.
+func (s *Stream) Collect() (*types.StreamChunk, error) {
+	acc := NewAccumulator()
+	for {
+		chunk, err := s.Next()
+		if err == io.EOF {
+			return acc.Chunk(), nil
+		}
+		if err != nil {
+			return acc.Chunk(), err
+		}
+		acc.Add(chunk)
+	}
+}
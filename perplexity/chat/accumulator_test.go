@@ -0,0 +1,150 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity/types"
+)
+
+func decodeChunks(t *testing.T, lines ...string) []*types.StreamChunk {
+	t.Helper()
+	chunks := make([]*types.StreamChunk, 0, len(lines))
+	for _, line := range lines {
+		var chunk types.StreamChunk
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			t.Fatalf("Unmarshal(%s) error: %v", line, err)
+		}
+		chunks = append(chunks, &chunk)
+	}
+	return chunks
+}
+
+func TestAccumulator(t *testing.T) {
+	chunks := decodeChunks(t,
+		`{"id":"c1","model":"sonar","created":1,"object":"chat.completion.chunk","choices":[{"index":0,"delta":{"role":"assistant","content":"Hel","reasoning_steps":[{"thought":"search"}]}},{"index":1,"delta":{"role":"assistant","content":"Bon"}}]}`,
+		`{"id":"c1","model":"sonar","created":1,"object":"chat.completion.chunk","citations":["https://a.example"],"choices":[{"index":0,"delta":{"content":"lo","reasoning_steps":[{"thought":"answer"}]}},{"index":1,"delta":{"content":"jour"},"finish_reason":"length"}]}`,
+		`{"id":"c1","model":"sonar","created":1,"object":"chat.completion.chunk","citations":["https://a.example","https://b.example"],"search_results":[{"title":"A","url":"https://a.example"}],"usage":{"prompt_tokens":3,"completion_tokens":4,"total_tokens":7,"cost":{"total_cost":0.01}},"choices":[{"index":0,"delta":{"content":"!"},"finish_reason":"stop"}]}`,
+	)
+
+	acc := NewAccumulator()
+	acc.Add(chunks[0])
+	partial := acc.Chunk()
+	if got := types.ContentText(partial.Choices[0].Message.Content); got != "Hel" {
+		t.Errorf("partial content = %q, want Hel", got)
+	}
+
+	for _, chunk := range chunks[1:] {
+		acc.Add(chunk)
+	}
+	result := acc.Chunk()
+
+	if result.ID != "c1" || result.Model != "sonar" || result.Object == nil || *result.Object != "chat.completion" {
+		t.Errorf("result = %+v, want completion c1 from sonar", result)
+	}
+	if len(result.Choices) != 2 {
+		t.Fatalf("len(Choices) = %d, want 2", len(result.Choices))
+	}
+	first, second := result.Choices[0], result.Choices[1]
+	if got := types.ContentText(first.Message.Content); got != "Hello!" {
+		t.Errorf("choice 0 content = %q, want Hello!", got)
+	}
+	if got := types.ContentText(second.Message.Content); got != "Bonjour" {
+		t.Errorf("choice 1 content = %q, want Bonjour", got)
+	}
+	if first.Message.Role != types.RoleAssistant {
+		t.Errorf("choice 0 role = %q", first.Message.Role)
+	}
+	if len(first.Message.ReasoningSteps) != 2 || first.Message.ReasoningSteps[1].Thought != "answer" {
+		t.Errorf("choice 0 reasoning steps = %+v", first.Message.ReasoningSteps)
+	}
+	if first.FinishReason == nil || *first.FinishReason != types.FinishReasonStop {
+		t.Errorf("choice 0 finish reason = %v, want stop", first.FinishReason)
+	}
+	if second.FinishReason == nil || *second.FinishReason != types.FinishReasonLength {
+		t.Errorf("choice 1 finish reason = %v, want length", second.FinishReason)
+	}
+	if len(result.Citations) != 2 || len(result.SearchResults) != 1 {
+		t.Errorf("citations = %v, search results = %v", result.Citations, result.SearchResults)
+	}
+	if result.Usage == nil || result.Usage.TotalTokens != 7 {
+		t.Errorf("usage = %+v, want 7 total tokens", result.Usage)
+	}
+
+	// Earlier results are not changed by later chunks.
+	if got := types.ContentText(partial.Choices[0].Message.Content); got != "Hel" {
+		t.Errorf("partial content after Add = %q, want Hel", got)
+	}
+}
+
+func TestAccumulator_ToolCalls(t *testing.T) {
+	chunks := decodeChunks(t,
+		`{"id":"c1","choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}`,
+		`{"id":"c1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}},{"index":1,"id":"call_2","type":"function","function":{"name":"get_time","arguments":"{}"}}]}}]}`,
+		`{"id":"c1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]},"finish_reason":"tool_calls"}]}`,
+	)
+
+	acc := NewAccumulator()
+	for _, chunk := range chunks {
+		acc.Add(chunk)
+	}
+	calls := acc.Chunk().Choices[0].Message.ToolCalls
+	if len(calls) != 2 {
+		t.Fatalf("len(ToolCalls) = %d, want 2", len(calls))
+	}
+	if *calls[0].ID != "call_1" || *calls[0].Function.Name != "get_weather" || *calls[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Errorf("call 0 = %s %s %s", *calls[0].ID, *calls[0].Function.Name, *calls[0].Function.Arguments)
+	}
+	if *calls[1].ID != "call_2" || *calls[1].Function.Name != "get_time" || *calls[1].Function.Arguments != "{}" {
+		t.Errorf("call 1 = %s %s %s", *calls[1].ID, *calls[1].Function.Name, *calls[1].Function.Arguments)
+	}
+	if calls[0].Index != nil {
+		t.Errorf("call 0 index = %d, want nil as in a non-streaming response", *calls[0].Index)
+	}
+}
+
+func TestStream_Collect(t *testing.T) {
+	sseData := `data: {"id":"test-1","model":"sonar","choices":[{"index":0,"delta":{"role":"assistant","content":"Hello"}}]}
+
+data: {"id":"test-1","model":"sonar","choices":[{"index":0,"delta":{"content":" world"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":2,"total_tokens":3,"cost":{"total_cost":0.001}}}
+
+data: [DONE]
+
+`
+	stream := newStream(context.Background(), &http.Response{
+		StatusCode: 200,
+		Body:       io.NopCloser(strings.NewReader(sseData)),
+		Header:     make(http.Header),
+	})
+	defer stream.Close()
+
+	result, err := stream.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error: %v", err)
+	}
+	if got := types.ContentText(result.Choices[0].Message.Content); got != "Hello world" {
+		t.Errorf("content = %q, want Hello world", got)
+	}
+	if result.Usage == nil || result.Usage.TotalTokens != 3 {
+		t.Errorf("usage = %+v", result.Usage)
+	}
+
+	failing := newStream(context.Background(), &http.Response{
+		StatusCode: 200,
+		Body:       io.NopCloser(strings.NewReader("data: {\"id\":\"test-2\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}}]}\n\nevent: error\ndata: boom\n\n")),
+		Header:     make(http.Header),
+	})
+	defer failing.Close()
+
+	result, err = failing.Collect()
+	if err == nil {
+		t.Fatal("Collect() error = nil, want the stream error")
+	}
+	if got := types.ContentText(result.Choices[0].Message.Content); got != "Hi" {
+		t.Errorf("partial content = %q, want Hi", got)
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	nethttp "net/http"
 
 	"github.com/ZaguanLabs/perplexity-go/perplexity/api"
 	"github.com/ZaguanLabs/perplexity-go/perplexity/internal/http"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/internal/sse"
 	"github.com/ZaguanLabs/perplexity-go/perplexity/types"
 )
 
@@ -44,10 +46,12 @@ func (s *Service) Create(ctx context.Context, params *CompletionParams, opts ...
 
 	// Make the request
 	req := &http.Request{
-		Method:  "POST",
-		Path:    "/chat/completions",
-		Body:    params,
-		Options: api.ApplyRequestOptions(opts),
+		Operation: "chat.create",
+		Method:    "POST",
+		Path:      "/chat/completions",
+		Body:      params,
+		Options:   api.ApplyRequestOptions(opts),
+		Usage:     parseUsage,
 	}
 
 	resp, err := s.client.Do(ctx, req)
@@ -78,10 +82,12 @@ func (s *Service) CreateRaw(ctx context.Context, params *CompletionParams, opts
 		return nil, fmt.Errorf("use CreateStream for streaming responses")
 	}
 	req := &http.Request{
-		Method:  "POST",
-		Path:    "/chat/completions",
-		Body:    params,
-		Options: api.ApplyRequestOptions(opts),
+		Operation: "chat.create",
+		Method:    "POST",
+		Path:      "/chat/completions",
+		Body:      params,
+		Options:   api.ApplyRequestOptions(opts),
+		Usage:     parseUsage,
 	}
 	resp, err := s.client.Do(ctx, req)
 	if err != nil {
@@ -122,10 +128,11 @@ func (s *Service) CreateStream(ctx context.Context, params *CompletionParams, op
 
 	// Make the streaming request
 	req := &http.Request{
-		Method:  "POST",
-		Path:    "/chat/completions",
-		Body:    params,
-		Options: api.ApplyRequestOptions(opts),
+		Operation: "chat.create_stream",
+		Method:    "POST",
+		Path:      "/chat/completions",
+		Body:      params,
+		Options:   api.ApplyRequestOptions(opts),
 	}
 
 	resp, err := s.client.DoStream(ctx, req)
@@ -134,5 +141,62 @@ func (s *Service) CreateStream(ctx context.Context, params *CompletionParams, op
 	}
 
 	// Create and return stream
-	return newStream(ctx, resp.Response), nil
+	stream := newStream(ctx, resp.Response)
+	stream.recordUsage = func(usage *types.UsageInfo) {
+		resp.RecordUsage(usageMetrics("", usage))
+	}
+	if reconnects := s.client.StreamReconnects(req); reconnects > 0 {
+		stream.resume = sse.NewResumer(reconnects)
+		stream.resume.RequireID = true
+		stream.reopen = func(lastEventID string) (*nethttp.Response, error) {
+			resumed, err := s.client.Resume(ctx, req, lastEventID)
+			if err != nil {
+				return nil, err
+			}
+			stream.mu.Lock()
+			stream.recordUsage = func(usage *types.UsageInfo) {
+				resumed.RecordUsage(usageMetrics("", usage))
+			}
+			stream.mu.Unlock()
+			return resumed.Response, nil
+		}
+	}
+	return stream, nil
+}
+
+// parseUsage extracts usage from a completion response body.
+func parseUsage(body []byte) *api.UsageMetrics {
+	var result struct {
+		Model string           `json:"model"`
+		Usage *types.UsageInfo `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || result.Usage == nil {
+		return nil
+	}
+	metrics := usageMetrics(result.Model, result.Usage)
+	return &metrics
+}
+
+// usageMetrics converts completion usage to the form reported to api.Metrics.
+func usageMetrics(model string, usage *types.UsageInfo) api.UsageMetrics {
+	metrics := api.UsageMetrics{
+		Model:        model,
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+		TotalTokens:  usage.TotalTokens,
+		InputCost:    usage.Cost.InputTokensCost,
+		OutputCost:   usage.Cost.OutputTokensCost,
+		TotalCost:    usage.Cost.TotalCost,
+		Raw:          usage,
+	}
+	if usage.ReasoningTokens != nil {
+		metrics.ReasoningTokens = *usage.ReasoningTokens
+	}
+	if usage.CitationTokens != nil {
+		metrics.CitationTokens = *usage.CitationTokens
+	}
+	if usage.NumSearchQueries != nil {
+		metrics.SearchQueries = *usage.NumSearchQueries
+	}
+	return metrics
 }
@@ -38,6 +38,21 @@
 //		}
 //	}
 //
+// Collect reads a stream to the end and returns the complete response, with
+// content, reasoning steps and tool calls of every choice joined together:
+//
+//	result, err := stream.Collect()
+//
+// An Accumulator builds the same result one chunk at a time, for callers
+// that also render the deltas as they arrive.
+//
+// Reasoning models start their content with a <think> block. After each
+// Next, ReasoningDelta and ContentDelta return the chunk's content split
+// into reasoning and answer text, even when a tag is split across chunks.
+// For a Create result, use the SplitThink method of the message:
+//
+//	reasoning, answer := result.Choices[0].Message.SplitThink()
+//
 // # Web Search
 //
 // Enable web search for up-to-date information:
@@ -81,4 +96,33 @@
 //		Messages: messages,
 //		Tools:    tools,
 //	})
+//
+// A ToolRunner runs the tool calls the model asks for with registered Go
+// handlers and sends their results back until the model answers:
+//
+//	runner := chat.NewToolRunner(client.Chat)
+//	runner.Register("get_weather", func(ctx context.Context, args json.RawMessage) (string, error) {
+//		return `{"temperature": 21}`, nil
+//	})
+//	run, err := runner.Run(ctx, &chat.CompletionParams{
+//		Model:    "sonar",
+//		Messages: messages,
+//		Tools:    tools,
+//	})
+//
+// # Structured Output
+//
+// CreateStructured requests a reply matching the JSON Schema of a Go type and
+// parses it, asking the model again when the reply does not match:
+//
+//	type Forecast struct {
+//		City string `json:"city"`
+//		High int    `json:"high"`
+//	}
+//
+//	result, err := chat.CreateStructured[Forecast](ctx, client.Chat, &chat.CompletionParams{
+//		Model:    "sonar",
+//		Messages: messages,
+//	}, chat.WithStructuredRetries(3))
+//	fmt.Println(result.Value.High)
 package chat
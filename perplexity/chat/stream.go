@@ -6,86 +6,253 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 
+	"github.com/ZaguanLabs/perplexity-go/perplexity/api"
 	"github.com/ZaguanLabs/perplexity-go/perplexity/internal/sse"
 	"github.com/ZaguanLabs/perplexity-go/perplexity/types"
 )
 
 // Stream represents a stream of chat completion chunks.
+//
+// A stream is read by one goroutine at a time: Next, Recv and Iter must not
+// be called concurrently. Close and Err are safe to call from any goroutine.
+// Close interrupts a Next that is waiting for data, which then returns
+// api.ErrStreamClosed. The stream is also closed when its context ends, and
+// Next then returns the context's error.
 type Stream struct {
-	decoder  *sse.Decoder
-	response *http.Response
-	ctx      context.Context
-	err      error
+	decoder *sse.Decoder
+	ctx     context.Context
+
+	// mu guards the fields below, which Close and Err access from other
+	// goroutines.
+	mu        sync.Mutex
+	response  *http.Response
+	err       error
+	closed    bool
+	done      chan struct{}
+	stopWatch func() bool
+
+	// usage is the last usage reported by the stream, passed to recordUsage
+	// once the stream ends or is closed.
+	usage       *types.UsageInfo
+	recordUsage func(*types.UsageInfo)
+
+	// resume and reopen reconnect the stream after a dropped connection.
+	// They are nil unless stream resumption is enabled.
+	resume *sse.Resumer
+	reopen func(lastEventID string) (*http.Response, error)
+
+	// think splits the content of the first choice into reasoning and
+	// answer text, and the deltas hold the split of the last chunk. They
+	// are only used by the reading goroutine.
+	think          types.ThinkSplitter
+	reasoningDelta string
+	contentDelta   string
 }
 
 // newStream creates a new stream from an HTTP response.
 func newStream(ctx context.Context, resp *http.Response) *Stream {
-	return &Stream{
+	s := &Stream{
 		decoder:  sse.NewDecoder(resp.Body),
 		response: resp,
 		ctx:      ctx,
+		done:     make(chan struct{}),
 	}
+	s.stopWatch = context.AfterFunc(ctx, func() { s.Close() })
+	return s
 }
 
 // Next returns the next chunk in the stream.
 // Returns io.EOF when the stream is complete.
 func (s *Stream) Next() (*types.StreamChunk, error) {
-	// Check if stream already errored
-	if s.err != nil {
-		return nil, s.err
+	s.reasoningDelta, s.contentDelta = "", ""
+
+	// Check if stream already ended
+	s.mu.Lock()
+	err := s.err
+	closed := s.closed
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if closed {
+		return nil, s.end(api.ErrStreamClosed)
 	}
 
 	// Check context cancellation
-	select {
-	case <-s.ctx.Done():
-		s.err = s.ctx.Err()
-		return nil, s.err
-	default:
+	if err := s.ctx.Err(); err != nil {
+		return nil, s.end(err)
 	}
 
 	// Decode next SSE event
-	event, err := s.decoder.Decode()
+	event, err := s.nextEvent()
 	if err != nil {
-		if err == io.EOF {
-			s.err = io.EOF
-		}
-		return nil, err
+		return nil, s.end(err)
 	}
 
 	// Check for done marker
 	if event.IsDone() {
-		s.err = io.EOF
-		return nil, io.EOF
+		s.reasoningDelta, s.contentDelta = s.think.Flush()
+		return nil, s.end(io.EOF)
 	}
 
 	// Check for error event
 	if event.IsError() {
-		s.err = fmt.Errorf("stream error: %s", event.Data)
-		return nil, s.err
+		return nil, s.end(fmt.Errorf("stream error: %s", event.Data))
 	}
 
 	// Parse JSON data
 	data, err := event.ParseJSON()
 	if err != nil {
-		s.err = fmt.Errorf("failed to parse event data: %w", err)
-		return nil, s.err
+		return nil, s.end(fmt.Errorf("failed to parse event data: %w", err))
 	}
 
 	// Unmarshal into StreamChunk
 	var chunk types.StreamChunk
 	if err := json.Unmarshal(data, &chunk); err != nil {
-		s.err = fmt.Errorf("failed to unmarshal chunk: %w", err)
-		return nil, s.err
+		return nil, s.end(fmt.Errorf("failed to unmarshal chunk: %w", err))
+	}
+	if chunk.Usage != nil {
+		s.mu.Lock()
+		s.usage = chunk.Usage
+		s.mu.Unlock()
 	}
+	s.splitThink(&chunk)
 
 	return &chunk, nil
 }
 
-// Close closes the stream and releases resources.
+// splitThink splits the content delta of the first choice of chunk into
+// reasoning and answer text.
+func (s *Stream) splitThink(chunk *types.StreamChunk) {
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		s.reasoningDelta, s.contentDelta = s.think.Write(types.ContentText(choice.Delta.Content))
+		if choice.FinishReason != nil {
+			reasoning, content := s.think.Flush()
+			s.reasoningDelta += reasoning
+			s.contentDelta += content
+		}
+		return
+	}
+}
+
+// ReasoningDelta returns the text of the <think> blocks of reasoning models
+// in the content of the first choice of the last chunk returned by Next.
+// Tags split across chunks are handled: text that may start a tag is held
+// back until the next chunk. After Next returns io.EOF, the deltas hold the
+// text that was still held back. Like Next, it must not be called
+// concurrently with reading the stream.
+func (s *Stream) ReasoningDelta() string {
+	return s.reasoningDelta
+}
+
+// ContentDelta returns the answer text in the content of the first choice
+// of the last chunk returned by Next, without <think> blocks. See
+// ReasoningDelta.
+func (s *Stream) ContentDelta() string {
+	return s.contentDelta
+}
+
+// end records the error that ended the stream and returns it. A read that
+// failed because the context ended or the stream was closed reports that
+// cause instead of the read error.
+func (s *Stream) end(err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if err != io.EOF {
+		if ctxErr := s.ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		} else if s.closed {
+			err = api.ErrStreamClosed
+		}
+	}
+	s.err = err
+	if err == io.EOF {
+		s.flushUsage()
+	}
+	return err
+}
+
+// nextEvent decodes the next event, reopening the stream after a dropped
+// connection when resumption is enabled. Events repeated by the server after
+// a reconnect are skipped.
+func (s *Stream) nextEvent() (*sse.Event, error) {
+	for {
+		event, err := s.decoder.Decode()
+		if err == nil {
+			if s.resume != nil && s.resume.Observe(event) {
+				continue
+			}
+			return event, nil
+		}
+		if s.reopen == nil || !s.resume.Wait(s.ctx, err) {
+			return nil, err
+		}
+		resp, reopenErr := s.reopen(s.resume.LastEventID())
+		if reopenErr != nil {
+			return nil, fmt.Errorf("failed to resume stream: %w", reopenErr)
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			resp.Body.Close()
+			return nil, api.ErrStreamClosed
+		}
+		previous := s.response
+		s.response = resp
+		s.mu.Unlock()
+		previous.Body.Close()
+		s.decoder = sse.NewDecoder(resp.Body)
+	}
+}
+
+// flushUsage reports the last usage seen. The caller must hold s.mu.
+func (s *Stream) flushUsage() {
+	if s.recordUsage != nil && s.usage != nil {
+		s.recordUsage(s.usage)
+	}
+	s.usage = nil
+}
+
+// Err returns the error that ended the stream. It returns nil while the
+// stream is open, after it ended with [DONE], and after it was closed by the
+// caller.
+func (s *Stream) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == io.EOF || s.err == api.ErrStreamClosed {
+		return nil
+	}
+	return s.err
+}
+
+// Close closes the stream and releases resources. It may be called more
+// than once and from any goroutine.
 func (s *Stream) Close() error {
-	if s.response != nil && s.response.Body != nil {
-		return s.response.Body.Close()
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	s.flushUsage()
+	resp := s.response
+	s.mu.Unlock()
+
+	if s.stopWatch != nil {
+		s.stopWatch()
+	}
+	if resp != nil && resp.Body != nil {
+		return resp.Body.Close()
 	}
 	return nil
 }
@@ -96,8 +263,10 @@ func (s *Stream) Recv() (*types.StreamChunk, error) {
 }
 
 // Iter returns a channel that yields stream chunks.
-// The channel is closed when the stream ends or encounters an error.
-// The caller must call Close() to release resources.
+// The channel is closed when the stream ends, fails, or is closed, or its
+// context ends; Err then reports whether the stream failed. Closing the
+// stream stops the goroutine feeding the channel, so a consumer that stops
+// reading early must call Close.
 func (s *Stream) Iter() <-chan *types.StreamChunk {
 	ch := make(chan *types.StreamChunk)
 	go func() {
@@ -109,7 +278,7 @@ func (s *Stream) Iter() <-chan *types.StreamChunk {
 			}
 			select {
 			case ch <- chunk:
-			case <-s.ctx.Done():
+			case <-s.done:
 				return
 			}
 		}
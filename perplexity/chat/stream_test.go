@@ -2,12 +2,18 @@ package chat
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/ZaguanLabs/perplexity-go/perplexity/api"
 	internalhttp "github.com/ZaguanLabs/perplexity-go/perplexity/internal/http"
 	"github.com/ZaguanLabs/perplexity-go/perplexity/types"
 )
@@ -238,3 +244,312 @@ data: [DONE]
 		t.Errorf("Expected 2 chunks, got %d", len(chunks))
 	}
 }
+
+func TestStream_Err(t *testing.T) {
+	t.Run("clean end", func(t *testing.T) {
+		resp := &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader("data: [DONE]\n\n")),
+			Header:     make(http.Header),
+		}
+		stream := newStream(context.Background(), resp)
+		defer stream.Close()
+
+		if _, err := stream.Next(); err != io.EOF {
+			t.Fatalf("Next() error = %v, want io.EOF", err)
+		}
+		if err := stream.Err(); err != nil {
+			t.Errorf("Err() = %v, want nil", err)
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		resp := &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader("event: error\ndata: boom\n\n")),
+			Header:     make(http.Header),
+		}
+		stream := newStream(context.Background(), resp)
+		defer stream.Close()
+
+		for range stream.Iter() {
+		}
+		if err := stream.Err(); err == nil || !strings.Contains(err.Error(), "boom") {
+			t.Errorf("Err() = %v, want the stream error", err)
+		}
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		body, writer := io.Pipe()
+		defer writer.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		stream := newStream(ctx, &http.Response{StatusCode: 200, Body: body, Header: make(http.Header)})
+		defer stream.Close()
+
+		cancel()
+		if _, err := stream.Next(); !errors.Is(err, context.Canceled) {
+			t.Errorf("Next() error = %v, want context.Canceled", err)
+		}
+		if err := stream.Err(); !errors.Is(err, context.Canceled) {
+			t.Errorf("Err() = %v, want context.Canceled", err)
+		}
+	})
+}
+
+func TestStream_CloseUnblocksNext(t *testing.T) {
+	body, writer := io.Pipe()
+	defer writer.Close()
+	stream := newStream(context.Background(), &http.Response{StatusCode: 200, Body: body, Header: make(http.Header)})
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := stream.Next()
+		errc <- err
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	if err := stream.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	select {
+	case err := <-errc:
+		if !errors.Is(err, api.ErrStreamClosed) {
+			t.Errorf("Next() error = %v, want api.ErrStreamClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Next() still blocked after Close()")
+	}
+	if err := stream.Err(); err != nil {
+		t.Errorf("Err() = %v, want nil after Close()", err)
+	}
+	if err := stream.Close(); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+}
+
+// countingMetrics counts the request metrics reported for streams.
+type countingMetrics struct {
+	mu       sync.Mutex
+	requests int
+}
+
+func (m *countingMetrics) RecordRequest(ctx context.Context, r api.RequestMetrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests++
+}
+
+func (m *countingMetrics) RecordUsage(ctx context.Context, u api.UsageMetrics) {}
+
+func TestStream_CloseWithTelemetry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for {
+			fmt.Fprint(w, "data: {\"id\":\"c\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"a\"}}]}\n\n")
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}))
+	defer server.Close()
+
+	metrics := &countingMetrics{}
+	client := internalhttp.NewClient(server.Client(), server.URL, "test-api-key", 0, nil, "test-agent", nil)
+	client.SetLogger(slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelDebug})), 0)
+	client.SetMetrics(metrics)
+
+	stream, err := NewService(client).CreateStream(context.Background(), &CompletionParams{
+		Model:    "sonar",
+		Messages: []types.ChatMessage{types.UserMessage("Hi")},
+	})
+	if err != nil {
+		t.Fatalf("CreateStream() error = %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, err := stream.Next(); err != nil {
+				return
+			}
+		}
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	if err := stream.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Next() still blocked after Close()")
+	}
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	if metrics.requests != 1 {
+		t.Errorf("request metrics = %d, want 1", metrics.requests)
+	}
+}
+
+func TestStream_IterStopsOnClose(t *testing.T) {
+	body, writer := io.Pipe()
+	defer writer.Close()
+	stream := newStream(context.Background(), &http.Response{StatusCode: 200, Body: body, Header: make(http.Header)})
+
+	go func() {
+		for i := 0; i < 100; i++ {
+			chunk := fmt.Sprintf(`data: {"id":"test-%d","choices":[{"index":0,"delta":{"content":"x"}}]}`, i)
+			if _, err := io.WriteString(writer, chunk+"\n\n"); err != nil {
+				return
+			}
+		}
+	}()
+
+	ch := stream.Iter()
+	if chunk := <-ch; chunk == nil || chunk.ID != "test-0" {
+		t.Fatalf("first chunk = %+v, want test-0", chunk)
+	}
+	stream.Close()
+
+	// The channel is closed once the feeding goroutine has exited, with at
+	// most the chunk it was already sending still delivered.
+	timeout := time.After(time.Second)
+	for received := 0; ; received++ {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+			if received > 0 {
+				t.Fatal("Iter() kept sending after Close()")
+			}
+		case <-timeout:
+			t.Fatal("Iter() channel not closed after Close()")
+		}
+	}
+}
+
+func TestService_CreateStream_Resume(t *testing.T) {
+	var lastEventIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+		w.Header().Set("Content-Type", "text/event-stream")
+		chunk := func(id int, content string) {
+			fmt.Fprintf(w, "id: %d\ndata: {\"id\":\"1\",\"model\":\"sonar\",\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", id, content)
+		}
+		if len(lastEventIDs) == 1 {
+			io.WriteString(w, "retry: 5\n\n")
+			chunk(1, "Hel")
+			chunk(2, "lo")
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		// The server replays the last event it saw before resuming.
+		chunk(2, "lo")
+		chunk(3, " world")
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	service := NewService(internalhttp.NewClient(server.Client(), server.URL, "test-api-key", 0, nil, "test-agent", nil))
+	stream, err := service.CreateStream(context.Background(), &CompletionParams{
+		Model:    "sonar",
+		Messages: []types.ChatMessage{types.UserMessage("Hello")},
+	}, api.WithStreamResume(1))
+	if err != nil {
+		t.Fatalf("CreateStream failed: %v", err)
+	}
+	defer stream.Close()
+
+	var content strings.Builder
+	for {
+		chunk, err := stream.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+		if text, ok := chunk.Choices[0].Delta.Content.(types.TextContent); ok {
+			content.WriteString(string(text))
+		}
+	}
+	if content.String() != "Hello world" {
+		t.Errorf("content = %q, want %q", content.String(), "Hello world")
+	}
+	if len(lastEventIDs) != 2 || lastEventIDs[1] != "2" {
+		t.Errorf("Last-Event-ID headers = %q, want a resume after event 2", lastEventIDs)
+	}
+}
+
+func TestService_CreateStream_NoResumeWithoutIDs(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: {\"id\":\"1\",\"model\":\"sonar\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hel\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}))
+	defer server.Close()
+
+	service := NewService(internalhttp.NewClient(server.Client(), server.URL, "test-api-key", 0, nil, "test-agent", nil))
+	stream, err := service.CreateStream(context.Background(), &CompletionParams{
+		Model:    "sonar",
+		Messages: []types.ChatMessage{types.UserMessage("Hello")},
+	}, api.WithStreamResume(3))
+	if err != nil {
+		t.Fatalf("CreateStream failed: %v", err)
+	}
+	defer stream.Close()
+
+	if _, err := stream.Next(); err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if _, err := stream.Next(); err == nil || err == io.EOF {
+		t.Errorf("Next() error = %v, want the connection error", err)
+	}
+	if requests != 1 {
+		t.Errorf("requests = %d, want no reconnect without event IDs", requests)
+	}
+}
+
+func TestStream_ThinkDeltas(t *testing.T) {
+	var sseData strings.Builder
+	for _, delta := range []string{"<th", "ink>\nParis or", " Rome?</thi", "nk>\n\nPar", "is <", "3"} {
+		fmt.Fprintf(&sseData, "data: {\"id\":\"c\",\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", delta)
+	}
+	sseData.WriteString("data: {\"id\":\"c\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\" <\"},\"finish_reason\":\"stop\"}]}\n\n")
+	sseData.WriteString("data: [DONE]\n\n")
+
+	stream := newStream(context.Background(), &http.Response{
+		StatusCode: 200,
+		Body:       io.NopCloser(strings.NewReader(sseData.String())),
+		Header:     make(http.Header),
+	})
+	defer stream.Close()
+
+	var reasoning, content []string
+	for {
+		_, err := stream.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next() error: %v", err)
+		}
+		reasoning = append(reasoning, stream.ReasoningDelta())
+		content = append(content, stream.ContentDelta())
+	}
+	if got := strings.Join(reasoning, "|"); got != "|Paris or| Rome?||||" {
+		t.Errorf("reasoning deltas = %q", got)
+	}
+	if got := strings.Join(content, "|"); got != "|||Par|is |<3| <" {
+		t.Errorf("content deltas = %q", got)
+	}
+}
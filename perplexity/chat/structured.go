@@ -0,0 +1,112 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity/api"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/internal/structured"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/jsonschema"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/types"
+)
+
+// Validate checks the JSON document output against the schema. Mismatches
+// are returned as a jsonschema.ValidationErrors with the path of each value.
+func (r ResponseFormatJSONSchema) Validate(output []byte) error {
+	return jsonschema.Validate(r.JSONSchema.Schema, output)
+}
+
+// StructuredResult is the result of CreateStructured.
+type StructuredResult[T any] struct {
+	// Value is the reply parsed into T.
+	Value T
+
+	// Completion is the completion that produced Value.
+	Completion *types.StreamChunk
+
+	// Attempts is the number of completions requested, including retries.
+	Attempts int
+}
+
+// StructuredOption configures CreateStructured.
+type StructuredOption func(*structuredOptions)
+
+type structuredOptions struct {
+	retries        int
+	requestOptions []api.RequestOption
+}
+
+// WithStructuredRetries sets how many times CreateStructured asks the model
+// again after a reply that cannot be parsed or does not match the schema.
+// The default is 2.
+func WithStructuredRetries(n int) StructuredOption {
+	return func(o *structuredOptions) {
+		o.retries = max(n, 0)
+	}
+}
+
+// WithStructuredRequestOptions sets the request options of every completion
+// requested by CreateStructured.
+func WithStructuredRequestOptions(opts ...api.RequestOption) StructuredOption {
+	return func(o *structuredOptions) {
+		o.requestOptions = append(o.requestOptions, opts...)
+	}
+}
+
+// CreateStructured requests a completion whose reply is a JSON document
+// matching the schema of T, and parses it into T. The response format of
+// params is replaced with the schema of T; params are not modified.
+//
+// <think> blocks and markdown code fences around the document are removed
+// before parsing. When the reply cannot be parsed or does not match the
+// schema, the reply and the error are sent back to the model and the
+// completion is requested again. Once the retries are exhausted, the error
+// is an *api.StructuredOutputError.
+func CreateStructured[T any](ctx context.Context, service *Service, params *CompletionParams, opts ...StructuredOption) (*StructuredResult[T], error) {
+	if params == nil {
+		return nil, fmt.Errorf("params cannot be nil")
+	}
+	options := structuredOptions{retries: structured.DefaultRetries}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	schema, err := jsonschema.For[T]()
+	if err != nil {
+		return nil, err
+	}
+	request := *params
+	request.Stream = nil
+	request.ResponseFormat = NewResponseFormatJSONSchema(ResponseFormatJSONSchema{
+		JSONSchema: JSONSchema{
+			Schema: schema,
+			Name:   types.String(structured.SchemaName[T]()),
+		},
+		Type: ResponseFormatTypeJSONSchema,
+	})
+	request.Messages = append([]types.ChatMessage(nil), params.Messages...)
+
+	var content string
+	for attempt := 1; ; attempt++ {
+		completion, err := service.Create(ctx, &request, options.requestOptions...)
+		if err != nil {
+			return nil, err
+		}
+		if len(completion.Choices) == 0 {
+			return nil, fmt.Errorf("completion has no choices")
+		}
+
+		content = types.ContentText(completion.Choices[0].Message.Content)
+		value, err := structured.Decode[T](content, schema)
+		if err == nil {
+			return &StructuredResult[T]{Value: value, Completion: completion, Attempts: attempt}, nil
+		}
+		if attempt > options.retries {
+			return nil, &api.StructuredOutputError{Attempts: attempt, Content: content, Err: err}
+		}
+		request.Messages = append(request.Messages,
+			types.AssistantMessage(content),
+			types.UserMessage(structured.Feedback(err)),
+		)
+	}
+}
@@ -0,0 +1,135 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity/api"
+	internalhttp "github.com/ZaguanLabs/perplexity-go/perplexity/internal/http"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/types"
+)
+
+type forecast struct {
+	City string `json:"city"`
+	High int    `json:"high"`
+}
+
+func structuredParams() *CompletionParams {
+	return &CompletionParams{
+		Model:    "sonar",
+		Messages: []types.ChatMessage{types.UserMessage("Forecast for Paris?")},
+	}
+}
+
+func TestCreateStructured(t *testing.T) {
+	service, requests := toolServer(t, false,
+		`{"role":"assistant","content":"<think>The user wants JSON.</think>\n`+"```json\\n"+`{\"city\":\"Paris\"}\n`+"```"+`"}`,
+		`{"role":"assistant","content":"<think>Add the high.</think>{\"city\":\"Paris\",\"high\":21}"}`,
+	)
+
+	params := structuredParams()
+	result, err := CreateStructured[forecast](context.Background(), service, params)
+	if err != nil {
+		t.Fatalf("CreateStructured failed: %v", err)
+	}
+	if result.Value != (forecast{City: "Paris", High: 21}) || result.Attempts != 2 || result.Completion == nil {
+		t.Errorf("result = %+v", result)
+	}
+	if params.ResponseFormat != nil || len(params.Messages) != 1 {
+		t.Error("params were modified")
+	}
+
+	if len(*requests) != 2 {
+		t.Fatalf("requests = %d, want 2", len(*requests))
+	}
+	retry := (*requests)[1]
+	if len(retry) != 3 || retry[1]["role"] != "assistant" || retry[2]["role"] != "user" {
+		t.Fatalf("retry messages = %v", retry)
+	}
+	if feedback, _ := retry[2]["content"].(string); !strings.Contains(feedback, `missing required property "high"`) {
+		t.Errorf("feedback = %q", feedback)
+	}
+}
+
+func TestCreateStructured_ResponseFormat(t *testing.T) {
+	var body struct {
+		ResponseFormat *ResponseFormat `json:"response_format"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"c","model":"sonar","choices":[{"index":0,"message":{"role":"assistant","content":"{\"city\":\"Rome\",\"high\":25}"}}]}`)
+	}))
+	defer server.Close()
+	service := NewService(internalhttp.NewClient(server.Client(), server.URL, "test-api-key", 0, nil, "test-agent", nil))
+
+	params := structuredParams()
+	params.ResponseFormat = NewResponseFormatText()
+	result, err := CreateStructured[forecast](context.Background(), service, params)
+	if err != nil {
+		t.Fatalf("CreateStructured failed: %v", err)
+	}
+	if result.Value.City != "Rome" || result.Attempts != 1 {
+		t.Errorf("result = %+v", result)
+	}
+
+	format, ok := body.ResponseFormat.AsJSONSchema()
+	if !ok {
+		t.Fatalf("response_format = %+v, want json_schema", body.ResponseFormat)
+	}
+	if format.JSONSchema.Name == nil || *format.JSONSchema.Name != "forecast" {
+		t.Errorf("schema name = %v", format.JSONSchema.Name)
+	}
+	if properties, _ := format.JSONSchema.Schema["properties"].(map[string]interface{}); len(properties) != 2 {
+		t.Errorf("schema = %v", format.JSONSchema.Schema)
+	}
+}
+
+func TestCreateStructured_RetriesExhausted(t *testing.T) {
+	service, requests := toolServer(t, false, `{"role":"assistant","content":"I cannot answer that."}`)
+
+	_, err := CreateStructured[forecast](context.Background(), service, structuredParams(), WithStructuredRetries(1))
+	var structuredErr *api.StructuredOutputError
+	if !errors.As(err, &structuredErr) {
+		t.Fatalf("error = %v, want StructuredOutputError", err)
+	}
+	if structuredErr.Attempts != 2 || structuredErr.Content != "I cannot answer that." || len(*requests) != 2 {
+		t.Errorf("error = %+v after %d requests", structuredErr, len(*requests))
+	}
+
+	if _, err := CreateStructured[forecast](context.Background(), service, nil); err == nil {
+		t.Error("expected an error for nil params")
+	}
+}
+
+func TestResponseFormatJSONSchema_Validate(t *testing.T) {
+	format := ResponseFormatJSONSchema{
+		Type: ResponseFormatTypeJSONSchema,
+		JSONSchema: JSONSchema{
+			Schema: map[string]interface{}{
+				"type":     "object",
+				"required": []string{"city"},
+				"properties": map[string]interface{}{
+					"city": map[string]interface{}{"type": "string"},
+				},
+				"additionalProperties": false,
+			},
+			Strict: types.Bool(true),
+		},
+	}
+	if err := format.Validate([]byte(`{"city":"Paris"}`)); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+	err := format.Validate([]byte(`{"city":1,"high":21}`))
+	if err == nil || err.Error() != "$.city: expected string, got integer; $.high: additional property is not allowed" {
+		t.Errorf("error = %v", err)
+	}
+}
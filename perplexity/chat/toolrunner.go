@@ -0,0 +1,231 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity/api"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/types"
+)
+
+// DefaultMaxToolSteps is the number of completions a ToolRunner requests in
+// one run when MaxSteps is not set.
+const DefaultMaxToolSteps = 10
+
+// ErrMaxToolSteps is returned by ToolRunner.Run when the model still asks for
+// tool calls after the maximum number of steps.
+var ErrMaxToolSteps = errors.New("tool runner reached the maximum number of steps")
+
+// ToolFunc handles a call of a registered tool. It receives the JSON
+// arguments chosen by the model and returns the content of the tool message
+// sent back to it.
+type ToolFunc func(ctx context.Context, arguments json.RawMessage) (string, error)
+
+// ToolRunner runs the tool calling loop of a chat completion. It requests a
+// completion, runs the tool calls the model asks for with the registered
+// handlers, appends their results as tool messages, and repeats until the
+// model answers without calling a tool.
+//
+// Tool calls of one step run concurrently unless the parameters set
+// ParallelToolCalls to false. A handler error, an unknown tool or a vetoed
+// call does not stop the run: the error is sent to the model as the tool
+// result so that it can recover.
+type ToolRunner struct {
+	// MaxSteps is the maximum number of completions requested in a run.
+	// Zero means DefaultMaxToolSteps.
+	MaxSteps int
+
+	// Stream requests each completion with CreateStream and collects it,
+	// instead of calling Create.
+	Stream bool
+
+	// Approve is called before each tool call runs. Returning an error
+	// vetoes the call.
+	Approve func(ctx context.Context, call types.ToolCall) error
+
+	service  *Service
+	mu       sync.RWMutex
+	handlers map[string]ToolFunc
+}
+
+// ToolRun is the transcript of a ToolRunner run.
+type ToolRun struct {
+	// Messages holds the request messages followed by the assistant and
+	// tool messages of every step.
+	Messages []types.ChatMessage
+
+	// Steps holds each completion of the run with the tool calls it made.
+	Steps []ToolStep
+
+	// Result is the last completion, which holds the final answer when the
+	// run succeeds.
+	Result *types.StreamChunk
+}
+
+// ToolStep is one completion of a ToolRunner run.
+type ToolStep struct {
+	Completion *types.StreamChunk
+	Calls      []ToolCallResult
+}
+
+// ToolCallResult is the outcome of a tool call.
+type ToolCallResult struct {
+	Call types.ToolCall
+
+	// Output is the content of the tool message sent to the model.
+	Output string
+
+	// Err is the error returned by the handler or the approval hook, or the
+	// reason the tool was not found.
+	Err error
+
+	// Vetoed reports whether Approve rejected the call.
+	Vetoed bool
+}
+
+// NewToolRunner creates a tool runner that requests completions from service.
+func NewToolRunner(service *Service) *ToolRunner {
+	return &ToolRunner{
+		service:  service,
+		handlers: make(map[string]ToolFunc),
+	}
+}
+
+// Register sets the handler for the function tool with the given name. The
+// tool itself must be declared in the Tools of the parameters passed to Run.
+func (r *ToolRunner) Register(name string, handler ToolFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[name] = handler
+}
+
+// Run runs the tool calling loop for params, which are not modified. It
+// returns the transcript of the run, which is also returned with an error
+// if the run fails or reaches MaxSteps with ErrMaxToolSteps.
+func (r *ToolRunner) Run(ctx context.Context, params *CompletionParams, opts ...api.RequestOption) (*ToolRun, error) {
+	if params == nil {
+		return nil, fmt.Errorf("params cannot be nil")
+	}
+	maxSteps := r.MaxSteps
+	if maxSteps <= 0 {
+		maxSteps = DefaultMaxToolSteps
+	}
+
+	run := &ToolRun{Messages: append([]types.ChatMessage(nil), params.Messages...)}
+	for step := 0; step < maxSteps; step++ {
+		completion, err := r.complete(ctx, params, run.Messages, opts)
+		if err != nil {
+			return run, err
+		}
+		run.Result = completion
+		if len(completion.Choices) == 0 {
+			return run, fmt.Errorf("completion has no choices")
+		}
+
+		message := completion.Choices[0].Message
+		assistant := types.ChatMessage{
+			Role:      types.RoleAssistant,
+			Content:   message.Content,
+			ToolCalls: message.ToolCalls,
+		}
+		run.Messages = append(run.Messages, assistant)
+		if len(message.ToolCalls) == 0 {
+			run.Steps = append(run.Steps, ToolStep{Completion: completion})
+			return run, nil
+		}
+
+		parallel := params.ParallelToolCalls == nil || *params.ParallelToolCalls
+		results := r.callTools(ctx, message.ToolCalls, parallel)
+		run.Steps = append(run.Steps, ToolStep{Completion: completion, Calls: results})
+		for _, result := range results {
+			tool := types.ToolMessage(result.Output)
+			tool.ToolCallID = result.Call.ID
+			run.Messages = append(run.Messages, tool)
+		}
+		if err := ctx.Err(); err != nil {
+			return run, err
+		}
+	}
+	return run, ErrMaxToolSteps
+}
+
+func (r *ToolRunner) complete(ctx context.Context, params *CompletionParams, messages []types.ChatMessage, opts []api.RequestOption) (*types.StreamChunk, error) {
+	request := *params
+	request.Messages = messages
+	request.Stream = nil
+	if !r.Stream {
+		return r.service.Create(ctx, &request, opts...)
+	}
+
+	stream, err := r.service.CreateStream(ctx, &request, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	return stream.Collect()
+}
+
+func (r *ToolRunner) callTools(ctx context.Context, calls []types.ToolCall, parallel bool) []ToolCallResult {
+	results := make([]ToolCallResult, len(calls))
+	if !parallel {
+		for i, call := range calls {
+			results[i] = r.callTool(ctx, call)
+		}
+		return results
+	}
+
+	var wg sync.WaitGroup
+	for i, call := range calls {
+		wg.Add(1)
+		go func(i int, call types.ToolCall) {
+			defer wg.Done()
+			results[i] = r.callTool(ctx, call)
+		}(i, call)
+	}
+	wg.Wait()
+	return results
+}
+
+func (r *ToolRunner) callTool(ctx context.Context, call types.ToolCall) ToolCallResult {
+	result := ToolCallResult{Call: call}
+	var name string
+	arguments := json.RawMessage("{}")
+	if call.Function != nil {
+		if call.Function.Name != nil {
+			name = *call.Function.Name
+		}
+		if call.Function.Arguments != nil && *call.Function.Arguments != "" {
+			arguments = json.RawMessage(*call.Function.Arguments)
+		}
+	}
+
+	r.mu.RLock()
+	handler := r.handlers[name]
+	r.mu.RUnlock()
+	if handler == nil {
+		result.Err = fmt.Errorf("unknown tool %q", name)
+		result.Output = "error: " + result.Err.Error()
+		return result
+	}
+
+	if r.Approve != nil {
+		if err := r.Approve(ctx, call); err != nil {
+			result.Err = err
+			result.Vetoed = true
+			result.Output = "error: tool call rejected: " + err.Error()
+			return result
+		}
+	}
+
+	output, err := handler(ctx, arguments)
+	if err != nil {
+		result.Err = err
+		result.Output = "error: " + err.Error()
+		return result
+	}
+	result.Output = output
+	return result
+}
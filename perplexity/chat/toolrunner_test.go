@@ -0,0 +1,189 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	internalhttp "github.com/ZaguanLabs/perplexity-go/perplexity/internal/http"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/types"
+)
+
+// toolServer replies with the scripted completion messages in order and
+// records the messages of each request.
+func toolServer(t *testing.T, stream bool, replies ...string) (*Service, *[][]map[string]any) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests [][]map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []map[string]any `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		mu.Lock()
+		requests = append(requests, body.Messages)
+		reply := replies[min(len(requests), len(replies))-1]
+		mu.Unlock()
+
+		if stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "data: {\"id\":\"c\",\"choices\":[{\"index\":0,\"delta\":%s}]}\n\ndata: [DONE]\n\n", reply)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":"c","model":"sonar","choices":[{"index":0,"message":%s}]}`, reply)
+	}))
+	t.Cleanup(server.Close)
+
+	client := internalhttp.NewClient(server.Client(), server.URL, "test-api-key", 0, nil, "test-agent", nil)
+	return NewService(client), &requests
+}
+
+func toolParams() *CompletionParams {
+	return &CompletionParams{
+		Model:    "sonar",
+		Messages: []types.ChatMessage{types.UserMessage("What is the weather in Paris and Rome?")},
+		Tools: []types.Tool{{
+			Type:     types.ToolTypeFunction,
+			Function: types.ToolFunction{Name: "get_weather"},
+		}},
+	}
+}
+
+const weatherCalls = `{"role":"assistant","content":null,"tool_calls":[` +
+	`{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}},` +
+	`{"id":"call_2","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Rome\"}"}}]}`
+
+func TestToolRunner_Run(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		t.Run(fmt.Sprintf("stream=%v", stream), func(t *testing.T) {
+			service, requests := toolServer(t, stream, weatherCalls, `{"role":"assistant","content":"Sunny in both."}`)
+
+			var running, maxRunning atomic.Int32
+			runner := NewToolRunner(service)
+			runner.Stream = stream
+			runner.Register("get_weather", func(ctx context.Context, arguments json.RawMessage) (string, error) {
+				n := running.Add(1)
+				defer running.Add(-1)
+				for {
+					current := maxRunning.Load()
+					if n <= current || maxRunning.CompareAndSwap(current, n) {
+						break
+					}
+				}
+				time.Sleep(20 * time.Millisecond)
+
+				var args struct{ City string }
+				if err := json.Unmarshal(arguments, &args); err != nil {
+					return "", err
+				}
+				return "sunny in " + args.City, nil
+			})
+
+			params := toolParams()
+			run, err := runner.Run(context.Background(), params)
+			if err != nil {
+				t.Fatalf("Run() error: %v", err)
+			}
+
+			if got := types.ContentText(run.Result.Choices[0].Message.Content); got != "Sunny in both." {
+				t.Errorf("final answer = %q", got)
+			}
+			if len(run.Steps) != 2 || len(run.Steps[0].Calls) != 2 {
+				t.Fatalf("steps = %+v, want 2 steps with 2 calls first", run.Steps)
+			}
+			if maxRunning.Load() != 2 {
+				t.Errorf("max concurrent calls = %d, want 2", maxRunning.Load())
+			}
+			if len(run.Messages) != 5 {
+				t.Fatalf("len(Messages) = %d, want user, assistant, 2 tool, assistant", len(run.Messages))
+			}
+			tool := run.Messages[3]
+			if tool.Role != types.RoleTool || *tool.ToolCallID != "call_2" || types.ContentText(tool.Content) != "sunny in Rome" {
+				t.Errorf("tool message = %+v", tool)
+			}
+			if len(params.Messages) != 1 || params.Stream != nil {
+				t.Errorf("params were modified: %+v", params)
+			}
+
+			second := (*requests)[1]
+			if len(second) != 4 || second[2]["tool_call_id"] != "call_1" || second[2]["content"] != "sunny in Paris" {
+				t.Errorf("second request messages = %v", second)
+			}
+		})
+	}
+}
+
+func TestToolRunner_ApproveAndErrors(t *testing.T) {
+	calls := `{"role":"assistant","tool_calls":[` +
+		`{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{}"}},` +
+		`{"id":"call_2","type":"function","function":{"name":"delete_files","arguments":"{}"}},` +
+		`{"id":"call_3","type":"function","function":{"name":"unknown","arguments":"{}"}}]}`
+	service, _ := toolServer(t, false, calls, `{"role":"assistant","content":"Done."}`)
+
+	var order []string
+	runner := NewToolRunner(service)
+	runner.Register("get_weather", func(ctx context.Context, arguments json.RawMessage) (string, error) {
+		order = append(order, "get_weather")
+		return "", errors.New("service unavailable")
+	})
+	runner.Register("delete_files", func(ctx context.Context, arguments json.RawMessage) (string, error) {
+		t.Error("vetoed tool was called")
+		return "", nil
+	})
+	runner.Approve = func(ctx context.Context, call types.ToolCall) error {
+		order = append(order, "approve:"+*call.Function.Name)
+		if *call.Function.Name == "delete_files" {
+			return errors.New("not allowed")
+		}
+		return nil
+	}
+
+	params := toolParams()
+	params.ParallelToolCalls = types.Bool(false)
+	run, err := runner.Run(context.Background(), params)
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+
+	if got := strings.Join(order, " "); got != "approve:get_weather get_weather approve:delete_files" {
+		t.Errorf("order = %q, want sequential calls", got)
+	}
+	results := run.Steps[0].Calls
+	if results[0].Output != "error: service unavailable" || results[0].Vetoed {
+		t.Errorf("handler error result = %+v", results[0])
+	}
+	if !results[1].Vetoed || results[1].Output != "error: tool call rejected: not allowed" {
+		t.Errorf("vetoed result = %+v", results[1])
+	}
+	if results[2].Err == nil || results[2].Output != `error: unknown tool "unknown"` {
+		t.Errorf("unknown tool result = %+v", results[2])
+	}
+}
+
+func TestToolRunner_MaxSteps(t *testing.T) {
+	service, requests := toolServer(t, false, weatherCalls)
+	runner := NewToolRunner(service)
+	runner.MaxSteps = 3
+	runner.Register("get_weather", func(ctx context.Context, arguments json.RawMessage) (string, error) {
+		return "sunny", nil
+	})
+
+	run, err := runner.Run(context.Background(), toolParams())
+	if !errors.Is(err, ErrMaxToolSteps) {
+		t.Fatalf("Run() error = %v, want ErrMaxToolSteps", err)
+	}
+	if len(*requests) != 3 || len(run.Steps) != 3 {
+		t.Errorf("requests = %d, steps = %d; want 3", len(*requests), len(run.Steps))
+	}
+}
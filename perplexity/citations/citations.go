@@ -0,0 +1,400 @@
+package citations
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity/responses"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/types"
+)
+
+const (
+	// maxMarkerLen bounds the length of a marker, so that a stray "[" does
+	// not hold back the rest of a stream.
+	maxMarkerLen = 64
+
+	// maxRange bounds the number of sources of a range such as [1-3].
+	maxRange = 50
+)
+
+// Citation is a part of the text that cites sources.
+type Citation struct {
+	// Start and End are the byte offsets of the citation in the text. For
+	// a marker, they delimit the marker itself; for an annotation, the
+	// annotated text.
+	Start int
+	End   int
+
+	// Marker is the text of the marker, such as "[1]" or "[2-4]". It is
+	// empty for annotations.
+	Marker string
+
+	// Numbers are the 1-based numbers of the cited sources, with ranges
+	// expanded.
+	Numbers []int
+}
+
+// Source is a cited source.
+type Source struct {
+	// Number is the 1-based number of the source in markers.
+	Number int `json:"number"`
+
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+
+	// Result is the search result of the source, when the response has
+	// one with the same URL.
+	Result *types.SearchResult `json:"search_result,omitempty"`
+}
+
+// Document is an answer with its citations linked to their sources.
+type Document struct {
+	Text      string
+	Citations []Citation
+
+	// Sources holds the sources in number order: the source numbered n is
+	// Sources[n-1].
+	Sources []Source
+}
+
+// Parse returns the citation markers in text, such as [1], [1, 3], [2-4]
+// and [1][2]. Markdown links, such as [1](https://example.com), are not
+// markers.
+func Parse(text string) []Citation {
+	citations, _ := scan(text, 0, true)
+	return citations
+}
+
+// New parses the markers of text and links them to the citation URLs and
+// search results of a chat completion. Marker n refers to urls[n-1], and
+// a search result is linked to the URL it shares. Without URLs, marker n
+// refers to results[n-1].
+func New(text string, urls []string, results []types.SearchResult) *Document {
+	return &Document{
+		Text:      text,
+		Citations: Parse(text),
+		Sources:   sources(urls, results),
+	}
+}
+
+// FromChunk returns the document of the message of the first choice of a
+// chat completion, such as the result of Create or of Stream.Collect.
+func FromChunk(chunk *types.StreamChunk) *Document {
+	if chunk == nil {
+		return &Document{}
+	}
+	var text string
+	for _, choice := range chunk.Choices {
+		if choice.Index == 0 {
+			text = types.ContentText(choice.Message.Content)
+			break
+		}
+	}
+	return New(text, chunk.Citations, chunk.SearchResults)
+}
+
+// FromContentPart returns the document of a responses content part, with a
+// citation for each of its annotations. Annotation indexes count
+// characters. Sources are numbered by URL in the order in which they are
+// first cited, and linked to the search result with the same URL in
+// results.
+func FromContentPart(part responses.ContentPart, results []responses.SearchResult) *Document {
+	doc := &Document{Text: part.Text}
+	offsets := runeOffsets(part.Text)
+	numbers := make(map[string]int)
+
+	annotations := append([]responses.Annotation(nil), part.Annotations...)
+	sort.SliceStable(annotations, func(i, j int) bool {
+		a, b := annotations[i].StartIndex, annotations[j].StartIndex
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return *a < *b
+	})
+	for _, annotation := range annotations {
+		url := value(annotation.URL)
+		if url == "" {
+			continue
+		}
+		number, ok := numbers[url]
+		if !ok {
+			number = len(doc.Sources) + 1
+			numbers[url] = number
+			source := Source{Number: number, URL: url, Title: value(annotation.Title)}
+			for i := range results {
+				if results[i].URL == url {
+					source.Result = searchResult(results[i])
+					if source.Title == "" {
+						source.Title = results[i].Title
+					}
+					break
+				}
+			}
+			doc.Sources = append(doc.Sources, source)
+		}
+
+		if annotation.StartIndex == nil || annotation.EndIndex == nil {
+			continue
+		}
+		start := offsets[clamp(*annotation.StartIndex, 0, len(offsets)-1)]
+		end := offsets[clamp(*annotation.EndIndex, 0, len(offsets)-1)]
+		if start > end {
+			continue
+		}
+		doc.Citations = append(doc.Citations, Citation{Start: start, End: end, Numbers: []int{number}})
+	}
+	return doc
+}
+
+// Source returns the source numbered n, or nil if there is none.
+func (d *Document) Source(n int) *Source {
+	if n < 1 || n > len(d.Sources) {
+		return nil
+	}
+	return &d.Sources[n-1]
+}
+
+// Cited returns the sources cited at least once, in number order.
+func (d *Document) Cited() []Source {
+	cited := make([]bool, len(d.Sources))
+	for _, citation := range d.Citations {
+		for _, n := range citation.Numbers {
+			if d.Source(n) != nil {
+				cited[n-1] = true
+			}
+		}
+	}
+	var sources []Source
+	for i, ok := range cited {
+		if ok {
+			sources = append(sources, d.Sources[i])
+		}
+	}
+	return sources
+}
+
+// Dangling returns the citations that refer to numbers without a source,
+// with their Numbers limited to those numbers.
+func (d *Document) Dangling() []Citation {
+	var dangling []Citation
+	for _, citation := range d.Citations {
+		var missing []int
+		for _, n := range citation.Numbers {
+			if d.Source(n) == nil {
+				missing = append(missing, n)
+			}
+		}
+		if len(missing) > 0 {
+			citation.Numbers = missing
+			dangling = append(dangling, citation)
+		}
+	}
+	return dangling
+}
+
+// sources links citation URLs to search results.
+func sources(urls []string, results []types.SearchResult) []Source {
+	var sources []Source
+	if len(urls) == 0 {
+		for i := range results {
+			result := results[i]
+			sources = append(sources, Source{Number: i + 1, URL: result.URL, Title: result.Title, Result: &result})
+		}
+		return sources
+	}
+	for i, url := range urls {
+		source := Source{Number: i + 1, URL: url}
+		for j := range results {
+			if results[j].URL == url {
+				result := results[j]
+				source.Title = result.Title
+				source.Result = &result
+				break
+			}
+		}
+		sources = append(sources, source)
+	}
+	return sources
+}
+
+type markerState int
+
+const (
+	markerInvalid markerState = iota
+	markerPartial
+	markerValid
+)
+
+// scan returns the markers of text from offset from, and the offset at
+// which scanning stopped. Unless final is set, scanning stops at a marker
+// that may continue in text appended later.
+func scan(text string, from int, final bool) ([]Citation, int) {
+	var citations []Citation
+	i := from
+	for i < len(text) {
+		j := strings.IndexByte(text[i:], '[')
+		if j < 0 {
+			return citations, len(text)
+		}
+		start := i + j
+		numbers, end, state := parseMarker(text, start, final)
+		switch state {
+		case markerPartial:
+			return citations, start
+		case markerValid:
+			citations = append(citations, Citation{Start: start, End: end, Marker: text[start:end], Numbers: numbers})
+			i = end
+		default:
+			i = start + 1
+		}
+	}
+	return citations, i
+}
+
+// parseMarker parses the marker at text[start], which is '['.
+func parseMarker(text string, start int, final bool) ([]int, int, markerState) {
+	// partial reports a marker cut off by the end of text.
+	partial := func() ([]int, int, markerState) {
+		if final || len(text)-start > maxMarkerLen {
+			return nil, 0, markerInvalid
+		}
+		return nil, 0, markerPartial
+	}
+
+	var numbers []int
+	pos := start + 1
+	for {
+		pos = skipSpaces(text, pos)
+		first, next := parseNumber(text, pos)
+		if next == len(text) {
+			return partial()
+		}
+		if first == 0 {
+			return nil, 0, markerInvalid
+		}
+		pos = skipSpaces(text, next)
+		if pos == len(text) {
+			return partial()
+		}
+
+		last := first
+		if dash := rangeDash(text[pos:]); dash != 0 {
+			if dash < 0 {
+				return partial()
+			}
+			pos = skipSpaces(text, pos+dash)
+			last, next = parseNumber(text, pos)
+			if next == len(text) {
+				return partial()
+			}
+			if last < first || last-first >= maxRange {
+				return nil, 0, markerInvalid
+			}
+			pos = skipSpaces(text, next)
+			if pos == len(text) {
+				return partial()
+			}
+		}
+		for n := first; n <= last; n++ {
+			numbers = append(numbers, n)
+		}
+
+		switch text[pos] {
+		case ',':
+			pos++
+		case ']':
+			end := pos + 1
+			if end == len(text) && !final {
+				// A following "(" would make it a Markdown link.
+				return partial()
+			}
+			if end < len(text) && text[end] == '(' {
+				return nil, 0, markerInvalid
+			}
+			return numbers, end, markerValid
+		default:
+			return nil, 0, markerInvalid
+		}
+	}
+}
+
+// parseNumber parses a source number of up to three digits at text[pos].
+// It returns 0 if there is none, and len(text) as the next offset if the
+// number may continue.
+func parseNumber(text string, pos int) (int, int) {
+	n, digits := 0, 0
+	for pos < len(text) && text[pos] >= '0' && text[pos] <= '9' {
+		n = n*10 + int(text[pos]-'0')
+		digits++
+		pos++
+	}
+	if pos == len(text) {
+		return n, pos
+	}
+	if digits > 3 {
+		return 0, pos
+	}
+	return n, pos
+}
+
+// rangeDash returns the length of the hyphen or en dash at the start of
+// text, 0 if there is none, or -1 if text ends with part of an en dash.
+func rangeDash(text string) int {
+	const enDash = "–"
+	switch {
+	case strings.HasPrefix(text, "-"):
+		return 1
+	case strings.HasPrefix(text, enDash):
+		return len(enDash)
+	case len(text) < len(enDash) && strings.HasPrefix(enDash, text):
+		return -1
+	}
+	return 0
+}
+
+func skipSpaces(text string, pos int) int {
+	for pos < len(text) && text[pos] == ' ' {
+		pos++
+	}
+	return pos
+}
+
+// runeOffsets returns the byte offset of each character of text, followed
+// by the length of text.
+func runeOffsets(text string) []int {
+	offsets := make([]int, 0, utf8.RuneCountInString(text)+1)
+	for i := range text {
+		offsets = append(offsets, i)
+	}
+	return append(offsets, len(text))
+}
+
+func searchResult(result responses.SearchResult) *types.SearchResult {
+	converted := &types.SearchResult{
+		Title:       result.Title,
+		URL:         result.URL,
+		Date:        result.Date,
+		LastUpdated: result.LastUpdated,
+	}
+	if result.Snippet != "" {
+		converted.Snippet = types.String(result.Snippet)
+	}
+	if result.Source != nil {
+		source := types.SearchResultSource(*result.Source)
+		converted.Source = &source
+	}
+	return converted
+}
+
+func value[T any](p *T) T {
+	var zero T
+	if p == nil {
+		return zero
+	}
+	return *p
+}
+
+func clamp(n, low, high int) int {
+	return max(low, min(n, high))
+}
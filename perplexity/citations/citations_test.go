@@ -0,0 +1,177 @@
+package citations
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity/responses"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/types"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Paris[1].", "[1]@5-8:1"},
+		{"Paris [1][2] and Rome [3].", "[1]@6-9:1 [2]@9-12:2 [3]@22-25:3"},
+		{"Both [1, 3].", "[1, 3]@5-11:1,3"},
+		{"Range [2-4] and [5–6].", "[2-4]@6-11:2,3,4 [5–6]@16-23:5,6"},
+		{"Mixed [1,3-4]", "[1,3-4]@6-13:1,3,4"},
+		{"Link [1](https://example.com) and [x] and [0] and [2024] and [3-1].", ""},
+		{"Array a[i] and [1 2] and [", ""},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, c := range Parse(tt.text) {
+			got = append(got, fmt.Sprintf("%s@%d-%d:%s", c.Marker, c.Start, c.End, joinInts(c.Numbers)))
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("Parse(%q) = %v, want %s", tt.text, got, tt.want)
+		}
+	}
+}
+
+func joinInts(numbers []int) string {
+	parts := make([]string, len(numbers))
+	for i, n := range numbers {
+		parts[i] = fmt.Sprint(n)
+	}
+	return strings.Join(parts, ",")
+}
+
+func TestFromChunk(t *testing.T) {
+	chunk := &types.StreamChunk{
+		Choices: []types.Choice{{Index: 0, Message: types.ChatMessage{
+			Role:    types.RoleAssistant,
+			Content: types.TextContent("Paris is the capital [1][3]. It is <big> [1-2] [7]."),
+		}}},
+		Citations: []string{"https://a.example", "https://b.example/x y", "https://c.example"},
+		SearchResults: []types.SearchResult{
+			{Title: "C [site]", URL: "https://c.example"},
+			{Title: "A", URL: "https://a.example"},
+		},
+	}
+	doc := FromChunk(chunk)
+
+	if len(doc.Sources) != 3 || doc.Sources[0].Title != "A" || doc.Sources[0].Result == nil || doc.Sources[1].Result != nil {
+		t.Fatalf("sources = %+v", doc.Sources)
+	}
+	dangling := doc.Dangling()
+	if len(dangling) != 1 || dangling[0].Marker != "[7]" || !reflect.DeepEqual(dangling[0].Numbers, []int{7}) {
+		t.Errorf("dangling = %+v", dangling)
+	}
+
+	wantMarkdown := "Paris is the capital [^1][^3]. It is <big> [^1][^2] [7].\n\n" +
+		"[^1]: [A](https://a.example)\n" +
+		"[^2]: [https://b.example/x y](https://b.example/x%20y)\n" +
+		"[^3]: [C \\[site\\]](https://c.example)\n"
+	if got := doc.Markdown(); got != wantMarkdown {
+		t.Errorf("Markdown() =\n%s\nwant\n%s", got, wantMarkdown)
+	}
+
+	wantHTML := `Paris is the capital <a href="https://a.example" title="A">[1]</a><a href="https://c.example" title="C [site]">[3]</a>. ` +
+		`It is &lt;big&gt; <a href="https://a.example" title="A">[1]</a><a href="https://b.example/x y" title="https://b.example/x y">[2]</a> [7].`
+	if got := doc.HTML(); got != wantHTML {
+		t.Errorf("HTML() =\n%s\nwant\n%s", got, wantHTML)
+	}
+
+	data, err := doc.JSON()
+	if err != nil {
+		t.Fatalf("JSON failed: %v", err)
+	}
+	want := `{"start":47,"end":50,"text":"[7]","marker":"[7]","dangling":[7]}`
+	if !strings.Contains(string(data), want) || !strings.HasPrefix(string(data), `[{"start":0,"end":21,"text":"Paris is the capital "},{"start":21,"end":24,"text":"[1]","marker":"[1]","sources":[{"number":1,"url":"https://a.example","title":"A","search_result":{`) {
+		t.Errorf("JSON() = %s", data)
+	}
+
+	withoutURLs := New("See [2].", nil, chunk.SearchResults)
+	if source := withoutURLs.Source(2); source == nil || source.URL != "https://a.example" {
+		t.Errorf("source 2 without URLs = %+v", source)
+	}
+}
+
+func TestParser(t *testing.T) {
+	text := "Paris [1], Rome [2–3] and a[i] [1](link) [4]"
+	want := Parse(text)
+	for i := 0; i <= len(text); i++ {
+		for j := i; j <= len(text); j++ {
+			p := NewParser()
+			var got []Citation
+			for _, delta := range []string{text[:i], text[i:j], text[j:]} {
+				got = append(got, p.Write(delta)...)
+			}
+			got = append(got, p.Flush()...)
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("splits at %d, %d = %+v, want %+v", i, j, got, want)
+			}
+		}
+	}
+
+	p := NewParser()
+	if got := p.Write("Paris [1"); len(got) != 0 {
+		t.Errorf("partial marker returned %+v", got)
+	}
+	if got := p.Write("] is"); len(got) != 1 || got[0].Start != 6 {
+		t.Errorf("completed marker = %+v", got)
+	}
+	if got := p.Write(" [2]"); len(got) != 0 {
+		t.Errorf("marker at the end returned before its next character: %+v", got)
+	}
+	if doc := p.Document(); len(doc.Citations) != 2 {
+		t.Errorf("Document() citations = %+v", doc.Citations)
+	}
+}
+
+func TestParser_WriteChunk(t *testing.T) {
+	p := NewParser()
+	chunk := func(content string, urls ...string) *types.StreamChunk {
+		return &types.StreamChunk{
+			Citations: urls,
+			Choices:   []types.Choice{{Index: 0, Delta: types.ChatMessage{Content: types.TextContent(content)}}},
+		}
+	}
+	p.WriteChunk(chunk("Paris [", "https://a.example"))
+	p.WriteChunk(chunk("1] and [2]"))
+	p.WriteChunk(chunk(".", "https://a.example", "https://b.example"))
+
+	doc := p.Document()
+	if doc.Text != "Paris [1] and [2]." || len(doc.Citations) != 2 || len(doc.Sources) != 2 || len(doc.Dangling()) != 0 {
+		t.Errorf("document = %+v", doc)
+	}
+}
+
+func TestFromContentPart(t *testing.T) {
+	index := func(n int) *int { return &n }
+	part := responses.ContentPart{
+		Type: responses.ContentPartTypeOutputText,
+		Text: "Café Paris is nice. Rome too.",
+		Annotations: []responses.Annotation{
+			{StartIndex: index(20), EndIndex: index(29), URL: types.String("https://b.example")},
+			{StartIndex: index(0), EndIndex: index(10), URL: types.String("https://a.example"), Title: types.String("A")},
+			{StartIndex: index(5), EndIndex: index(19), URL: types.String("https://b.example")},
+			{URL: types.String("https://c.example")},
+		},
+	}
+	results := []responses.SearchResult{{URL: "https://b.example", Title: "B", Snippet: "Rome"}}
+	doc := FromContentPart(part, results)
+
+	if len(doc.Sources) != 3 || doc.Sources[0].URL != "https://a.example" || doc.Sources[1].Title != "B" ||
+		doc.Sources[1].Result == nil || *doc.Sources[1].Result.Snippet != "Rome" {
+		t.Fatalf("sources = %+v", doc.Sources)
+	}
+	if len(doc.Citations) != 3 || doc.Citations[0].Start != 0 || doc.Citations[0].End != 11 {
+		t.Fatalf("citations = %+v", doc.Citations)
+	}
+
+	want := `<a href="https://a.example" title="A">Café Paris</a> is nice. <a href="https://b.example" title="B">Rome too.</a>`
+	if got := doc.HTML(); got != want {
+		t.Errorf("HTML() =\n%s\nwant\n%s", got, want)
+	}
+	wantMarkdown := "Café Paris[^1] is nice. Rome too.[^2]\n\n[^1]: [A](https://a.example)\n[^2]: [B](https://b.example)\n"
+	if got := doc.Markdown(); got != wantMarkdown {
+		t.Errorf("Markdown() =\n%s\nwant\n%s", got, wantMarkdown)
+	}
+}
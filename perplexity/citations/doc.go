@@ -0,0 +1,40 @@
+// Package citations links the citations of an answer to their sources and
+// renders them.
+//
+// Chat answers cite sources with markers such as [1], [1, 3] or [2-4], where
+// marker n refers to the nth entry of the completion's Citations, and to the
+// search result with the same URL. A Document holds an answer with its
+// parsed markers and linked sources:
+//
+//	result, err := client.Chat.Create(ctx, params)
+//	if err != nil {
+//		return err
+//	}
+//	doc := citations.FromChunk(result)
+//	fmt.Println(doc.Markdown())
+//	for _, citation := range doc.Dangling() {
+//		log.Printf("marker %s cites no source", citation.Marker)
+//	}
+//
+// Markdown renders the citations as footnotes, HTML as inline links, and
+// JSON as a list of text and citation spans.
+//
+// A Parser finds the markers of a streamed answer as they arrive, including
+// markers split across chunks:
+//
+//	parser := citations.NewParser()
+//	for {
+//		chunk, err := stream.Next()
+//		if err != nil {
+//			break
+//		}
+//		for _, citation := range parser.WriteChunk(chunk) {
+//			fmt.Println("cites", citation.Numbers)
+//		}
+//	}
+//	doc := parser.Document()
+//
+// Responses content parts cite sources with annotations instead of markers.
+// FromContentPart turns each annotation into a citation of the annotated
+// text.
+package citations
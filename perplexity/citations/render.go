@@ -0,0 +1,151 @@
+package citations
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+)
+
+// Span is a part of the text of a Document, as listed by Spans.
+type Span struct {
+	// Start and End are the byte offsets of the span in the text.
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Text  string `json:"text"`
+
+	// Marker is the citation marker of the span, if any.
+	Marker string `json:"marker,omitempty"`
+
+	// Sources are the sources cited by the span.
+	Sources []Source `json:"sources,omitempty"`
+
+	// Dangling are the cited numbers without a source.
+	Dangling []int `json:"dangling,omitempty"`
+}
+
+// Spans splits the text into consecutive spans, each either plain text or
+// a citation with its sources. Citations that overlap an earlier one are
+// left out.
+func (d *Document) Spans() []Span {
+	var spans []Span
+	last := 0
+	for _, citation := range d.ordered() {
+		if citation.Start > last {
+			spans = append(spans, Span{Start: last, End: citation.Start, Text: d.Text[last:citation.Start]})
+		}
+		span := Span{
+			Start:  citation.Start,
+			End:    citation.End,
+			Text:   d.Text[citation.Start:citation.End],
+			Marker: citation.Marker,
+		}
+		for _, n := range citation.Numbers {
+			if source := d.Source(n); source != nil {
+				span.Sources = append(span.Sources, *source)
+			} else {
+				span.Dangling = append(span.Dangling, n)
+			}
+		}
+		spans = append(spans, span)
+		last = citation.End
+	}
+	if last < len(d.Text) {
+		spans = append(spans, Span{Start: last, End: len(d.Text), Text: d.Text[last:]})
+	}
+	return spans
+}
+
+// JSON returns Spans encoded as a JSON array.
+func (d *Document) JSON() ([]byte, error) {
+	spans := d.Spans()
+	if spans == nil {
+		spans = []Span{}
+	}
+	return json.Marshal(spans)
+}
+
+// Markdown renders the text with its citations as Markdown footnotes, such
+// as [^1], followed by the footnote of each cited source. Dangling markers
+// are kept as they are.
+func (d *Document) Markdown() string {
+	var b strings.Builder
+	for _, span := range d.Spans() {
+		if span.Marker == "" {
+			b.WriteString(span.Text)
+		}
+		if span.Marker != "" && len(span.Dangling) > 0 {
+			b.WriteString(span.Text)
+			continue
+		}
+		for _, source := range span.Sources {
+			fmt.Fprintf(&b, "[^%d]", source.Number)
+		}
+	}
+
+	cited := d.Cited()
+	if len(cited) > 0 {
+		b.WriteString("\n\n")
+	}
+	for _, source := range cited {
+		fmt.Fprintf(&b, "[^%d]: [%s](%s)\n", source.Number, markdownEscaper.Replace(title(source)), urlEscaper.Replace(source.URL))
+	}
+	return b.String()
+}
+
+// HTML renders the text as HTML, with each marker replaced by links to its
+// sources and each annotated text wrapped in a link. Dangling markers are
+// kept as they are.
+func (d *Document) HTML() string {
+	var b strings.Builder
+	for _, span := range d.Spans() {
+		text := html.EscapeString(span.Text)
+		switch {
+		case len(span.Sources) == 0 || span.Marker != "" && len(span.Dangling) > 0:
+			b.WriteString(text)
+		case span.Marker == "":
+			b.WriteString(link(span.Sources[0], text))
+		default:
+			for _, source := range span.Sources {
+				b.WriteString(link(source, fmt.Sprintf("[%d]", source.Number)))
+			}
+		}
+	}
+	return b.String()
+}
+
+// ordered returns the citations sorted by offset, without those that
+// overlap an earlier one.
+func (d *Document) ordered() []Citation {
+	citations := append([]Citation(nil), d.Citations...)
+	sort.SliceStable(citations, func(i, j int) bool {
+		return citations[i].Start < citations[j].Start
+	})
+	ordered := citations[:0]
+	last := 0
+	for _, citation := range citations {
+		if citation.Start < last || citation.End > len(d.Text) {
+			continue
+		}
+		ordered = append(ordered, citation)
+		last = citation.End
+	}
+	return ordered
+}
+
+func link(source Source, text string) string {
+	return fmt.Sprintf(`<a href="%s" title="%s">%s</a>`, html.EscapeString(source.URL), html.EscapeString(title(source)), text)
+}
+
+func title(source Source) string {
+	if source.Title != "" {
+		return source.Title
+	}
+	return source.URL
+}
+
+var (
+	markdownEscaper = strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`)
+	urlEscaper      = strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29")
+)
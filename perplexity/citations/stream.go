@@ -0,0 +1,76 @@
+package citations
+
+import (
+	"strings"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity/types"
+)
+
+// Parser finds the citation markers of an answer that arrives in deltas,
+// such as the chunks of a chat stream, where a marker may be split across
+// deltas. A Parser is not safe for concurrent use.
+type Parser struct {
+	text      strings.Builder
+	scanned   int
+	citations []Citation
+	urls      []string
+	results   []types.SearchResult
+}
+
+// NewParser creates a parser for a new answer.
+func NewParser() *Parser {
+	return &Parser{}
+}
+
+// Write appends delta to the answer and returns the markers it completes,
+// with offsets in the whole answer. Text that may be the start of a marker
+// is held back until the next delta or Flush.
+func (p *Parser) Write(delta string) []Citation {
+	p.text.WriteString(delta)
+	citations, scanned := scan(p.text.String(), p.scanned, false)
+	p.scanned = scanned
+	p.citations = append(p.citations, citations...)
+	return citations
+}
+
+// WriteChunk writes the content delta of the first choice of a chat stream
+// chunk, and keeps the latest citation URLs and search results of the
+// stream for Document.
+func (p *Parser) WriteChunk(chunk *types.StreamChunk) []Citation {
+	if chunk == nil {
+		return nil
+	}
+	if len(chunk.Citations) > 0 {
+		p.urls = chunk.Citations
+	}
+	if len(chunk.SearchResults) > 0 {
+		p.results = chunk.SearchResults
+	}
+	for _, choice := range chunk.Choices {
+		if choice.Index == 0 {
+			return p.Write(types.ContentText(choice.Delta.Content))
+		}
+	}
+	return nil
+}
+
+// Flush returns the marker held back at the end of the answer, once no
+// more deltas will arrive.
+func (p *Parser) Flush() []Citation {
+	citations, scanned := scan(p.text.String(), p.scanned, true)
+	p.scanned = scanned
+	p.citations = append(p.citations, citations...)
+	return citations
+}
+
+// Document returns the answer received so far with its markers linked to
+// the citation URLs and search results of the stream.
+func (p *Parser) Document() *Document {
+	text := p.text.String()
+	rest, _ := scan(text, p.scanned, true)
+	return &Document{
+		Text:      text,
+		Citations: append(append([]Citation(nil), p.citations...), rest...),
+		Sources:   sources(p.urls, p.results),
+	}
+}
@@ -3,15 +3,19 @@ package perplexity
 import (
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 
+	"github.com/ZaguanLabs/perplexity-go/perplexity/api"
 	"github.com/ZaguanLabs/perplexity-go/perplexity/asyncchat"
 	"github.com/ZaguanLabs/perplexity-go/perplexity/browser"
 	"github.com/ZaguanLabs/perplexity-go/perplexity/chat"
 	"github.com/ZaguanLabs/perplexity-go/perplexity/contextualizedembeddings"
 	"github.com/ZaguanLabs/perplexity-go/perplexity/embeddings"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/internal/circuit"
 	internalhttp "github.com/ZaguanLabs/perplexity-go/perplexity/internal/http"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/internal/ratelimit"
 	"github.com/ZaguanLabs/perplexity-go/perplexity/responses"
 	"github.com/ZaguanLabs/perplexity-go/perplexity/search"
 )
@@ -32,6 +36,22 @@ func clientErrorFactory(kind internalhttp.ErrorKind, statusCode int, message str
 			msg = fmt.Sprintf("%s: %v", message, cause)
 		}
 		return &ConnectionError{Err: &Error{Message: msg, StatusCode: statusCode, Body: body, RequestID: requestID}}
+	case internalhttp.ErrorKindCircuitOpen:
+		circuitErr := &CircuitOpenError{Err: &Error{Message: message, StatusCode: statusCode, Body: body, RequestID: requestID}}
+		var openErr *circuit.OpenError
+		if errors.As(cause, &openErr) {
+			circuitErr.Endpoint = openErr.Endpoint
+			circuitErr.Model = openErr.Model
+			circuitErr.RetryAfter = openErr.RetryAfter
+		}
+		return circuitErr
+	case internalhttp.ErrorKindStreamStall:
+		stallErr := &StreamStallError{Err: &Error{Message: message, StatusCode: statusCode, Body: body, RequestID: requestID}}
+		var idleErr *internalhttp.StallError
+		if errors.As(cause, &idleErr) {
+			stallErr.IdleTimeout = idleErr.IdleTimeout
+		}
+		return stallErr
 	default:
 		if cause != nil {
 			return fmt.Errorf("perplexity: %s: %w", message, cause)
@@ -49,6 +69,17 @@ type Client struct {
 	defaultHeaders map[string]string
 	defaultQuery   map[string]any
 	userAgent      string
+	middleware     []api.Middleware
+	retryPolicy    api.RetryPolicy
+	rateLimits     map[string]rateLimit
+	circuitBreaker *CircuitBreakerConfig
+	logger         *slog.Logger
+	logBodyLimit   int
+	metrics        api.Metrics
+	tracer         api.Tracer
+	headerInjector api.HeaderInjector
+	timeouts       internalhttp.Timeouts
+	streamResume   int
 
 	// Services
 	Chat                     *chat.Service
@@ -110,6 +141,24 @@ func (c *Client) initServices() {
 		clientErrorFactory,
 	)
 	httpClientWrapper.SetDefaultQuery(c.defaultQuery)
+	httpClientWrapper.SetMiddleware(c.middleware)
+	httpClientWrapper.SetRetryPolicy(c.retryPolicy)
+	if len(c.rateLimits) > 0 {
+		limiter := ratelimit.New()
+		for endpoint, limit := range c.rateLimits {
+			limiter.SetLimit(endpoint, limit.rps, limit.burst)
+		}
+		httpClientWrapper.SetRateLimiter(limiter)
+	}
+	if c.circuitBreaker != nil {
+		httpClientWrapper.SetCircuitBreaker(circuit.New(circuit.Config(*c.circuitBreaker)))
+	}
+	httpClientWrapper.SetLogger(c.logger, c.logBodyLimit)
+	httpClientWrapper.SetMetrics(c.metrics)
+	httpClientWrapper.SetTracer(c.tracer)
+	httpClientWrapper.SetHeaderInjector(c.headerInjector)
+	httpClientWrapper.SetTimeouts(c.timeouts)
+	httpClientWrapper.SetStreamReconnects(c.streamResume)
 
 	c.Chat = chat.NewService(httpClientWrapper)
 	c.Search = search.NewService(httpClientWrapper)
@@ -137,6 +186,17 @@ func (c *Client) Copy(opts ...ClientOption) (*Client, error) {
 		defaultHeaders: cloneStringMap(c.defaultHeaders),
 		defaultQuery:   cloneAnyMap(c.defaultQuery),
 		userAgent:      c.userAgent,
+		middleware:     append([]api.Middleware(nil), c.middleware...),
+		retryPolicy:    c.retryPolicy,
+		rateLimits:     cloneRateLimits(c.rateLimits),
+		circuitBreaker: c.circuitBreaker,
+		logger:         c.logger,
+		logBodyLimit:   c.logBodyLimit,
+		metrics:        c.metrics,
+		tracer:         c.tracer,
+		headerInjector: c.headerInjector,
+		timeouts:       c.timeouts,
+		streamResume:   c.streamResume,
 	}
 	for _, opt := range opts {
 		if err := opt(copyClient); err != nil {
@@ -173,6 +233,17 @@ func cloneAnyMap(input map[string]any) map[string]any {
 	return output
 }
 
+func cloneRateLimits(input map[string]rateLimit) map[string]rateLimit {
+	if input == nil {
+		return nil
+	}
+	output := make(map[string]rateLimit, len(input))
+	for key, value := range input {
+		output[key] = value
+	}
+	return output
+}
+
 // BaseURL returns the base URL being used by the client.
 func (c *Client) BaseURL() string {
 	return c.baseURL
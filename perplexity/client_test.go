@@ -1,9 +1,25 @@
 package perplexity
 
 import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity/api"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/chat"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/embeddings"
+	internalhttp "github.com/ZaguanLabs/perplexity-go/perplexity/internal/http"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/responses"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/search"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/types"
 )
 
 func TestNewClient(t *testing.T) {
@@ -102,6 +118,28 @@ func TestClientOptions(t *testing.T) {
 		}
 	})
 
+	t.Run("WithStreamTimeouts", func(t *testing.T) {
+		client, err := NewClient("test-key",
+			WithConnectTimeout(5*time.Second),
+			WithStreamTimeout(time.Hour),
+			WithStreamIdleTimeout(30*time.Second),
+		)
+		if err != nil {
+			t.Fatalf("NewClient() error = %v", err)
+		}
+
+		want := internalhttp.Timeouts{Connect: 5 * time.Second, Stream: time.Hour, StreamIdle: 30 * time.Second}
+		if client.timeouts != want {
+			t.Errorf("timeouts = %+v, want %+v", client.timeouts, want)
+		}
+		if client.httpClient.Timeout != DefaultTimeout {
+			t.Errorf("httpClient.Timeout = %v, want %v", client.httpClient.Timeout, DefaultTimeout)
+		}
+		if _, err := NewClient("test-key", WithStreamIdleTimeout(-time.Second)); err == nil {
+			t.Error("Expected error for a negative idle timeout")
+		}
+	})
+
 	t.Run("WithMaxRetries", func(t *testing.T) {
 		maxRetries := 5
 		client, err := NewClient("test-key", WithMaxRetries(maxRetries))
@@ -136,6 +174,82 @@ func TestClientOptions(t *testing.T) {
 		}
 	})
 
+	t.Run("WithMiddleware", func(t *testing.T) {
+		noop := func(req *http.Request, info api.RequestInfo, next api.MiddlewareNext) (*http.Response, error) {
+			return next(req)
+		}
+		client, err := NewClient("test-key", WithMiddleware(noop), WithMiddleware(noop, noop))
+		if err != nil {
+			t.Fatalf("NewClient() error = %v", err)
+		}
+
+		if len(client.middleware) != 3 {
+			t.Errorf("len(middleware) = %d, want 3", len(client.middleware))
+		}
+
+		copied, err := client.WithOptions(WithMiddleware(noop))
+		if err != nil {
+			t.Fatalf("WithOptions() error = %v", err)
+		}
+		if len(copied.middleware) != 4 || len(client.middleware) != 3 {
+			t.Errorf("copied middleware = %d, original = %d", len(copied.middleware), len(client.middleware))
+		}
+	})
+
+	t.Run("WithRetryPolicy", func(t *testing.T) {
+		policy := api.DefaultRetryPolicy()
+		client, err := NewClient("test-key", WithRetryPolicy(policy))
+		if err != nil {
+			t.Fatalf("NewClient() error = %v", err)
+		}
+
+		if client.retryPolicy != policy {
+			t.Errorf("retryPolicy = %v, want %v", client.retryPolicy, policy)
+		}
+	})
+
+	t.Run("WithRateLimit", func(t *testing.T) {
+		client, err := NewClient("test-key",
+			WithRateLimit("/chat/completions", 5, 10),
+			WithRateLimit(RateLimitAllEndpoints, 20, 20),
+		)
+		if err != nil {
+			t.Fatalf("NewClient() error = %v", err)
+		}
+
+		if got := client.rateLimits["/chat/completions"]; got.rps != 5 || got.burst != 10 {
+			t.Errorf("rateLimits[/chat/completions] = %+v", got)
+		}
+		if _, ok := client.rateLimits[RateLimitAllEndpoints]; !ok {
+			t.Error("rateLimits missing all-endpoints limit")
+		}
+
+		for _, opt := range []ClientOption{
+			WithRateLimit("", 1, 1),
+			WithRateLimit("/search", 0, 1),
+			WithRateLimit("/search", 1, 0),
+		} {
+			if _, err := NewClient("test-key", opt); err == nil {
+				t.Error("Expected error for invalid rate limit")
+			}
+		}
+	})
+
+	t.Run("WithLogger", func(t *testing.T) {
+		logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+		client, err := NewClient("test-key", WithLogger(logger), WithLogBodies(512))
+		if err != nil {
+			t.Fatalf("NewClient() error = %v", err)
+		}
+		if client.logger != logger || client.logBodyLimit != 512 {
+			t.Errorf("logger = %v, logBodyLimit = %d", client.logger, client.logBodyLimit)
+		}
+
+		if _, err := NewClient("test-key", WithLogBodies(-1)); err == nil {
+			t.Error("Expected error for negative log body limit")
+		}
+	})
+
 	t.Run("multiple options", func(t *testing.T) {
 		customURL := "https://custom.api.com"
 		timeout := 30 * time.Second
@@ -201,6 +315,47 @@ func TestClient_CopyWithOptions(t *testing.T) {
 	}
 }
 
+func TestClient_CircuitBreaker(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client, err := NewClient("test-key",
+		WithBaseURL(server.URL),
+		WithMaxRetries(0),
+		WithCircuitBreaker(CircuitBreakerConfig{MinRequests: 1, OpenTimeout: time.Minute}),
+	)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	params := &chat.CompletionParams{
+		Model:    "sonar",
+		Messages: []types.ChatMessage{types.UserMessage("Hello")},
+	}
+	if _, err := client.Chat.Create(context.Background(), params); err == nil {
+		t.Fatal("Expected error for 503 status")
+	}
+
+	_, err = client.Chat.Create(context.Background(), params)
+	var circuitErr *CircuitOpenError
+	if !errors.As(err, &circuitErr) {
+		t.Fatalf("Create() error = %v, want *CircuitOpenError", err)
+	}
+	if circuitErr.Endpoint != "/chat/completions" || circuitErr.Model != "sonar" || circuitErr.RetryAfter <= 0 {
+		t.Errorf("CircuitOpenError = %+v", circuitErr)
+	}
+	if !IsRetryable(err) {
+		t.Error("IsRetryable() = false for CircuitOpenError")
+	}
+	if attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", attempts)
+	}
+}
+
 func TestClient_Version(t *testing.T) {
 	client, err := NewClient("test-key")
 	if err != nil {
@@ -226,3 +381,156 @@ func TestUserAgent(t *testing.T) {
 		t.Errorf("UserAgent() = %v, want %v", ua, expected)
 	}
 }
+
+type recordingMetrics struct {
+	mu       sync.Mutex
+	requests []api.RequestMetrics
+	usage    []api.UsageMetrics
+}
+
+func (m *recordingMetrics) RecordRequest(ctx context.Context, r api.RequestMetrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = append(m.requests, r)
+}
+
+func (m *recordingMetrics) RecordUsage(ctx context.Context, u api.UsageMetrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.usage = append(m.usage, u)
+}
+
+func TestClient_Metrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case r.URL.Path == "/chat/completions" && strings.Contains(string(body), `"stream":true`):
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, `data: {"id":"1","model":"sonar","choices":[],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2,"cost":{"total_cost":0.01}}}`+"\n\n")
+			io.WriteString(w, `data: {"id":"1","model":"sonar","choices":[],"usage":{"prompt_tokens":1,"completion_tokens":4,"total_tokens":5,"reasoning_tokens":2,"cost":{"total_cost":0.02}}}`+"\n\n")
+			io.WriteString(w, "data: [DONE]\n\n")
+		case r.URL.Path == "/chat/completions":
+			io.WriteString(w, `{"id":"1","model":"sonar","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":4,"total_tokens":7,"num_search_queries":1,"cost":{"input_tokens_cost":0.1,"output_tokens_cost":0.2,"total_cost":0.3}}}`)
+		case r.URL.Path == "/v1/responses":
+			io.WriteString(w, `{"id":"resp","model":"sonar-pro","object":"response","status":"completed","output":[],"usage":{"input_tokens":5,"output_tokens":6,"total_tokens":11,"cost":{"currency":"USD","input_cost":0.1,"output_cost":0.2,"total_cost":0.3}}}`)
+		case r.URL.Path == "/v1/embeddings":
+			io.WriteString(w, `{"data":[],"usage":{"prompt_tokens":8,"total_tokens":8,"cost":{"currency":"USD","total_cost":0.5}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	metrics := &recordingMetrics{}
+	client, err := NewClient("test-key", WithBaseURL(server.URL), WithMetrics(metrics))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	ctx := context.Background()
+	params := &chat.CompletionParams{Model: "sonar", Messages: []types.ChatMessage{types.UserMessage("Hello")}}
+
+	if _, err := client.Chat.Create(ctx, params); err != nil {
+		t.Fatalf("Chat.Create() error = %v", err)
+	}
+	stream, err := client.Chat.CreateStream(ctx, params)
+	if err != nil {
+		t.Fatalf("Chat.CreateStream() error = %v", err)
+	}
+	for {
+		if _, err := stream.Next(); err != nil {
+			break
+		}
+	}
+	stream.Close()
+	if _, err := client.Responses.Create(ctx, &responses.CreateParams{Input: responses.Input{Text: types.String("hi")}}); err != nil {
+		t.Fatalf("Responses.Create() error = %v", err)
+	}
+	if _, err := client.Embeddings.Create(ctx, &embeddings.CreateParams{Model: embeddings.ModelEmbedV14B, Input: embeddings.Input{Text: types.String("hi")}}); err != nil {
+		t.Fatalf("Embeddings.Create() error = %v", err)
+	}
+
+	if len(metrics.requests) != 4 {
+		t.Fatalf("Expected 4 request metrics, got %d", len(metrics.requests))
+	}
+	if !metrics.requests[1].Stream || metrics.requests[1].TimeToFirstByte <= 0 {
+		t.Errorf("stream RequestMetrics = %+v", metrics.requests[1])
+	}
+
+	if len(metrics.usage) != 4 {
+		t.Fatalf("Expected 4 usage metrics, got %d", len(metrics.usage))
+	}
+	want := []api.UsageMetrics{
+		{Operation: "chat.create", Model: "sonar", InputTokens: 3, OutputTokens: 4, TotalTokens: 7, SearchQueries: 1, InputCost: 0.1, OutputCost: 0.2, TotalCost: 0.3},
+		{Operation: "chat.create_stream", Model: "sonar", InputTokens: 1, OutputTokens: 4, TotalTokens: 5, ReasoningTokens: 2, TotalCost: 0.02},
+		{Operation: "responses.create", Model: "sonar-pro", InputTokens: 5, OutputTokens: 6, TotalTokens: 11, InputCost: 0.1, OutputCost: 0.2, TotalCost: 0.3, Currency: "USD"},
+		{Operation: "embeddings.create", Model: "pplx-embed-v1-4b", InputTokens: 8, TotalTokens: 8, TotalCost: 0.5, Currency: "USD"},
+	}
+	for i, got := range metrics.usage {
+		if got.Raw == nil {
+			t.Errorf("usage[%d].Raw is nil", i)
+		}
+		got.Raw = nil
+		if got != want[i] {
+			t.Errorf("usage[%d] = %+v, want %+v", i, got, want[i])
+		}
+	}
+}
+
+type testSpan struct {
+	name  string
+	attrs map[string]any
+	ended bool
+}
+
+func (s *testSpan) SetAttributes(attrs ...api.Attribute) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *testSpan) End(err error) { s.ended = true }
+
+type testTracer struct{ spans []*testSpan }
+
+func (tr *testTracer) StartSpan(ctx context.Context, name string, attrs ...api.Attribute) (context.Context, api.Span) {
+	span := &testSpan{name: name, attrs: map[string]any{}}
+	span.SetAttributes(attrs...)
+	tr.spans = append(tr.spans, span)
+	return ctx, span
+}
+
+func TestClient_Tracing(t *testing.T) {
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		io.WriteString(w, `{"id":"s","results":[]}`)
+	}))
+	defer server.Close()
+
+	tracer := &testTracer{}
+	client, err := NewClient("test-key",
+		WithBaseURL(server.URL),
+		WithTracer(tracer),
+		WithHeaderInjector(func(ctx context.Context, header http.Header) {
+			header.Set("traceparent", "00-trace-span-01")
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	params := &search.SearchParams{}
+	params.QueryString("golang")
+	if _, err := client.Search.Create(context.Background(), params); err != nil {
+		t.Fatalf("Search.Create() error = %v", err)
+	}
+	if len(tracer.spans) != 2 || tracer.spans[0].name != "search.create" || tracer.spans[1].name != "search.create.attempt" {
+		t.Fatalf("spans = %+v", tracer.spans)
+	}
+	if !tracer.spans[0].ended || tracer.spans[0].attrs[api.AttrStatusCode] != 200 {
+		t.Errorf("call span = %+v", tracer.spans[0])
+	}
+	if traceparent != "00-trace-span-01" {
+		t.Errorf("traceparent = %q", traceparent)
+	}
+}
@@ -1,8 +1,13 @@
 package perplexity
 
 import (
+	"errors"
+	"log/slog"
 	"net/http"
 	"time"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity/api"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/internal/ratelimit"
 )
 
 const (
@@ -21,6 +26,15 @@ var (
 	DefaultUserAgent = UserAgent()
 )
 
+// RateLimitAllEndpoints is the endpoint passed to WithRateLimit to limit every
+// endpoint that has no more specific limit.
+const RateLimitAllEndpoints = ratelimit.AllEndpoints
+
+type rateLimit struct {
+	rps   float64
+	burst int
+}
+
 // ClientOption is a functional option for configuring the Client.
 type ClientOption func(*Client) error
 
@@ -48,7 +62,94 @@ func WithMaxRetries(retries int) ClientOption {
 	}
 }
 
-// WithTimeout sets the request timeout.
+// WithRetryPolicy sets the policy that decides whether failed requests are
+// retried and how long to wait between attempts. The number of retries is
+// still capped by WithMaxRetries. Use api.WithRetryPolicy to override the
+// policy for a single request.
+func WithRetryPolicy(policy api.RetryPolicy) ClientOption {
+	return func(c *Client) error {
+		c.retryPolicy = policy
+		return nil
+	}
+}
+
+// WithRateLimit throttles requests to an endpoint with a token bucket that
+// allows rps requests per second and bursts of up to burst requests. The
+// endpoint is an API path such as "/chat/completions" and also covers its
+// sub-paths; RateLimitAllEndpoints covers every other path. Requests wait for
+// a token before each attempt, including retries.
+//
+// The bucket learns the server's limit from the rate limit headers of its
+// responses: the rate and burst follow the advertised requests per window,
+// with rps and burst as upper bounds. It spends down to the remaining-requests
+// header and pauses until the advertised reset time when none remain or after
+// a 429 response. Endpoints without a rate limit ignore the headers.
+//
+// Each client and each copy made with Copy or WithOptions keeps its own rate
+// limit state.
+func WithRateLimit(endpoint string, rps float64, burst int) ClientOption {
+	return func(c *Client) error {
+		if endpoint == "" {
+			return errors.New("rate limit endpoint cannot be empty")
+		}
+		if rps <= 0 {
+			return errors.New("rate limit rps must be positive")
+		}
+		if burst < 1 {
+			return errors.New("rate limit burst must be at least 1")
+		}
+		if c.rateLimits == nil {
+			c.rateLimits = make(map[string]rateLimit)
+		}
+		c.rateLimits[endpoint] = rateLimit{rps: rps, burst: burst}
+		return nil
+	}
+}
+
+// CircuitBreakerConfig configures the circuit breaker enabled by
+// WithCircuitBreaker. Zero fields use the defaults documented on each field.
+type CircuitBreakerConfig struct {
+	// FailureRatio is the fraction of failed requests in a window that opens
+	// the circuit. Defaults to 0.5.
+	FailureRatio float64
+
+	// MinRequests is the number of requests a window needs before the failure
+	// ratio is evaluated. Defaults to 10.
+	MinRequests int
+
+	// Window is the length of the window over which failures are counted.
+	// Defaults to one minute.
+	Window time.Duration
+
+	// OpenTimeout is how long the circuit stays open before allowing probe
+	// requests. Defaults to 30 seconds.
+	OpenTimeout time.Duration
+
+	// HalfOpenRequests is the number of probe requests allowed while half-open.
+	// The circuit closes once that many probes succeed. Defaults to 1.
+	HalfOpenRequests int
+}
+
+// WithCircuitBreaker enables a circuit breaker for each endpoint and model.
+// Server errors, timeouts, and connection failures count as failures. Once the
+// failure ratio is reached the circuit opens and requests fail immediately with
+// a *CircuitOpenError, without contacting the API or retrying, until the open
+// timeout elapses and a probe request succeeds.
+//
+// Each client and each copy made with Copy or WithOptions keeps its own
+// circuit state.
+func WithCircuitBreaker(config CircuitBreakerConfig) ClientOption {
+	return func(c *Client) error {
+		if config.FailureRatio > 1 {
+			return errors.New("circuit breaker failure ratio cannot exceed 1")
+		}
+		c.circuitBreaker = &config
+		return nil
+	}
+}
+
+// WithTimeout sets the total timeout of non-streaming requests. Streams use
+// it as their total duration unless WithStreamTimeout is set.
 func WithTimeout(timeout time.Duration) ClientOption {
 	return func(c *Client) error {
 		if c.httpClient == nil {
@@ -62,6 +163,57 @@ func WithTimeout(timeout time.Duration) ClientOption {
 	}
 }
 
+// WithConnectTimeout limits the time from sending each attempt until its
+// response headers arrive, including connection setup. Attempts that time
+// out are retried and reported as TimeoutError.
+func WithConnectTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) error {
+		if timeout < 0 {
+			return errors.New("connect timeout cannot be negative")
+		}
+		c.timeouts.Connect = timeout
+		return nil
+	}
+}
+
+// WithStreamTimeout limits the total duration of streams, independently of
+// the timeout of non-streaming requests.
+func WithStreamTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) error {
+		if timeout < 0 {
+			return errors.New("stream timeout cannot be negative")
+		}
+		c.timeouts.Stream = timeout
+		return nil
+	}
+}
+
+// WithStreamIdleTimeout aborts streams that receive no data for the given
+// duration. The stream then returns a StreamStallError.
+func WithStreamIdleTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) error {
+		if timeout < 0 {
+			return errors.New("stream idle timeout cannot be negative")
+		}
+		c.timeouts.StreamIdle = timeout
+		return nil
+	}
+}
+
+// WithStreamResume makes chat and responses streams reconnect up to
+// maxReconnects times after a dropped connection or stall. The stream sends
+// Last-Event-ID, waits for the server's retry delay, and skips events it has
+// already returned, by event ID or, for responses, by sequence number.
+func WithStreamResume(maxReconnects int) ClientOption {
+	return func(c *Client) error {
+		if maxReconnects < 0 {
+			return errors.New("stream reconnects cannot be negative")
+		}
+		c.streamResume = maxReconnects
+		return nil
+	}
+}
+
 // WithDefaultHeader adds a default header to all requests.
 func WithDefaultHeader(key, value string) ClientOption {
 	return func(c *Client) error {
@@ -106,3 +258,63 @@ func WithDefaultQueryParams(query map[string]any) ClientOption {
 		return nil
 	}
 }
+
+// WithMiddleware appends middleware that wraps every HTTP attempt made by the
+// client, including retries and streaming requests. Middleware is applied in
+// the order given, with the first middleware being the outermost.
+func WithMiddleware(middleware ...api.Middleware) ClientOption {
+	return func(c *Client) error {
+		c.middleware = append(c.middleware, middleware...)
+		return nil
+	}
+}
+
+// WithLogger sets a structured logger for request attempts, retries and stream
+// lifecycle events. Events are logged at debug level and never include the API
+// key or credential headers.
+func WithLogger(logger *slog.Logger) ClientOption {
+	return func(c *Client) error {
+		c.logger = logger
+		return nil
+	}
+}
+
+// WithLogBodies includes request headers and request and response bodies in
+// log events, truncated to maxBytes. It has no effect without WithLogger.
+func WithLogBodies(maxBytes int) ClientOption {
+	return func(c *Client) error {
+		if maxBytes < 0 {
+			return errors.New("log body limit cannot be negative")
+		}
+		c.logBodyLimit = maxBytes
+		return nil
+	}
+}
+
+// WithMetrics sets a sink for request durations, attempt counts, status
+// classes, stream time to first byte, and token usage and cost.
+func WithMetrics(metrics api.Metrics) ClientOption {
+	return func(c *Client) error {
+		c.metrics = metrics
+		return nil
+	}
+}
+
+// WithTracer sets a tracer that receives one span per service call and a child
+// span per HTTP attempt, with the model, request ID, status, retry reason and
+// token usage as attributes.
+func WithTracer(tracer api.Tracer) ClientOption {
+	return func(c *Client) error {
+		c.tracer = tracer
+		return nil
+	}
+}
+
+// WithHeaderInjector sets a function that propagates trace context to every
+// outgoing HTTP attempt.
+func WithHeaderInjector(injector api.HeaderInjector) ClientOption {
+	return func(c *Client) error {
+		c.headerInjector = injector
+		return nil
+	}
+}
@@ -59,10 +59,12 @@ func (s *Service) createWithResponse(ctx context.Context, params *CreateParams,
 	}
 
 	req := &internalhttp.Request{
-		Method:  http.MethodPost,
-		Path:    "/v1/contextualizedembeddings",
-		Body:    params,
-		Options: api.ApplyRequestOptions(opts),
+		Operation: "contextualizedembeddings.create",
+		Method:    http.MethodPost,
+		Path:      "/v1/contextualizedembeddings",
+		Body:      params,
+		Options:   api.ApplyRequestOptions(opts),
+		Usage:     parseUsage,
 	}
 
 	resp, err := s.client.Do(ctx, req)
@@ -77,3 +79,37 @@ func (s *Service) createWithResponse(ctx context.Context, params *CreateParams,
 
 	return &result, resp, nil
 }
+
+// parseUsage extracts usage from an embeddings response body.
+func parseUsage(body []byte) *api.UsageMetrics {
+	var result struct {
+		Model *string `json:"model"`
+		Usage *Usage  `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || result.Usage == nil {
+		return nil
+	}
+	metrics := api.UsageMetrics{Raw: result.Usage}
+	if result.Model != nil {
+		metrics.Model = *result.Model
+	}
+	usage := result.Usage
+	if usage.PromptTokens != nil {
+		metrics.InputTokens = *usage.PromptTokens
+	}
+	if usage.TotalTokens != nil {
+		metrics.TotalTokens = *usage.TotalTokens
+	}
+	if usage.Cost != nil {
+		if usage.Cost.InputCost != nil {
+			metrics.InputCost = *usage.Cost.InputCost
+		}
+		if usage.Cost.TotalCost != nil {
+			metrics.TotalCost = *usage.Cost.TotalCost
+		}
+		if usage.Cost.Currency != nil {
+			metrics.Currency = string(*usage.Cost.Currency)
+		}
+	}
+	return &metrics
+}
@@ -2,8 +2,10 @@ package perplexity
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 // Error is the base error type for all Perplexity API errors.
@@ -102,6 +104,40 @@ type TimeoutError struct {
 func (e *TimeoutError) Error() string { return e.Err.Error() }
 func (e *TimeoutError) Unwrap() error { return e.Err }
 
+// CircuitOpenError is returned without contacting the API while the circuit
+// breaker for an endpoint and model is open. See WithCircuitBreaker.
+type CircuitOpenError struct {
+	Err *Error
+
+	// Endpoint is the API path of the rejected request.
+	Endpoint string
+
+	// Model is the model of the rejected request, if any.
+	Model string
+
+	// RetryAfter is how long until the breaker lets probe requests through, or
+	// zero if it is already probing.
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string { return e.Err.Error() }
+func (e *CircuitOpenError) Unwrap() error { return e.Err }
+
+// StreamStallError is returned by a stream that received no data for longer
+// than its idle timeout. See WithStreamIdleTimeout. It is a timeout net.Error,
+// so resumable streams reconnect after a stall.
+type StreamStallError struct {
+	Err *Error
+
+	// IdleTimeout is the idle timeout that was exceeded.
+	IdleTimeout time.Duration
+}
+
+func (e *StreamStallError) Error() string   { return e.Err.Error() }
+func (e *StreamStallError) Unwrap() error   { return e.Err }
+func (e *StreamStallError) Timeout() bool   { return true }
+func (e *StreamStallError) Temporary() bool { return true }
+
 // ValidationError represents a client-side validation error.
 type ValidationError struct {
 	Err *Error
@@ -143,13 +179,15 @@ func newError(statusCode int, message string, body []byte, requestID string) err
 }
 
 // IsRetryable returns true if the error is retryable.
+// Errors wrapped by the service methods are unwrapped before checking.
 func IsRetryable(err error) bool {
-	switch err.(type) {
-	case *RateLimitError, *InternalServerError, *ConflictError, *TimeoutError, *ConnectionError:
-		return true
-	default:
-		return false
+	for ; err != nil; err = errors.Unwrap(err) {
+		switch err.(type) {
+		case *RateLimitError, *InternalServerError, *ConflictError, *TimeoutError, *ConnectionError, *CircuitOpenError, *StreamStallError:
+			return true
+		}
 	}
+	return false
 }
 
 // IsRateLimitError returns true if the error is a rate limit error.
@@ -169,3 +207,10 @@ func IsTimeoutError(err error) bool {
 	_, ok := err.(*TimeoutError)
 	return ok
 }
+
+// IsStreamStallError returns true if the error is, or wraps, a stream stall
+// error.
+func IsStreamStallError(err error) bool {
+	var stallErr *StreamStallError
+	return errors.As(err, &stallErr)
+}
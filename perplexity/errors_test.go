@@ -1,6 +1,7 @@
 package perplexity
 
 import (
+	"fmt"
 	"net/http"
 	"reflect"
 	"testing"
@@ -124,6 +125,21 @@ func TestIsRetryable(t *testing.T) {
 			err:  &ConnectionError{Err: &Error{Message: "connection failed"}},
 			want: true,
 		},
+		{
+			name: "circuit open error",
+			err:  &CircuitOpenError{Err: &Error{Message: "circuit open"}},
+			want: true,
+		},
+		{
+			name: "stream stall error",
+			err:  &StreamStallError{Err: &Error{Message: "stream stalled"}},
+			want: true,
+		},
+		{
+			name: "wrapped rate limit error",
+			err:  fmt.Errorf("request failed: %w", &RateLimitError{Err: &Error{Message: "rate limit"}}),
+			want: true,
+		},
 		{
 			name: "bad request error",
 			err:  &BadRequestError{Err: &Error{Message: "bad request"}},
@@ -0,0 +1,232 @@
+package circuit
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// State is the state of a circuit.
+type State int
+
+const (
+	// StateClosed lets requests through and tracks their failure rate.
+	StateClosed State = iota
+
+	// StateOpen rejects requests until the open timeout elapses.
+	StateOpen
+
+	// StateHalfOpen lets a limited number of probe requests through.
+	StateHalfOpen
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// Config configures a Breaker. Zero fields use the defaults documented on
+// each field.
+type Config struct {
+	// FailureRatio is the fraction of failed requests in a window that opens
+	// the circuit. Defaults to 0.5.
+	FailureRatio float64
+
+	// MinRequests is the number of requests a window needs before the failure
+	// ratio is evaluated. Defaults to 10.
+	MinRequests int
+
+	// Window is the length of the window over which failures are counted.
+	// Defaults to one minute.
+	Window time.Duration
+
+	// OpenTimeout is how long the circuit stays open before allowing probe
+	// requests. Defaults to 30 seconds.
+	OpenTimeout time.Duration
+
+	// HalfOpenRequests is the number of probe requests allowed while half-open.
+	// The circuit closes once that many probes succeed. Defaults to 1.
+	HalfOpenRequests int
+}
+
+func (c Config) withDefaults() Config {
+	if c.FailureRatio <= 0 {
+		c.FailureRatio = 0.5
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = 10
+	}
+	if c.Window <= 0 {
+		c.Window = time.Minute
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = 30 * time.Second
+	}
+	if c.HalfOpenRequests <= 0 {
+		c.HalfOpenRequests = 1
+	}
+	return c
+}
+
+// OpenError is returned by Allow while a circuit is open.
+type OpenError struct {
+	// Endpoint is the API path of the rejected request.
+	Endpoint string
+
+	// Model is the model of the rejected request, if any.
+	Model string
+
+	// RetryAfter is how long until the circuit allows probe requests again.
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface.
+func (e *OpenError) Error() string {
+	target := e.Endpoint
+	if e.Model != "" {
+		target += " (model " + e.Model + ")"
+	}
+	return fmt.Sprintf("circuit open for %s, retry after %s", target, e.RetryAfter)
+}
+
+// Breaker keeps one circuit per endpoint and model.
+// It is safe for concurrent use.
+type Breaker struct {
+	config   Config
+	mu       sync.Mutex
+	circuits map[key]*circuit
+	now      func() time.Time
+}
+
+type key struct {
+	endpoint string
+	model    string
+}
+
+type circuit struct {
+	state       State
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int
+	successes   int
+}
+
+// New creates a breaker with the given configuration.
+func New(config Config) *Breaker {
+	return &Breaker{
+		config:   config.withDefaults(),
+		circuits: make(map[key]*circuit),
+		now:      time.Now,
+	}
+}
+
+// Allow reports whether a request to endpoint and model may be sent. It
+// returns an *OpenError when the circuit is open or has no probe slots left.
+func (b *Breaker) Allow(endpoint, model string) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	c := b.circuit(endpoint, model)
+	switch c.state {
+	case StateOpen:
+		reopen := c.openedAt.Add(b.config.OpenTimeout)
+		if now.Before(reopen) {
+			return &OpenError{Endpoint: endpoint, Model: model, RetryAfter: reopen.Sub(now)}
+		}
+		c.state = StateHalfOpen
+		c.probes = 0
+		c.successes = 0
+		fallthrough
+	case StateHalfOpen:
+		if c.probes >= b.config.HalfOpenRequests {
+			return &OpenError{Endpoint: endpoint, Model: model}
+		}
+		c.probes++
+	}
+	return nil
+}
+
+// Record reports the outcome of a request that Allow let through.
+func (b *Breaker) Record(endpoint, model string, failed bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	c := b.circuit(endpoint, model)
+	switch c.state {
+	case StateClosed:
+		if now.Sub(c.windowStart) >= b.config.Window {
+			c.windowStart = now
+			c.requests = 0
+			c.failures = 0
+		}
+		c.requests++
+		if failed {
+			c.failures++
+		}
+		if c.requests >= b.config.MinRequests && float64(c.failures)/float64(c.requests) >= b.config.FailureRatio {
+			c.state = StateOpen
+			c.openedAt = now
+		}
+	case StateHalfOpen:
+		if failed {
+			c.state = StateOpen
+			c.openedAt = now
+			return
+		}
+		c.successes++
+		if c.successes >= b.config.HalfOpenRequests {
+			*c = circuit{state: StateClosed, windowStart: now}
+		}
+	}
+}
+
+// Release gives back the slot taken by Allow for a request that was abandoned
+// before an outcome was known, for example because its context was canceled.
+func (b *Breaker) Release(endpoint, model string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuit(endpoint, model)
+	if c.state == StateHalfOpen && c.probes > 0 {
+		c.probes--
+	}
+}
+
+// State returns the current state of the circuit for endpoint and model.
+func (b *Breaker) State(endpoint, model string) State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.circuit(endpoint, model).state
+}
+
+func (b *Breaker) circuit(endpoint, model string) *circuit {
+	k := key{endpoint: endpoint, model: model}
+	c, ok := b.circuits[k]
+	if !ok {
+		c = &circuit{state: StateClosed, windowStart: b.now()}
+		b.circuits[k] = c
+	}
+	return c
+}
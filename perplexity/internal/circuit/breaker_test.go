@@ -0,0 +1,105 @@
+package circuit
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestBreaker(config Config) (*Breaker, *time.Time) {
+	now := time.Unix(1700000000, 0)
+	breaker := New(config)
+	breaker.now = func() time.Time { return now }
+	return breaker, &now
+}
+
+func TestBreaker_Opens(t *testing.T) {
+	breaker, _ := newTestBreaker(Config{MinRequests: 4, FailureRatio: 0.5})
+
+	for i := 0; i < 3; i++ {
+		if err := breaker.Allow("/chat/completions", "sonar"); err != nil {
+			t.Fatalf("Allow() error = %v", err)
+		}
+		breaker.Record("/chat/completions", "sonar", i > 0)
+	}
+	if got := breaker.State("/chat/completions", "sonar"); got != StateClosed {
+		t.Fatalf("State() = %v, want closed below MinRequests", got)
+	}
+
+	breaker.Record("/chat/completions", "sonar", false)
+	if got := breaker.State("/chat/completions", "sonar"); got != StateOpen {
+		t.Fatalf("State() = %v, want open", got)
+	}
+
+	err := breaker.Allow("/chat/completions", "sonar")
+	var openErr *OpenError
+	if !errors.As(err, &openErr) {
+		t.Fatalf("Allow() error = %v, want *OpenError", err)
+	}
+	if openErr.RetryAfter != 30*time.Second || openErr.Model != "sonar" {
+		t.Errorf("OpenError = %+v", openErr)
+	}
+
+	if err := breaker.Allow("/chat/completions", "sonar-pro"); err != nil {
+		t.Errorf("Allow() for another model error = %v", err)
+	}
+}
+
+func TestBreaker_HalfOpen(t *testing.T) {
+	breaker, now := newTestBreaker(Config{MinRequests: 1, OpenTimeout: time.Second})
+
+	breaker.Record("/search", "", true)
+	if err := breaker.Allow("/search", ""); err == nil {
+		t.Fatal("Expected open circuit")
+	}
+
+	*now = now.Add(time.Second)
+	if err := breaker.Allow("/search", ""); err != nil {
+		t.Fatalf("probe Allow() error = %v", err)
+	}
+	if got := breaker.State("/search", ""); got != StateHalfOpen {
+		t.Fatalf("State() = %v, want half-open", got)
+	}
+	if err := breaker.Allow("/search", ""); err == nil {
+		t.Fatal("Expected second probe to be rejected")
+	}
+
+	breaker.Record("/search", "", true)
+	if got := breaker.State("/search", ""); got != StateOpen {
+		t.Fatalf("State() = %v, want open after failed probe", got)
+	}
+
+	*now = now.Add(time.Second)
+	if err := breaker.Allow("/search", ""); err != nil {
+		t.Fatalf("probe Allow() error = %v", err)
+	}
+	breaker.Record("/search", "", false)
+	if got := breaker.State("/search", ""); got != StateClosed {
+		t.Fatalf("State() = %v, want closed after successful probe", got)
+	}
+}
+
+func TestBreaker_Release(t *testing.T) {
+	breaker, now := newTestBreaker(Config{MinRequests: 1, OpenTimeout: time.Second})
+
+	breaker.Record("/search", "", true)
+	*now = now.Add(time.Second)
+	if err := breaker.Allow("/search", ""); err != nil {
+		t.Fatalf("probe Allow() error = %v", err)
+	}
+	breaker.Release("/search", "")
+	if err := breaker.Allow("/search", ""); err != nil {
+		t.Errorf("Allow() after Release error = %v", err)
+	}
+}
+
+func TestBreaker_Window(t *testing.T) {
+	breaker, now := newTestBreaker(Config{MinRequests: 2, Window: time.Minute})
+
+	breaker.Record("/search", "", true)
+	*now = now.Add(time.Minute)
+	breaker.Record("/search", "", false)
+	if got := breaker.State("/search", ""); got != StateClosed {
+		t.Errorf("State() = %v, want closed after window reset", got)
+	}
+}
@@ -3,52 +3,68 @@ package http
 import (
 	"bytes"
 	"context"
-	"crypto/rand"
-	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"math"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/url"
 	"reflect"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/ZaguanLabs/perplexity-go/perplexity/api"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/internal/circuit"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/internal/ratelimit"
 )
 
 const (
 	// InitialRetryDelay is the initial delay for exponential backoff.
-	InitialRetryDelay = 500 * time.Millisecond
+	InitialRetryDelay = api.DefaultRetryInitialDelay
 
 	// MaxRetryDelay is the maximum delay between retries.
-	MaxRetryDelay = 8 * time.Second
+	MaxRetryDelay = api.DefaultRetryMaxDelay
 )
 
+// defaultRetryPolicy is used when neither the client nor the request
+// configures a retry policy.
+var defaultRetryPolicy = api.DefaultRetryPolicy()
+
 type ErrorKind int
 
 const (
 	ErrorKindStatus ErrorKind = iota
 	ErrorKindConnection
 	ErrorKindTimeout
+	ErrorKindCircuitOpen
+	ErrorKindStreamStall
 )
 
 type ErrorFactory func(kind ErrorKind, statusCode int, message string, body []byte, requestID string, cause error) error
 
 // Client wraps an HTTP client with retry logic and error handling.
 type Client struct {
-	httpClient     *http.Client
-	baseURL        string
-	apiKey         string
-	maxRetries     int
-	defaultHeaders map[string]string
-	defaultQuery   map[string]any
-	userAgent      string
-	errorFactory   ErrorFactory
+	httpClient       *http.Client
+	baseURL          string
+	apiKey           string
+	maxRetries       int
+	defaultHeaders   map[string]string
+	defaultQuery     map[string]any
+	userAgent        string
+	errorFactory     ErrorFactory
+	middleware       []api.Middleware
+	retryPolicy      api.RetryPolicy
+	rateLimiter      *ratelimit.Limiter
+	circuitBreaker   *circuit.Breaker
+	logger           *slog.Logger
+	logBodyLimit     int
+	metrics          api.Metrics
+	tracer           api.Tracer
+	headerInjector   api.HeaderInjector
+	timeouts         Timeouts
+	streamReconnects int
 }
 
 // NewClient creates a new HTTP client wrapper.
@@ -68,14 +84,44 @@ func (c *Client) SetDefaultQuery(defaultQuery map[string]any) {
 	c.defaultQuery = defaultQuery
 }
 
+// SetMiddleware sets the middleware chain applied to every attempt.
+// The first middleware is the outermost one.
+func (c *Client) SetMiddleware(middleware []api.Middleware) {
+	c.middleware = middleware
+}
+
+// SetRetryPolicy sets the retry policy used for requests that do not
+// override it. A nil policy restores the default policy.
+func (c *Client) SetRetryPolicy(policy api.RetryPolicy) {
+	c.retryPolicy = policy
+}
+
+// SetRateLimiter sets the limiter that throttles attempts before they are
+// sent. A nil limiter disables client-side rate limiting.
+func (c *Client) SetRateLimiter(limiter *ratelimit.Limiter) {
+	c.rateLimiter = limiter
+}
+
+// SetCircuitBreaker sets the breaker that rejects attempts to failing
+// endpoints. A nil breaker disables circuit breaking.
+func (c *Client) SetCircuitBreaker(breaker *circuit.Breaker) {
+	c.circuitBreaker = breaker
+}
+
 // Request represents an HTTP request.
 type Request struct {
-	Method  string
-	Path    string
-	Headers map[string]string
-	Query   map[string]any
-	Body    interface{}
-	Options api.RequestOptions
+	// Operation is the logical operation name reported to middleware.
+	Operation string
+	Method    string
+	Path      string
+	Headers   map[string]string
+	Query     map[string]any
+	Body      interface{}
+	Options   api.RequestOptions
+
+	// Usage extracts token usage from a successful response body. It is only
+	// called when metrics or tracing are enabled.
+	Usage func(body []byte) *api.UsageMetrics
 }
 
 // Response represents an HTTP response.
@@ -92,14 +138,35 @@ type StreamResponse struct {
 	Headers    http.Header
 	Response   *http.Response
 	RequestID  string
+
+	call *call
 }
 
 // Do executes an HTTP request with retry logic.
 func (c *Client) Do(ctx context.Context, req *Request) (*Response, error) {
+	body, err := c.prepareBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	retries := c.newRetryState(req)
+	ctx, call := c.startCall(ctx, req, body, retries, false)
+	resp, err := c.do(ctx, req, body, call)
+	if err == nil && req.Usage != nil && call.observed() {
+		if usage := req.Usage(resp.Body); usage != nil {
+			call.recordUsage(*usage)
+		}
+	}
+	call.finish(err, 0)
+	return resp, err
+}
+
+func (c *Client) do(ctx context.Context, req *Request, body *preparedBody, call *call) (*Response, error) {
+	retries := call.retries
 	var lastErr error
 	var retryDelay time.Duration
 
-	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+	for attempt := 0; attempt <= retries.maxRetries; attempt++ {
 		if attempt > 0 {
 			select {
 			case <-time.After(retryDelay):
@@ -109,26 +176,44 @@ func (c *Client) Do(ctx context.Context, req *Request) (*Response, error) {
 			}
 		}
 
-		resp, err := c.doRequest(ctx, req)
+		if err := c.beginAttempt(ctx, call); err != nil {
+			return nil, err
+		}
+
+		attemptCtx, span := c.startAttempt(ctx, req, attempt+1, retries.reason)
+		resp, err := c.doRequest(attemptCtx, req, body, attempt+1)
+		retries.observe(attempt+1, statusCodeOf(resp), requestIDOf(resp))
+		endAttemptSpan(span, statusCodeOf(resp), requestIDOf(resp), err)
+		c.endAttempt(ctx, call, statusCodeOf(resp), err)
 		if err != nil {
 			lastErr = c.wrapTransportError(err)
-			if !c.shouldRetryError(err) {
+			// The final attempt is not retried, so the policy is not asked.
+			if attempt == retries.maxRetries {
+				break
+			}
+			delay, retry := retries.next(attempt+1, nil, err)
+			if !retry {
 				return nil, lastErr
 			}
-			retryDelay = c.calculateBackoff(attempt+1, nil)
+			c.logRetry(ctx, req, attempt+1, delay, 0, err)
+			retryDelay = delay
 			continue
 		}
 
-		if c.shouldRetryResponse(resp) {
+		if resp.StatusCode >= 400 {
 			lastErr = c.errorFromResponse(resp)
-			retryDelay = c.calculateBackoff(attempt+1, resp.Headers)
+			if attempt == retries.maxRetries {
+				break
+			}
+			delay, retry := retries.next(attempt+1, resp, nil)
+			if !retry {
+				return nil, lastErr
+			}
+			c.logRetry(ctx, req, attempt+1, delay, resp.StatusCode, nil)
+			retryDelay = delay
 			continue
 		}
 
-		if resp.StatusCode >= 400 {
-			return nil, c.errorFromResponse(resp)
-		}
-
 		return resp, nil
 	}
 
@@ -139,41 +224,214 @@ func (c *Client) Do(ctx context.Context, req *Request) (*Response, error) {
 	return nil, fmt.Errorf("max retries exceeded")
 }
 
-// doRequest performs a single HTTP request.
-func (c *Client) doRequest(ctx context.Context, req *Request) (*Response, error) {
+// retryState tracks the retry decisions made across the attempts of a request.
+type retryState struct {
+	req        *Request
+	policy     api.RetryPolicy
+	maxRetries int
+	start      time.Time
+	attempts   int
+	statusCode int
+	requestID  string
+	reason     string
+}
+
+func (c *Client) newRetryState(req *Request) *retryState {
+	state := &retryState{
+		req:        req,
+		policy:     c.retryPolicy,
+		maxRetries: c.maxRetries,
+		start:      time.Now(),
+	}
+	if req.Options.RetryPolicy != nil {
+		state.policy = req.Options.RetryPolicy
+	}
+	if state.policy == nil {
+		state.policy = defaultRetryPolicy
+	}
+	if req.Options.MaxRetries != nil {
+		state.maxRetries = *req.Options.MaxRetries
+	}
+	return state
+}
+
+// observe records the outcome of the latest attempt.
+func (s *retryState) observe(attempt, statusCode int, requestID string) {
+	s.attempts = attempt
+	s.statusCode = statusCode
+	s.requestID = requestID
+}
+
+// next consults the retry policy about a failed attempt and returns the delay
+// before the next attempt and whether to retry at all.
+func (s *retryState) next(attempt int, resp *Response, err error) (time.Duration, bool) {
+	info := api.RetryInfo{
+		Operation:  s.req.Operation,
+		Method:     s.req.Method,
+		Path:       s.req.Path,
+		Attempt:    attempt,
+		MaxRetries: s.maxRetries,
+		Elapsed:    time.Since(s.start),
+		Err:        err,
+	}
+	if resp != nil {
+		info.StatusCode = resp.StatusCode
+		info.Headers = resp.Headers
+		info.Body = resp.Body
+	}
+	retry, delay := decideRetry(s.policy, info)
+	if !retry {
+		return 0, false
+	}
+	s.reason = retryReason(resp, err)
+	return delay, true
+}
+
+// decideRetry asks policy whether to retry and for the delay, in one call
+// when the policy supports it.
+func decideRetry(policy api.RetryPolicy, info api.RetryInfo) (bool, time.Duration) {
+	if decider, ok := policy.(api.RetryDecider); ok {
+		return decider.RetryDecision(info)
+	}
+	if !policy.ShouldRetry(info) {
+		return false, 0
+	}
+	return true, policy.RetryDelay(info)
+}
+
+// beginAttempt checks the circuit breaker and waits for the rate limiter
+// before an attempt of a call is sent.
+func (c *Client) beginAttempt(ctx context.Context, k *call) error {
+	if err := c.circuitBreaker.Allow(k.path, k.model); err != nil {
+		return c.wrapCircuitError(err)
+	}
+	if err := c.rateLimiter.Wait(ctx, k.req.Path); err != nil {
+		c.circuitBreaker.Release(k.path, k.model)
+		return err
+	}
+	return nil
+}
+
+// endAttempt records the outcome of an attempt with the circuit breaker.
+// Server errors and transport failures count as failures; attempts abandoned
+// because the caller's context ended are not counted.
+func (c *Client) endAttempt(ctx context.Context, k *call, statusCode int, err error) {
+	if c.circuitBreaker == nil {
+		return
+	}
+	if err != nil && ctx.Err() != nil {
+		c.circuitBreaker.Release(k.path, k.model)
+		return
+	}
+	c.circuitBreaker.Record(k.path, k.model, err != nil || statusCode >= 500)
+}
+
+func statusCodeOf(resp *Response) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.StatusCode
+}
+
+func requestIDOf(resp *Response) string {
+	if resp == nil {
+		return ""
+	}
+	return resp.RequestID
+}
+
+func httpStatusCodeOf(resp *http.Response) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.StatusCode
+}
+
+// circuitKey returns the endpoint and model a request is tracked under. The
+// model is read from the request body.
+func circuitKey(req *Request, body *preparedBody) (string, string) {
+	endpoint := endpointOf(req)
+	if body == nil {
+		return endpoint, ""
+	}
+	var fields struct {
+		Model   json.RawMessage `json:"model"`
+		Request *struct {
+			Model json.RawMessage `json:"model"`
+		} `json:"request"`
+	}
+	if err := json.Unmarshal(body.data, &fields); err != nil {
+		return endpoint, ""
+	}
+	raw := fields.Model
+	if len(raw) == 0 && fields.Request != nil {
+		raw = fields.Request.Model
+	}
+	var model string
+	if err := json.Unmarshal(raw, &model); err != nil {
+		return endpoint, ""
+	}
+	return endpoint, model
+}
+
+// endpointOf returns the path of a request without its query.
+func endpointOf(req *Request) string {
+	if i := strings.IndexByte(req.Path, '?'); i >= 0 {
+		return req.Path[:i]
+	}
+	return req.Path
+}
+
+// preparedBody holds a request body that has been merged with extra body
+// fields and marshaled once, so that every attempt sends identical bytes.
+type preparedBody struct {
+	value any
+	data  []byte
+}
+
+// prepareBody merges extra body fields into the request body and marshals it.
+func (c *Client) prepareBody(req *Request) (*preparedBody, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := mergeExtraBody(req.Body, req.Options.ExtraBody)
+	if err != nil {
+		return nil, err
+	}
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+	return &preparedBody{value: body, data: bodyBytes}, nil
+}
+
+// newHTTPRequest builds the outgoing request for a single attempt.
+func (c *Client) newHTTPRequest(ctx context.Context, req *Request, body *preparedBody, stream bool) (*http.Request, error) {
 	requestURL, err := c.buildURL(req)
 	if err != nil {
 		return nil, err
 	}
 
 	var bodyReader io.Reader
-	if req.Body != nil {
-		body, err := mergeExtraBody(req.Body, req.Options.ExtraBody)
-		if err != nil {
-			return nil, err
-		}
-		bodyBytes, err := json.Marshal(body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal request body: %w", err)
-		}
-		bodyReader = bytes.NewReader(bodyBytes)
+	if body != nil {
+		bodyReader = bytes.NewReader(body.data)
 	}
 
-	requestCtx := ctx
-	var cancel context.CancelFunc
-	if req.Options.Timeout > 0 {
-		requestCtx, cancel = context.WithTimeout(ctx, req.Options.Timeout)
-		defer cancel()
-	}
-	httpReq, err := http.NewRequestWithContext(requestCtx, req.Method, requestURL, bodyReader)
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, requestURL, bodyReader)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
-	httpReq.Header.Set("Accept", "application/json")
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("User-Agent", c.userAgent)
+	if stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+		httpReq.Header.Set("Cache-Control", "no-cache")
+		httpReq.Header.Set("Connection", "keep-alive")
+	} else {
+		httpReq.Header.Set("Accept", "application/json")
+	}
 	httpReq.Header.Set("X-Stainless-Async", "false")
 
 	for key, value := range c.defaultHeaders {
@@ -185,114 +443,95 @@ func (c *Client) doRequest(ctx context.Context, req *Request) (*Response, error)
 	for key, value := range req.Options.Headers {
 		httpReq.Header.Set(key, value)
 	}
-
-	httpResp, err := c.httpClient.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+	if c.headerInjector != nil {
+		c.headerInjector(ctx, httpReq.Header)
 	}
-	defer httpResp.Body.Close()
 
-	body, err := io.ReadAll(httpResp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
+	return httpReq, nil
+}
 
-	requestID := httpResp.Header.Get("X-Request-Id")
-	if requestID == "" {
-		requestID = httpResp.Header.Get("X-Request-ID")
+// send passes the request through the middleware chain and the HTTP client.
+func (c *Client) send(httpReq *http.Request, req *Request, body *preparedBody, attempt int, stream bool) (*http.Response, error) {
+	httpClient := c.httpClient
+	if stream {
+		httpClient = c.streamHTTPClient()
+	}
+	next := api.MiddlewareNext(httpClient.Do)
+	if len(c.middleware) > 0 {
+		info := api.RequestInfo{
+			Operation: req.Operation,
+			Method:    req.Method,
+			Path:      req.Path,
+			Attempt:   attempt,
+			Stream:    stream,
+		}
+		if body != nil {
+			info.Body = body.value
+		}
+		for i := len(c.middleware) - 1; i >= 0; i-- {
+			middleware := c.middleware[i]
+			if middleware == nil {
+				continue
+			}
+			inner := next
+			next = func(r *http.Request) (*http.Response, error) {
+				return middleware(r, info, inner)
+			}
+		}
 	}
 
-	return &Response{
-		StatusCode: httpResp.StatusCode,
-		Headers:    httpResp.Header,
-		Body:       body,
-		RequestID:  requestID,
-	}, nil
-}
-
-// shouldRetryError determines if an error should trigger a retry.
-func (c *Client) shouldRetryError(err error) bool {
+	httpResp, err := next(httpReq)
 	if err == nil {
-		return false
-	}
-	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-		return false
+		c.rateLimiter.Observe(req.Path, httpResp.StatusCode, httpResp.Header)
 	}
-	var netErr net.Error
-	return errors.As(err, &netErr)
+	return httpResp, err
 }
 
-// shouldRetryStatus determines if a status code should trigger a retry.
-
-func (c *Client) shouldRetryResponse(resp *Response) bool {
-	if resp == nil {
-		return false
-	}
-	switch resp.Headers.Get("x-should-retry") {
-	case "true":
-		return true
-	case "false":
-		return false
+// doRequest performs a single HTTP request.
+func (c *Client) doRequest(ctx context.Context, req *Request, body *preparedBody, attempt int) (*Response, error) {
+	timeouts := newAttempt(ctx, req.Options.Timeout, c.connectTimeout(req))
+	defer timeouts.release()
+	httpReq, err := c.newHTTPRequest(timeouts.ctx, req, body, false)
+	if err != nil {
+		return nil, err
 	}
-	return c.shouldRetryStatus(resp.StatusCode)
-}
 
-func (c *Client) shouldRetryStatus(statusCode int) bool {
-	switch statusCode {
-	case http.StatusRequestTimeout, // 408
-		http.StatusConflict,        // 409
-		http.StatusTooManyRequests: // 429
-		return true
-	default:
-		// Retry on 5xx errors
-		return statusCode >= 500
+	start := time.Now()
+	httpResp, err := c.send(httpReq, req, body, attempt, false)
+	if !timeouts.headersReceived() {
+		if httpResp != nil {
+			httpResp.Body.Close()
+		}
+		httpResp, err = nil, timeouts.headerTimeout()
 	}
-}
-
-// calculateBackoff calculates the backoff delay for a given attempt.
-
-func (c *Client) calculateBackoff(attempt int, headers http.Header) time.Duration {
-	if retryAfter, ok := parseRetryAfter(headers); ok && retryAfter > 0 && retryAfter <= 60*time.Second {
-		return retryAfter
+	if err != nil {
+		c.logAttempt(ctx, req, httpReq, body, attempt, time.Since(start), nil, err)
+		return nil, fmt.Errorf("request failed: %w", err)
 	}
+	defer httpResp.Body.Close()
 
-	delay := InitialRetryDelay * time.Duration(math.Pow(2, float64(attempt-1)))
-	if delay > MaxRetryDelay {
-		delay = MaxRetryDelay
-	}
-	var randomBytes [8]byte
-	if _, err := rand.Read(randomBytes[:]); err == nil {
-		randomValue := binary.BigEndian.Uint64(randomBytes[:])
-		randomFloat := float64(randomValue) / float64(^uint64(0))
-		jitter := time.Duration(randomFloat * 0.25 * float64(delay))
-		if randomBytes[0]&1 == 0 {
-			delay += jitter
-		} else {
-			delay -= jitter
-		}
+	respBody, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		c.logAttempt(ctx, req, httpReq, body, attempt, time.Since(start), nil, err)
+		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
-	return delay
+	resp := &Response{
+		StatusCode: httpResp.StatusCode,
+		Headers:    httpResp.Header,
+		Body:       respBody,
+		RequestID:  requestIDFromHeaders(httpResp.Header),
+	}
+	c.logAttempt(ctx, req, httpReq, body, attempt, time.Since(start), resp, nil)
+	return resp, nil
 }
 
-func parseRetryAfter(headers http.Header) (time.Duration, bool) {
-	if headers == nil {
-		return 0, false
-	}
-	if retryAfterMS := headers.Get("retry-after-ms"); retryAfterMS != "" {
-		if value, err := strconv.ParseFloat(retryAfterMS, 64); err == nil {
-			return time.Duration(value * float64(time.Millisecond)), true
-		}
-	}
-	if retryAfter := headers.Get("retry-after"); retryAfter != "" {
-		if value, err := strconv.ParseFloat(retryAfter, 64); err == nil {
-			return time.Duration(value * float64(time.Second)), true
-		}
-		if when, err := http.ParseTime(retryAfter); err == nil {
-			return time.Until(when), true
-		}
+func requestIDFromHeaders(headers http.Header) string {
+	requestID := headers.Get("X-Request-Id")
+	if requestID == "" {
+		requestID = headers.Get("X-Request-ID")
 	}
-	return 0, false
+	return requestID
 }
 
 // errorFromResponse creates an error from an HTTP response.
@@ -339,106 +578,168 @@ func (c *Client) wrapTransportError(err error) error {
 	return fmt.Errorf("request failed: %w", err)
 }
 
+func (c *Client) wrapCircuitError(err error) error {
+	if c.errorFactory == nil {
+		return err
+	}
+	if wrapped := c.errorFactory(ErrorKindCircuitOpen, 0, err.Error(), nil, "", err); wrapped != nil {
+		return wrapped
+	}
+	return err
+}
+
 // DoStream executes a streaming HTTP request.
+// Connection failures and retryable status codes are retried under the same
+// retry policy as Do, until a successful response starts streaming. Errors
+// that occur after the response has been returned are not retried.
 // The caller is responsible for closing the response body.
 func (c *Client) DoStream(ctx context.Context, req *Request) (*StreamResponse, error) {
-	requestURL, err := c.buildURL(req)
+	body, err := c.prepareBody(req)
 	if err != nil {
 		return nil, err
 	}
 
-	var bodyReader io.Reader
-	if req.Body != nil {
-		body, err := mergeExtraBody(req.Body, req.Options.ExtraBody)
-		if err != nil {
+	retries := c.newRetryState(req)
+	ctx, call := c.startCall(ctx, req, body, retries, true)
+	resp, err := c.doStream(ctx, req, body, call)
+	if err != nil {
+		call.finish(err, 0)
+		return nil, err
+	}
+	call.finishOnClose(resp.Response)
+	resp.call = call
+	return resp, nil
+}
+
+func (c *Client) doStream(ctx context.Context, req *Request, body *preparedBody, call *call) (*StreamResponse, error) {
+	retries := call.retries
+	var lastErr error
+	var retryDelay time.Duration
+
+	for attempt := 0; attempt <= retries.maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(retryDelay):
+				// Continue with retry
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		if err := c.beginAttempt(ctx, call); err != nil {
 			return nil, err
 		}
-		bodyBytes, err := json.Marshal(body)
+
+		attemptCtx, span := c.startAttempt(ctx, req, attempt+1, retries.reason)
+		httpResp, errResp, err := c.doStreamRequest(attemptCtx, req, body, attempt+1)
+		if errResp != nil {
+			retries.observe(attempt+1, errResp.StatusCode, errResp.RequestID)
+			endAttemptSpan(span, errResp.StatusCode, errResp.RequestID, nil)
+			c.endAttempt(ctx, call, errResp.StatusCode, nil)
+		} else {
+			requestID := ""
+			if httpResp != nil {
+				requestID = requestIDFromHeaders(httpResp.Header)
+			}
+			retries.observe(attempt+1, httpStatusCodeOf(httpResp), requestID)
+			endAttemptSpan(span, httpStatusCodeOf(httpResp), requestID, err)
+			c.endAttempt(ctx, call, httpStatusCodeOf(httpResp), err)
+		}
 		if err != nil {
-			return nil, fmt.Errorf("failed to marshal request body: %w", err)
+			lastErr = c.wrapTransportError(err)
+			if attempt == retries.maxRetries {
+				break
+			}
+			delay, retry := retries.next(attempt+1, nil, err)
+			if !retry {
+				return nil, lastErr
+			}
+			c.logRetry(ctx, req, attempt+1, delay, 0, err)
+			retryDelay = delay
+			continue
+		}
+
+		if errResp != nil {
+			lastErr = c.errorFromResponse(errResp)
+			if attempt == retries.maxRetries {
+				break
+			}
+			delay, retry := retries.next(attempt+1, errResp, nil)
+			if !retry {
+				return nil, lastErr
+			}
+			c.logRetry(ctx, req, attempt+1, delay, errResp.StatusCode, nil)
+			retryDelay = delay
+			continue
 		}
-		bodyReader = bytes.NewReader(bodyBytes)
+
+		requestID := requestIDFromHeaders(httpResp.Header)
+		c.logStream(ctx, req, attempt+1, httpResp, requestID)
+		return &StreamResponse{
+			StatusCode: httpResp.StatusCode,
+			Headers:    httpResp.Header,
+			Response:   httpResp,
+			RequestID:  requestID,
+		}, nil
 	}
 
-	requestCtx := ctx
-	var cancel context.CancelFunc
-	if req.Options.Timeout > 0 {
-		requestCtx, cancel = context.WithTimeout(ctx, req.Options.Timeout)
-		defer cancel()
+	// Max retries exceeded
+	if lastErr != nil {
+		return nil, fmt.Errorf("max retries exceeded: %w", lastErr)
 	}
-	httpReq, err := http.NewRequestWithContext(requestCtx, req.Method, requestURL, bodyReader)
+	return nil, fmt.Errorf("max retries exceeded")
+}
+
+// doStreamRequest performs a single streaming HTTP request. A successful
+// response is returned unread, with a body that enforces the stream timeouts
+// and releases the attempt when closed; an error status is read into a
+// Response and its body closed.
+func (c *Client) doStreamRequest(ctx context.Context, req *Request, body *preparedBody, attempt int) (*http.Response, *Response, error) {
+	timeouts := newAttempt(ctx, c.streamTimeout(req), c.connectTimeout(req))
+	httpReq, err := c.newHTTPRequest(timeouts.ctx, req, body, true)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		timeouts.release()
+		return nil, nil, err
 	}
 
-	httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("User-Agent", c.userAgent)
-	httpReq.Header.Set("Accept", "text/event-stream")
-	httpReq.Header.Set("Cache-Control", "no-cache")
-	httpReq.Header.Set("Connection", "keep-alive")
-	httpReq.Header.Set("X-Stainless-Async", "false")
-
-	for key, value := range c.defaultHeaders {
-		httpReq.Header.Set(key, value)
-	}
-	for key, value := range req.Headers {
-		httpReq.Header.Set(key, value)
-	}
-	for key, value := range req.Options.Headers {
-		httpReq.Header.Set(key, value)
+	start := time.Now()
+	httpResp, err := c.send(httpReq, req, body, attempt, true)
+	if !timeouts.headersReceived() {
+		if httpResp != nil {
+			httpResp.Body.Close()
+		}
+		httpResp, err = nil, timeouts.headerTimeout()
 	}
-
-	httpResp, err := c.httpClient.Do(httpReq)
 	if err != nil {
-		return nil, c.wrapTransportError(err)
+		timeouts.release()
+		c.logAttempt(ctx, req, httpReq, body, attempt, time.Since(start), nil, err)
+		return nil, nil, err
 	}
 
-	// Check for error status codes
 	if httpResp.StatusCode >= 400 {
 		// Read error body
-		body, _ := io.ReadAll(httpResp.Body)
+		respBody, _ := io.ReadAll(httpResp.Body)
 		_ = httpResp.Body.Close() // Explicitly ignore close error for error response
+		timeouts.release()
 
-		var errorBody struct {
-			Message string `json:"message"`
-			Error   string `json:"error"`
-		}
-
-		message := fmt.Sprintf("HTTP %d", httpResp.StatusCode)
-		if err := json.Unmarshal(body, &errorBody); err == nil {
-			if errorBody.Message != "" {
-				message = errorBody.Message
-			} else if errorBody.Error != "" {
-				message = errorBody.Error
-			}
-		}
-
-		requestID := httpResp.Header.Get("X-Request-Id")
-		if requestID == "" {
-			requestID = httpResp.Header.Get("X-Request-ID")
-		}
-
-		if c.errorFactory != nil {
-			if err := c.errorFactory(ErrorKindStatus, httpResp.StatusCode, message, body, requestID, nil); err != nil {
-				return nil, err
-			}
+		errResp := &Response{
+			StatusCode: httpResp.StatusCode,
+			Headers:    httpResp.Header,
+			Body:       respBody,
+			RequestID:  requestIDFromHeaders(httpResp.Header),
 		}
-		return nil, fmt.Errorf("%s (status: %d, request_id: %s)", message, httpResp.StatusCode, requestID)
-	}
-
-	// Extract request ID from headers
-	requestID := httpResp.Header.Get("X-Request-Id")
-	if requestID == "" {
-		requestID = httpResp.Header.Get("X-Request-ID")
+		c.logAttempt(ctx, req, httpReq, body, attempt, time.Since(start), errResp, nil)
+		return nil, errResp, nil
 	}
 
-	return &StreamResponse{
+	requestID := requestIDFromHeaders(httpResp.Header)
+	c.logAttempt(ctx, req, httpReq, body, attempt, time.Since(start), &Response{
 		StatusCode: httpResp.StatusCode,
 		Headers:    httpResp.Header,
-		Response:   httpResp,
 		RequestID:  requestID,
-	}, nil
+	}, nil)
+	httpResp.Body = c.newAttemptBody(httpResp.Body, timeouts, c.streamIdleTimeout(req), requestID)
+	return httpResp, nil, nil
 }
 
 func (c *Client) buildURL(req *Request) (string, error) {
@@ -13,6 +13,8 @@ import (
 	"time"
 
 	"github.com/ZaguanLabs/perplexity-go/perplexity/api"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/internal/circuit"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/internal/ratelimit"
 )
 
 func TestNewClient(t *testing.T) {
@@ -330,8 +332,6 @@ func TestClient_DoStream_Error(t *testing.T) {
 }
 
 func TestClient_CalculateBackoff(t *testing.T) {
-	client := NewClient(&http.Client{}, "https://api.example.com", "key", 3, nil, "agent", nil)
-
 	tests := []struct {
 		attempt  int
 		minDelay time.Duration
@@ -344,7 +344,7 @@ func TestClient_CalculateBackoff(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(fmt.Sprintf("attempt_%d", tt.attempt), func(t *testing.T) {
-			delay := client.calculateBackoff(tt.attempt, nil)
+			_, delay := decideRetry(defaultRetryPolicy, api.RetryInfo{Attempt: tt.attempt, StatusCode: http.StatusServiceUnavailable})
 			if delay < tt.minDelay || delay > tt.maxDelay {
 				t.Errorf("Backoff delay %v out of range [%v, %v]", delay, tt.minDelay, tt.maxDelay)
 			}
@@ -353,10 +353,9 @@ func TestClient_CalculateBackoff(t *testing.T) {
 }
 
 func TestClient_CalculateBackoff_MaxDelay(t *testing.T) {
-	client := NewClient(&http.Client{}, "https://api.example.com", "key", 10, nil, "agent", nil)
-
 	// Test that backoff is capped at MaxRetryDelay
-	delay := client.calculateBackoff(10, nil)                  // Very high attempt number
+	// Very high attempt number
+	_, delay := decideRetry(defaultRetryPolicy, api.RetryInfo{Attempt: 10, StatusCode: http.StatusServiceUnavailable})
 	maxAllowed := time.Duration(float64(MaxRetryDelay) * 1.25) // Allow for jitter
 	if delay > maxAllowed {
 		t.Errorf("Backoff delay %v exceeds max %v", delay, maxAllowed)
@@ -364,38 +363,32 @@ func TestClient_CalculateBackoff_MaxDelay(t *testing.T) {
 }
 
 func TestClient_CalculateBackoff_RetryAfter(t *testing.T) {
-	client := NewClient(&http.Client{}, "https://api.example.com", "key", 3, nil, "agent", nil)
-
 	headers := http.Header{}
 	headers.Set("retry-after-ms", "1500")
-	if delay := client.calculateBackoff(1, headers); delay != 1500*time.Millisecond {
+	if _, delay := decideRetry(defaultRetryPolicy, api.RetryInfo{Attempt: 1, StatusCode: http.StatusTooManyRequests, Headers: headers}); delay != 1500*time.Millisecond {
 		t.Errorf("Backoff delay = %v, want %v", delay, 1500*time.Millisecond)
 	}
 
 	headers = http.Header{}
 	headers.Set("retry-after", "2.5")
-	if delay := client.calculateBackoff(1, headers); delay != 2500*time.Millisecond {
+	if _, delay := decideRetry(defaultRetryPolicy, api.RetryInfo{Attempt: 1, StatusCode: http.StatusTooManyRequests, Headers: headers}); delay != 2500*time.Millisecond {
 		t.Errorf("Backoff delay = %v, want %v", delay, 2500*time.Millisecond)
 	}
 }
 
 func TestClient_ShouldRetryResponse_HeaderOverride(t *testing.T) {
-	client := NewClient(&http.Client{}, "https://api.example.com", "key", 3, nil, "agent", nil)
-
-	resp := &Response{StatusCode: http.StatusBadRequest, Headers: http.Header{"X-Should-Retry": []string{"true"}}}
-	if !client.shouldRetryResponse(resp) {
+	info := api.RetryInfo{Attempt: 1, StatusCode: http.StatusBadRequest, Headers: http.Header{"X-Should-Retry": []string{"true"}}}
+	if retry, _ := decideRetry(defaultRetryPolicy, info); !retry {
 		t.Error("Expected x-should-retry=true to force retry")
 	}
 
-	resp = &Response{StatusCode: http.StatusInternalServerError, Headers: http.Header{"X-Should-Retry": []string{"false"}}}
-	if client.shouldRetryResponse(resp) {
+	info = api.RetryInfo{Attempt: 1, StatusCode: http.StatusInternalServerError, Headers: http.Header{"X-Should-Retry": []string{"false"}}}
+	if retry, _ := decideRetry(defaultRetryPolicy, info); retry {
 		t.Error("Expected x-should-retry=false to suppress retry")
 	}
 }
 
 func TestClient_ShouldRetryStatus(t *testing.T) {
-	client := NewClient(&http.Client{}, "https://api.example.com", "key", 3, nil, "agent", nil)
-
 	retryableStatuses := []int{
 		http.StatusRequestTimeout,      // 408
 		http.StatusConflict,            // 409
@@ -408,7 +401,7 @@ func TestClient_ShouldRetryStatus(t *testing.T) {
 
 	for _, status := range retryableStatuses {
 		t.Run(fmt.Sprintf("status_%d", status), func(t *testing.T) {
-			if !client.shouldRetryStatus(status) {
+			if !defaultRetryPolicy.ShouldRetry(api.RetryInfo{StatusCode: status}) {
 				t.Errorf("Status %d should be retryable", status)
 			}
 		})
@@ -425,7 +418,7 @@ func TestClient_ShouldRetryStatus(t *testing.T) {
 
 	for _, status := range nonRetryableStatuses {
 		t.Run(fmt.Sprintf("status_%d_not_retryable", status), func(t *testing.T) {
-			if client.shouldRetryStatus(status) {
+			if defaultRetryPolicy.ShouldRetry(api.RetryInfo{StatusCode: status}) {
 				t.Errorf("Status %d should not be retryable", status)
 			}
 		})
@@ -562,3 +555,417 @@ func TestClient_RequestOptionsAndDefaultQuery(t *testing.T) {
 		t.Fatalf("Do() error = %v", err)
 	}
 }
+
+func TestClient_Middleware(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if got := r.Header.Get("X-Trace"); got != "outer,inner" {
+			t.Errorf("X-Trace = %q, want outer,inner", got)
+		}
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var infos []api.RequestInfo
+	var statuses []int
+	outer := func(req *http.Request, info api.RequestInfo, next api.MiddlewareNext) (*http.Response, error) {
+		infos = append(infos, info)
+		req.Header.Set("X-Trace", "outer")
+		resp, err := next(req)
+		if resp != nil {
+			statuses = append(statuses, resp.StatusCode)
+		}
+		return resp, err
+	}
+	inner := func(req *http.Request, info api.RequestInfo, next api.MiddlewareNext) (*http.Response, error) {
+		req.Header.Set("X-Trace", req.Header.Get("X-Trace")+",inner")
+		return next(req)
+	}
+
+	client := NewClient(server.Client(), server.URL, "test-key", 2, nil, "test-agent", nil)
+	client.SetMiddleware([]api.Middleware{outer, inner})
+
+	req := &Request{
+		Operation: "test.create",
+		Method:    "POST",
+		Path:      "/test",
+		Body:      map[string]any{"model": "sonar"},
+		Options:   api.ApplyRequestOptions([]api.RequestOption{api.WithExtraBody("extra", true)}),
+	}
+	if _, err := client.Do(context.Background(), req); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+
+	if len(infos) != 2 {
+		t.Fatalf("middleware calls = %d, want 2", len(infos))
+	}
+	for i, info := range infos {
+		if info.Attempt != i+1 {
+			t.Errorf("infos[%d].Attempt = %d, want %d", i, info.Attempt, i+1)
+		}
+		if info.Operation != "test.create" || info.Method != "POST" || info.Path != "/test" || info.Stream {
+			t.Errorf("infos[%d] = %+v", i, info)
+		}
+		body, ok := info.Body.(map[string]any)
+		if !ok || body["model"] != "sonar" || body["extra"] != true {
+			t.Errorf("infos[%d].Body = %#v", i, info.Body)
+		}
+	}
+	if len(statuses) != 2 || statuses[0] != http.StatusServiceUnavailable || statuses[1] != http.StatusOK {
+		t.Errorf("statuses = %v", statuses)
+	}
+}
+
+func TestClient_Middleware_Stream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: test\n\n"))
+	}))
+	defer server.Close()
+
+	var got api.RequestInfo
+	client := NewClient(server.Client(), server.URL, "test-key", 0, nil, "test-agent", nil)
+	client.SetMiddleware([]api.Middleware{
+		func(req *http.Request, info api.RequestInfo, next api.MiddlewareNext) (*http.Response, error) {
+			got = info
+			return next(req)
+		},
+	})
+
+	resp, err := client.DoStream(context.Background(), &Request{Operation: "test.stream", Method: "POST", Path: "/stream"})
+	if err != nil {
+		t.Fatalf("DoStream() error = %v", err)
+	}
+	resp.Response.Body.Close()
+
+	if !got.Stream || got.Attempt != 1 || got.Operation != "test.stream" {
+		t.Errorf("info = %+v", got)
+	}
+}
+
+func TestClient_Middleware_ShortCircuit(t *testing.T) {
+	client := NewClient(&http.Client{}, "http://127.0.0.1:0", "test-key", 0, nil, "test-agent", nil)
+	client.SetMiddleware([]api.Middleware{
+		func(req *http.Request, info api.RequestInfo, next api.MiddlewareNext) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"X-Request-Id": []string{"cached"}},
+				Body:       io.NopCloser(strings.NewReader(`{"ok":true}`)),
+			}, nil
+		},
+	})
+
+	resp, err := client.Do(context.Background(), &Request{Method: "GET", Path: "/test"})
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if resp.RequestID != "cached" || string(resp.Body) != `{"ok":true}` {
+		t.Errorf("resp = %+v", resp)
+	}
+}
+
+func TestClient_Do_RetryPolicy(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	policy := &recordingRetryPolicy{delay: time.Millisecond}
+	client := NewClient(server.Client(), server.URL, "test-key", 3, nil, "test-agent", nil)
+	client.SetRetryPolicy(policy)
+
+	_, err := client.Do(context.Background(), &Request{Operation: "test.get", Method: "GET", Path: "/test"})
+	if err == nil {
+		t.Fatal("Expected error after max retries")
+	}
+	if attempts != 4 {
+		t.Errorf("Expected 4 attempts, got %d", attempts)
+	}
+	if len(policy.infos) != 3 {
+		t.Fatalf("policy calls = %d, want 3", len(policy.infos))
+	}
+	for i, info := range policy.infos {
+		if info.Attempt != i+1 || info.MaxRetries != 3 || info.Operation != "test.get" || info.StatusCode != http.StatusTooManyRequests {
+			t.Errorf("infos[%d] = %+v", i, info)
+		}
+	}
+}
+
+func TestClient_Do_RequestRetryPolicyOverride(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.Client(), server.URL, "test-key", 2, nil, "test-agent", nil)
+	client.SetRetryPolicy(api.RetryPolicyFunc(func(info api.RetryInfo) (bool, time.Duration) {
+		return true, time.Millisecond
+	}))
+
+	req := &Request{
+		Method: "GET",
+		Path:   "/test",
+		Options: api.ApplyRequestOptions([]api.RequestOption{
+			api.WithRetryPolicy(api.RetryPolicyFunc(func(info api.RetryInfo) (bool, time.Duration) {
+				return false, 0
+			})),
+		}),
+	}
+	if _, err := client.Do(context.Background(), req); err == nil {
+		t.Fatal("Expected error for 503 status")
+	}
+	if attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", attempts)
+	}
+
+	attempts = 0
+	req.Options = api.ApplyRequestOptions([]api.RequestOption{api.WithMaxRetries(4)})
+	if _, err := client.Do(context.Background(), req); err == nil {
+		t.Fatal("Expected error after max retries")
+	}
+	if attempts != 5 {
+		t.Errorf("Expected 5 attempts, got %d", attempts)
+	}
+}
+
+type recordingRetryPolicy struct {
+	infos []api.RetryInfo
+	delay time.Duration
+}
+
+func (p *recordingRetryPolicy) ShouldRetry(info api.RetryInfo) bool {
+	p.infos = append(p.infos, info)
+	return true
+}
+
+func (p *recordingRetryPolicy) RetryDelay(info api.RetryInfo) time.Duration {
+	return p.delay
+}
+
+func TestClient_RetryPolicyFuncCalledOnce(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	calls := 0
+	client := NewClient(server.Client(), server.URL, "test-key", 2, nil, "test-agent", nil)
+	client.SetRetryPolicy(api.RetryPolicyFunc(func(info api.RetryInfo) (bool, time.Duration) {
+		calls++
+		return true, time.Millisecond
+	}))
+
+	if _, err := client.Do(context.Background(), &Request{Method: "GET", Path: "/test"}); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("retry policy called %d times, want 1", calls)
+	}
+}
+
+func TestClient_DoStream_Retry(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		switch attempts {
+		case 1:
+			w.Header().Set("retry-after-ms", "10")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]string{"error": "rate limited"})
+			return
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("X-Request-Id", "stream-retry")
+		w.Write([]byte("data: test\n\n"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.Client(), server.URL, "test-key", 2, nil, "test-agent", nil)
+	client.SetRetryPolicy(&api.ExponentialBackoff{InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, MaxRetryAfter: time.Second})
+
+	resp, err := client.DoStream(context.Background(), &Request{Method: "POST", Path: "/stream", Body: map[string]string{"test": "data"}})
+	if err != nil {
+		t.Fatalf("DoStream() error = %v", err)
+	}
+	defer resp.Response.Body.Close()
+
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+	if resp.RequestID != "stream-retry" {
+		t.Errorf("RequestID = %s, want stream-retry", resp.RequestID)
+	}
+	data, err := io.ReadAll(resp.Response.Body)
+	if err != nil {
+		t.Fatalf("Failed to read stream: %v", err)
+	}
+	if !strings.Contains(string(data), "data: test") {
+		t.Error("Stream data incorrect")
+	}
+}
+
+func TestClient_DoStream_RetryHeaderOverride(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("x-should-retry", "false")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.Client(), server.URL, "test-key", 2, nil, "test-agent", nil)
+
+	_, err := client.DoStream(context.Background(), &Request{Method: "POST", Path: "/stream"})
+	if err == nil {
+		t.Fatal("Expected error for 503 status")
+	}
+	if attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", attempts)
+	}
+}
+
+func TestClient_DoStream_MaxRetriesExceeded(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	calls := 0
+	client := NewClient(server.Client(), server.URL, "test-key", 2, nil, "test-agent", nil)
+	client.SetRetryPolicy(api.RetryPolicyFunc(func(info api.RetryInfo) (bool, time.Duration) {
+		calls++
+		return true, time.Millisecond
+	}))
+
+	_, err := client.DoStream(context.Background(), &Request{Method: "POST", Path: "/stream"})
+	if err == nil {
+		t.Fatal("Expected error after max retries")
+	}
+	if calls != 2 {
+		t.Errorf("retry policy called %d times, want 2", calls)
+	}
+	if !strings.Contains(err.Error(), "max retries exceeded") {
+		t.Errorf("Error = %v, want max retries exceeded", err)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestClient_RateLimiter(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	limiter := ratelimit.New()
+	limiter.SetLimit("/test", 0.001, 1)
+
+	client := NewClient(server.Client(), server.URL, "test-key", 0, nil, "test-agent", nil)
+	client.SetRateLimiter(limiter)
+
+	if _, err := client.Do(context.Background(), &Request{Method: "GET", Path: "/test"}); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := client.Do(ctx, &Request{Method: "GET", Path: "/test"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Do() error = %v, want context.DeadlineExceeded", err)
+	}
+	if attempts != 1 {
+		t.Errorf("Expected 1 attempt to reach the server, got %d", attempts)
+	}
+
+	if _, err := client.Do(context.Background(), &Request{Method: "GET", Path: "/other"}); err != nil {
+		t.Fatalf("Do() on unlimited path error = %v", err)
+	}
+}
+
+func TestClient_CircuitBreaker(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.Client(), server.URL, "test-key", 5, nil, "test-agent", nil)
+	client.SetRetryPolicy(&api.ExponentialBackoff{InitialDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	client.SetCircuitBreaker(circuit.New(circuit.Config{MinRequests: 2, OpenTimeout: time.Minute}))
+
+	req := &Request{Method: "POST", Path: "/chat/completions", Body: map[string]any{"model": "sonar"}}
+	_, err := client.Do(context.Background(), req)
+	var openErr *circuit.OpenError
+	if !errors.As(err, &openErr) {
+		t.Fatalf("Do() error = %v, want *circuit.OpenError", err)
+	}
+	if openErr.Endpoint != "/chat/completions" || openErr.Model != "sonar" {
+		t.Errorf("OpenError = %+v", openErr)
+	}
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts before the circuit opened, got %d", attempts)
+	}
+
+	if _, err := client.Do(context.Background(), req); !errors.As(err, &openErr) {
+		t.Errorf("Do() error = %v, want fail fast", err)
+	}
+	if attempts != 2 {
+		t.Errorf("Expected no attempts while open, got %d", attempts)
+	}
+
+	other := &Request{Method: "POST", Path: "/chat/completions", Body: map[string]any{"request": map[string]any{"model": "sonar-pro"}}}
+	if endpoint, model := circuitKey(other, mustPrepare(t, client, other)); endpoint != "/chat/completions" || model != "sonar-pro" {
+		t.Errorf("circuitKey() = %q, %q", endpoint, model)
+	}
+}
+
+func TestClient_StartCallModel(t *testing.T) {
+	req := &Request{Method: "POST", Path: "/chat/completions?x=1", Body: map[string]any{"model": "sonar"}}
+
+	plain := NewClient(&http.Client{}, "https://api.example.com", "key", 0, nil, "agent", nil)
+	_, k := plain.startCall(context.Background(), req, mustPrepare(t, plain, req), plain.newRetryState(req), false)
+	if k.path != "/chat/completions" || k.model != "" {
+		t.Errorf("call without breaker or telemetry = %q, %q, want the body left unparsed", k.path, k.model)
+	}
+
+	breaker := NewClient(&http.Client{}, "https://api.example.com", "key", 0, nil, "agent", nil)
+	breaker.SetCircuitBreaker(circuit.New(circuit.Config{}))
+	_, k = breaker.startCall(context.Background(), req, mustPrepare(t, breaker, req), breaker.newRetryState(req), false)
+	if k.path != "/chat/completions" || k.model != "sonar" {
+		t.Errorf("call with breaker = %q, %q", k.path, k.model)
+	}
+}
+
+func mustPrepare(t *testing.T, client *Client, req *Request) *preparedBody {
+	t.Helper()
+	body, err := client.prepareBody(req)
+	if err != nil {
+		t.Fatalf("prepareBody() error = %v", err)
+	}
+	return body
+}
@@ -0,0 +1,182 @@
+package http
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+const redacted = "[REDACTED]"
+
+// SetLogger sets the logger used to record attempts, retries and stream
+// lifecycle events at debug level. When maxBodyBytes is positive, request and
+// response bodies are logged as well, truncated to that many bytes. A nil
+// logger disables logging.
+func (c *Client) SetLogger(logger *slog.Logger, maxBodyBytes int) {
+	c.logger = logger
+	c.logBodyLimit = maxBodyBytes
+}
+
+func (c *Client) debugEnabled(ctx context.Context) bool {
+	return c.logger != nil && c.logger.Enabled(ctx, slog.LevelDebug)
+}
+
+func requestAttrs(req *Request, attempt int) []slog.Attr {
+	return []slog.Attr{
+		slog.String("operation", req.Operation),
+		slog.String("method", req.Method),
+		slog.String("path", req.Path),
+		slog.Int("attempt", attempt),
+	}
+}
+
+// logAttempt records the outcome of a single attempt.
+func (c *Client) logAttempt(ctx context.Context, req *Request, httpReq *http.Request, body *preparedBody, attempt int, latency time.Duration, resp *Response, err error) {
+	if !c.debugEnabled(ctx) {
+		return
+	}
+	attrs := requestAttrs(req, attempt)
+	attrs = append(attrs, slog.Duration("latency", latency))
+	if resp != nil {
+		attrs = append(attrs,
+			slog.Int("status", resp.StatusCode),
+			slog.String("request_id", resp.RequestID),
+		)
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", c.redact(err.Error())))
+	}
+	if c.logBodyLimit > 0 {
+		if httpReq != nil {
+			attrs = append(attrs, slog.Any("request_headers", c.redactHeaders(httpReq.Header)))
+		}
+		if body != nil {
+			attrs = append(attrs, slog.String("request_body", c.truncateBody(body.data)))
+		}
+		if resp != nil && resp.Body != nil {
+			attrs = append(attrs, slog.String("response_body", c.truncateBody(resp.Body)))
+		}
+	}
+	c.logger.LogAttrs(ctx, slog.LevelDebug, "perplexity: request", attrs...)
+}
+
+// logRetry records that a failed attempt will be retried after delay.
+func (c *Client) logRetry(ctx context.Context, req *Request, attempt int, delay time.Duration, statusCode int, err error) {
+	if !c.debugEnabled(ctx) {
+		return
+	}
+	attrs := requestAttrs(req, attempt)
+	attrs = append(attrs, slog.Duration("retry_delay", delay))
+	if statusCode != 0 {
+		attrs = append(attrs, slog.Int("status", statusCode))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", c.redact(err.Error())))
+	}
+	c.logger.LogAttrs(ctx, slog.LevelDebug, "perplexity: retrying request", attrs...)
+}
+
+// logStream wraps a successful stream response so that closing it is logged.
+func (c *Client) logStream(ctx context.Context, req *Request, attempt int, resp *http.Response, requestID string) {
+	if !c.debugEnabled(ctx) {
+		return
+	}
+	attrs := requestAttrs(req, attempt)
+	attrs = append(attrs,
+		slog.Int("status", resp.StatusCode),
+		slog.String("request_id", requestID),
+	)
+	c.logger.LogAttrs(ctx, slog.LevelDebug, "perplexity: stream opened", attrs...)
+	resp.Body = &loggingBody{
+		ReadCloser: resp.Body,
+		ctx:        ctx,
+		logger:     c.logger,
+		attrs:      attrs,
+		opened:     time.Now(),
+	}
+}
+
+// loggingBody logs the duration and size of a stream when it is closed.
+// Close may run concurrently with Read, so the byte count is atomic.
+type loggingBody struct {
+	io.ReadCloser
+	ctx    context.Context
+	logger *slog.Logger
+	attrs  []slog.Attr
+	opened time.Time
+	bytes  atomic.Int64
+	closed sync.Once
+}
+
+func (b *loggingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes.Add(int64(n))
+	return n, err
+}
+
+func (b *loggingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.closed.Do(func() {
+		attrs := append(b.attrs,
+			slog.Duration("duration", time.Since(b.opened)),
+			slog.Int64("bytes", b.bytes.Load()),
+		)
+		b.logger.LogAttrs(b.ctx, slog.LevelDebug, "perplexity: stream closed", attrs...)
+	})
+	return err
+}
+
+// redactHeaders returns the headers as a flat map with credentials removed.
+func (c *Client) redactHeaders(headers http.Header) map[string]string {
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	output := make(map[string]string, len(headers))
+	for _, key := range keys {
+		value := strings.Join(headers[key], ", ")
+		if isSensitiveHeader(key) {
+			value = redacted
+		}
+		output[key] = c.redact(value)
+	}
+	return output
+}
+
+func isSensitiveHeader(key string) bool {
+	key = strings.ToLower(key)
+	if key == "authorization" || key == "proxy-authorization" || key == "cookie" || key == "set-cookie" {
+		return true
+	}
+	return strings.Contains(key, "api-key") || strings.Contains(key, "apikey") ||
+		strings.Contains(key, "token") || strings.Contains(key, "secret")
+}
+
+// redact removes the client's API key from text.
+func (c *Client) redact(text string) string {
+	if c.apiKey == "" {
+		return text
+	}
+	return strings.ReplaceAll(text, c.apiKey, redacted)
+}
+
+func (c *Client) truncateBody(body []byte) string {
+	text := c.redact(string(body))
+	if len(text) > c.logBodyLimit {
+		cut := c.logBodyLimit
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		return text[:cut] + "...(truncated)"
+	}
+	return text
+}
@@ -0,0 +1,179 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity/api"
+)
+
+func newTestLogger() (*slog.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	return slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})), &buf
+}
+
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestClient_Logging(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("X-Request-ID", "req-123")
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":"busy"}`))
+			return
+		}
+		w.Write([]byte(`{"echo":"secret-key"}`))
+	}))
+	defer server.Close()
+
+	logger, buf := newTestLogger()
+	client := NewClient(server.Client(), server.URL, "secret-key", 2, map[string]string{"X-Api-Key": "other"}, "test-agent", nil)
+	client.SetRetryPolicy(&api.ExponentialBackoff{InitialDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	client.SetLogger(logger, 1024)
+
+	_, err := client.Do(context.Background(), &Request{
+		Operation: "chat.create",
+		Method:    "POST",
+		Path:      "/chat/completions",
+		Body:      map[string]any{"model": "sonar", "note": "secret-key"},
+	})
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+
+	output := buf.String()
+	if strings.Contains(output, "secret-key") {
+		t.Errorf("log output contains the API key: %s", output)
+	}
+
+	records := logRecords(t, buf)
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 log records, got %d: %s", len(records), output)
+	}
+	if records[0]["msg"] != "perplexity: request" || records[0]["status"] != float64(503) || records[0]["operation"] != "chat.create" {
+		t.Errorf("first record = %v", records[0])
+	}
+	if records[1]["msg"] != "perplexity: retrying request" || records[1]["retry_delay"] == nil {
+		t.Errorf("retry record = %v", records[1])
+	}
+	last := records[2]
+	if last["status"] != float64(200) || last["request_id"] != "req-123" || last["attempt"] != float64(2) {
+		t.Errorf("last record = %v", last)
+	}
+	headers, _ := last["request_headers"].(map[string]any)
+	if headers["Authorization"] != redacted || headers["X-Api-Key"] != redacted {
+		t.Errorf("request_headers = %v", headers)
+	}
+	if last["response_body"] != `{"echo":"[REDACTED]"}` {
+		t.Errorf("response_body = %v", last["response_body"])
+	}
+}
+
+func TestClient_LoggingWithoutBodies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	logger, buf := newTestLogger()
+	client := NewClient(server.Client(), server.URL, "test-key", 0, nil, "test-agent", nil)
+	client.SetLogger(logger, 0)
+
+	if _, err := client.Do(context.Background(), &Request{Method: "GET", Path: "/test"}); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	records := logRecords(t, buf)
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 log record, got %d", len(records))
+	}
+	for _, key := range []string{"request_headers", "request_body", "response_body"} {
+		if _, ok := records[0][key]; ok {
+			t.Errorf("unexpected %s in record %v", key, records[0])
+		}
+	}
+}
+
+func TestClient_LoggingStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {}\n\n"))
+	}))
+	defer server.Close()
+
+	logger, buf := newTestLogger()
+	client := NewClient(server.Client(), server.URL, "test-key", 0, nil, "test-agent", nil)
+	client.SetLogger(logger, 0)
+
+	resp, err := client.DoStream(context.Background(), &Request{Operation: "chat.create_stream", Method: "POST", Path: "/chat/completions"})
+	if err != nil {
+		t.Fatalf("DoStream() error = %v", err)
+	}
+	io.Copy(io.Discard, resp.Response.Body)
+	resp.Response.Body.Close()
+	resp.Response.Body.Close()
+
+	records := logRecords(t, buf)
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 log records, got %d: %s", len(records), buf.String())
+	}
+	if records[1]["msg"] != "perplexity: stream opened" {
+		t.Errorf("second record = %v", records[1])
+	}
+	if records[2]["msg"] != "perplexity: stream closed" || records[2]["bytes"] != float64(len("data: {}\n\n")) {
+		t.Errorf("last record = %v", records[2])
+	}
+}
+
+func TestClient_LoggingDisabled(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client := NewClient(server.Client(), server.URL, "test-key", 0, nil, "test-agent", nil)
+	client.SetLogger(logger, 1024)
+	if _, err := client.Do(context.Background(), &Request{Method: "GET", Path: "/test"}); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected no output below debug level, got %s", buf.String())
+	}
+}
+
+func TestTruncateBody(t *testing.T) {
+	client := &Client{apiKey: "key", logBodyLimit: 4}
+	if got := client.truncateBody([]byte("abcdef")); got != "abcd...(truncated)" {
+		t.Errorf("truncateBody() = %q", got)
+	}
+	if got := client.truncateBody([]byte("abé")); got != "abé" {
+		t.Errorf("truncateBody() = %q", got)
+	}
+	client.logBodyLimit = 3
+	if got := client.truncateBody([]byte("abéd")); got != "ab...(truncated)" {
+		t.Errorf("truncateBody() = %q", got)
+	}
+}
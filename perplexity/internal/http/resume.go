@@ -0,0 +1,34 @@
+package http
+
+import "context"
+
+// SetStreamReconnects sets how many times streams are reopened after a
+// dropped connection, for requests that do not override it. Zero disables
+// stream resumption.
+func (c *Client) SetStreamReconnects(reconnects int) {
+	c.streamReconnects = reconnects
+}
+
+// StreamReconnects returns how many times the stream opened by req may be
+// reopened after a dropped connection.
+func (c *Client) StreamReconnects(req *Request) int {
+	if req.Options.StreamReconnects != nil {
+		return *req.Options.StreamReconnects
+	}
+	return c.streamReconnects
+}
+
+// Resume reopens a stream that lost its connection. A non-empty lastEventID
+// is sent as the Last-Event-ID header so that the server continues after the
+// last event received.
+func (c *Client) Resume(ctx context.Context, req *Request, lastEventID string) (*StreamResponse, error) {
+	resumed := *req
+	if lastEventID != "" {
+		resumed.Headers = make(map[string]string, len(req.Headers)+1)
+		for key, value := range req.Headers {
+			resumed.Headers[key] = value
+		}
+		resumed.Headers["Last-Event-ID"] = lastEventID
+	}
+	return c.DoStream(ctx, &resumed)
+}
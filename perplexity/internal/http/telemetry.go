@@ -0,0 +1,255 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity/api"
+)
+
+// SetMetrics sets the metrics sink for service calls. A nil sink disables
+// metrics.
+func (c *Client) SetMetrics(metrics api.Metrics) {
+	c.metrics = metrics
+}
+
+// SetTracer sets the tracer for service calls and their attempts. A nil
+// tracer disables tracing.
+func (c *Client) SetTracer(tracer api.Tracer) {
+	c.tracer = tracer
+}
+
+// SetHeaderInjector sets the function that propagates trace context to
+// outgoing requests.
+func (c *Client) SetHeaderInjector(injector api.HeaderInjector) {
+	c.headerInjector = injector
+}
+
+// call tracks a single service call, across all of its attempts, for metrics
+// and tracing.
+type call struct {
+	client  *Client
+	ctx     context.Context
+	req     *Request
+	model   string
+	path    string
+	retries *retryState
+	stream  bool
+	span    api.Span
+}
+
+// startCall starts the parent span of a service call and returns the context
+// to use for its attempts.
+func (c *Client) startCall(ctx context.Context, req *Request, body *preparedBody, retries *retryState, stream bool) (context.Context, *call) {
+	// The model is only needed by the circuit breaker and telemetry, so the
+	// body is not parsed for it otherwise.
+	path, model := endpointOf(req), ""
+	if c.circuitBreaker != nil || c.metrics != nil || c.tracer != nil {
+		path, model = circuitKey(req, body)
+	}
+	k := &call{
+		client:  c,
+		ctx:     ctx,
+		req:     req,
+		model:   model,
+		path:    path,
+		retries: retries,
+		stream:  stream,
+	}
+	if c.tracer != nil {
+		attrs := []api.Attribute{
+			{Key: api.AttrOperation, Value: req.Operation},
+			{Key: api.AttrMethod, Value: req.Method},
+			{Key: api.AttrPath, Value: path},
+			{Key: api.AttrStream, Value: stream},
+		}
+		if model != "" {
+			attrs = append(attrs, api.Attribute{Key: api.AttrModel, Value: model})
+		}
+		k.ctx, k.span = c.tracer.StartSpan(ctx, spanName(req), attrs...)
+	}
+	return k.ctx, k
+}
+
+func spanName(req *Request) string {
+	if req.Operation != "" {
+		return req.Operation
+	}
+	return req.Method + " " + req.Path
+}
+
+// observed reports whether usage would be reported anywhere.
+func (k *call) observed() bool {
+	return k.client.metrics != nil || k.span != nil
+}
+
+// recordUsage reports usage to the metrics sink and the call span.
+func (k *call) recordUsage(usage api.UsageMetrics) {
+	if usage.Operation == "" {
+		usage.Operation = k.req.Operation
+	}
+	if usage.Model == "" {
+		usage.Model = k.model
+	}
+	if k.client.metrics != nil {
+		k.client.metrics.RecordUsage(k.ctx, usage)
+	}
+	if k.span != nil {
+		attrs := []api.Attribute{
+			{Key: api.AttrInputTokens, Value: usage.InputTokens},
+			{Key: api.AttrOutputTokens, Value: usage.OutputTokens},
+			{Key: api.AttrTotalTokens, Value: usage.TotalTokens},
+			{Key: api.AttrTotalCost, Value: usage.TotalCost},
+		}
+		if usage.ReasoningTokens > 0 {
+			attrs = append(attrs, api.Attribute{Key: api.AttrReasoningTokens, Value: usage.ReasoningTokens})
+		}
+		if usage.Currency != "" {
+			attrs = append(attrs, api.Attribute{Key: api.AttrCostCurrency, Value: usage.Currency})
+		}
+		k.span.SetAttributes(attrs...)
+	}
+}
+
+// finish reports the call to the metrics sink and ends its span.
+func (k *call) finish(err error, timeToFirstByte time.Duration) {
+	state := k.retries
+	if k.client.metrics != nil && state.attempts > 0 {
+		k.client.metrics.RecordRequest(k.ctx, api.RequestMetrics{
+			Operation:       k.req.Operation,
+			Method:          k.req.Method,
+			Path:            k.path,
+			Model:           k.model,
+			Stream:          k.stream,
+			Attempts:        state.attempts,
+			StatusCode:      state.statusCode,
+			StatusClass:     api.StatusClass(state.statusCode),
+			Duration:        time.Since(state.start),
+			TimeToFirstByte: timeToFirstByte,
+			Err:             err,
+		})
+	}
+	if k.span != nil {
+		attrs := []api.Attribute{{Key: api.AttrAttempts, Value: state.attempts}}
+		if state.statusCode != 0 {
+			attrs = append(attrs, api.Attribute{Key: api.AttrStatusCode, Value: state.statusCode})
+		}
+		if state.requestID != "" {
+			attrs = append(attrs, api.Attribute{Key: api.AttrRequestID, Value: state.requestID})
+		}
+		if k.stream && timeToFirstByte > 0 {
+			attrs = append(attrs, api.Attribute{Key: api.AttrTimeToFirstByteMS, Value: float64(timeToFirstByte) / float64(time.Millisecond)})
+		}
+		k.span.SetAttributes(attrs...)
+		k.span.End(err)
+	}
+}
+
+// finishOnClose wraps a successful stream response so that the call is
+// finished, with its time to first byte, when the body is closed.
+func (k *call) finishOnClose(resp *http.Response) {
+	if k.client.metrics == nil && k.span == nil {
+		return
+	}
+	resp.Body = &callBody{ReadCloser: resp.Body, call: k}
+}
+
+// startAttempt starts the span of a single HTTP attempt.
+func (c *Client) startAttempt(ctx context.Context, req *Request, attempt int, retryReason string) (context.Context, api.Span) {
+	if c.tracer == nil {
+		return ctx, nil
+	}
+	attrs := []api.Attribute{
+		{Key: api.AttrMethod, Value: req.Method},
+		{Key: api.AttrPath, Value: req.Path},
+		{Key: api.AttrAttempt, Value: attempt},
+	}
+	if retryReason != "" {
+		attrs = append(attrs, api.Attribute{Key: api.AttrRetryReason, Value: retryReason})
+	}
+	return c.tracer.StartSpan(ctx, spanName(req)+".attempt", attrs...)
+}
+
+// endAttemptSpan ends the span of a single HTTP attempt.
+func endAttemptSpan(span api.Span, statusCode int, requestID string, err error) {
+	if span == nil {
+		return
+	}
+	if statusCode != 0 {
+		span.SetAttributes(api.Attribute{Key: api.AttrStatusCode, Value: statusCode})
+	}
+	if requestID != "" {
+		span.SetAttributes(api.Attribute{Key: api.AttrRequestID, Value: requestID})
+	}
+	if err == nil && statusCode >= 400 {
+		err = fmt.Errorf("status %d", statusCode)
+	}
+	span.End(err)
+}
+
+// retryReason describes why a failed attempt is retried.
+func retryReason(resp *Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	if resp != nil {
+		return fmt.Sprintf("status %d", resp.StatusCode)
+	}
+	return ""
+}
+
+// RecordUsage reports usage parsed from the stream to the metrics sink and
+// the call span. It must be called before the stream body is closed.
+func (r *StreamResponse) RecordUsage(usage api.UsageMetrics) {
+	if r.call != nil && r.call.observed() {
+		r.call.recordUsage(usage)
+	}
+}
+
+// callBody measures the time to first byte of a stream and finishes the call
+// when the stream is closed, with the error that ended the stream, if any.
+// Close may run concurrently with Read, so the time to first byte is atomic
+// and the read error is guarded by mu. Read errors caused by Close itself are
+// not recorded.
+type callBody struct {
+	io.ReadCloser
+	call    *call
+	ttfb    atomic.Int64
+	closing atomic.Bool
+	closed  sync.Once
+
+	mu  sync.Mutex
+	err error
+}
+
+func (b *callBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && b.ttfb.Load() == 0 {
+		b.ttfb.CompareAndSwap(0, int64(time.Since(b.call.retries.start)))
+	}
+	if err != nil && err != io.EOF && !b.closing.Load() {
+		b.mu.Lock()
+		if b.err == nil {
+			b.err = err
+		}
+		b.mu.Unlock()
+	}
+	return n, err
+}
+
+func (b *callBody) Close() error {
+	b.closing.Store(true)
+	err := b.ReadCloser.Close()
+	b.closed.Do(func() {
+		b.mu.Lock()
+		readErr := b.err
+		b.mu.Unlock()
+		b.call.finish(readErr, time.Duration(b.ttfb.Load()))
+	})
+	return err
+}
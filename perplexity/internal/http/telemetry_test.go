@@ -0,0 +1,315 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity/api"
+)
+
+type recordingMetrics struct {
+	mu       sync.Mutex
+	requests []api.RequestMetrics
+	usage    []api.UsageMetrics
+}
+
+func (m *recordingMetrics) RecordRequest(ctx context.Context, r api.RequestMetrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = append(m.requests, r)
+}
+
+func (m *recordingMetrics) RecordUsage(ctx context.Context, u api.UsageMetrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.usage = append(m.usage, u)
+}
+
+func TestClient_Metrics(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	metrics := &recordingMetrics{}
+	client := NewClient(server.Client(), server.URL, "test-key", 2, nil, "test-agent", nil)
+	client.SetRetryPolicy(&api.ExponentialBackoff{InitialDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	client.SetMetrics(metrics)
+
+	_, err := client.Do(context.Background(), &Request{
+		Operation: "chat.create",
+		Method:    "POST",
+		Path:      "/chat/completions?x=1",
+		Body:      map[string]any{"model": "sonar"},
+	})
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+
+	if len(metrics.requests) != 1 {
+		t.Fatalf("Expected 1 request metric, got %d", len(metrics.requests))
+	}
+	got := metrics.requests[0]
+	if got.Operation != "chat.create" || got.Path != "/chat/completions" || got.Model != "sonar" {
+		t.Errorf("RequestMetrics = %+v", got)
+	}
+	if got.Attempts != 2 || got.StatusCode != 200 || got.StatusClass != "2xx" || got.Stream {
+		t.Errorf("RequestMetrics = %+v", got)
+	}
+	if got.Duration <= 0 || got.TimeToFirstByte != 0 || got.Err != nil {
+		t.Errorf("RequestMetrics = %+v", got)
+	}
+}
+
+func TestClient_MetricsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	metrics := &recordingMetrics{}
+	client := NewClient(server.Client(), server.URL, "test-key", 2, nil, "test-agent", nil)
+	client.SetMetrics(metrics)
+
+	_, err := client.DoStream(context.Background(), &Request{Method: "POST", Path: "/chat/completions"})
+	if err == nil {
+		t.Fatal("Expected error for 400 status")
+	}
+	if len(metrics.requests) != 1 {
+		t.Fatalf("Expected 1 request metric, got %d", len(metrics.requests))
+	}
+	got := metrics.requests[0]
+	if got.Attempts != 1 || got.StatusClass != "4xx" || !got.Stream || got.Err == nil {
+		t.Errorf("RequestMetrics = %+v", got)
+	}
+}
+
+func TestClient_MetricsStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(10 * time.Millisecond)
+		w.Write([]byte("data: {}\n\n"))
+	}))
+	defer server.Close()
+
+	metrics := &recordingMetrics{}
+	client := NewClient(server.Client(), server.URL, "test-key", 0, nil, "test-agent", nil)
+	client.SetMetrics(metrics)
+
+	resp, err := client.DoStream(context.Background(), &Request{Operation: "chat.create_stream", Method: "POST", Path: "/chat/completions"})
+	if err != nil {
+		t.Fatalf("DoStream() error = %v", err)
+	}
+	if len(metrics.requests) != 0 {
+		t.Fatal("Expected stream metrics to wait for Close")
+	}
+	io.Copy(io.Discard, resp.Response.Body)
+	resp.Response.Body.Close()
+	resp.Response.Body.Close()
+
+	if len(metrics.requests) != 1 {
+		t.Fatalf("Expected 1 request metric, got %d", len(metrics.requests))
+	}
+	got := metrics.requests[0]
+	if !got.Stream || got.Attempts != 1 || got.StatusClass != "2xx" {
+		t.Errorf("RequestMetrics = %+v", got)
+	}
+	if got.TimeToFirstByte < 10*time.Millisecond || got.Duration < got.TimeToFirstByte {
+		t.Errorf("TimeToFirstByte = %v, Duration = %v", got.TimeToFirstByte, got.Duration)
+	}
+}
+
+func TestClient_MetricsStreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Content-Length", "100")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("data: {}\n\n"))
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}))
+	defer server.Close()
+
+	metrics := &recordingMetrics{}
+	tracer := &recordingTracer{}
+	client := NewClient(server.Client(), server.URL, "test-key", 0, nil, "test-agent", nil)
+	client.SetMetrics(metrics)
+	client.SetTracer(tracer)
+
+	resp, err := client.DoStream(context.Background(), &Request{Operation: "chat.create_stream", Method: "POST", Path: "/chat/completions"})
+	if err != nil {
+		t.Fatalf("DoStream() error = %v", err)
+	}
+	if _, err := io.Copy(io.Discard, resp.Response.Body); err == nil {
+		t.Fatal("Expected the stream to fail partway through")
+	}
+	resp.Response.Body.Close()
+
+	if len(metrics.requests) != 1 {
+		t.Fatalf("Expected 1 request metric, got %d", len(metrics.requests))
+	}
+	if got := metrics.requests[0]; got.Err == nil || got.StatusClass != "2xx" {
+		t.Errorf("RequestMetrics = %+v, want the read error", got)
+	}
+	if span := tracer.spans[0]; !span.ended || span.err == nil {
+		t.Errorf("call span ended = %v, err = %v, want the read error", span.ended, span.err)
+	}
+}
+
+type spanKey struct{}
+
+type recordedSpan struct {
+	name   string
+	parent *recordedSpan
+	attrs  map[string]any
+	ended  bool
+	err    error
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...api.Attribute) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *recordedSpan) End(err error) {
+	s.ended = true
+	s.err = err
+}
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (tr *recordingTracer) StartSpan(ctx context.Context, name string, attrs ...api.Attribute) (context.Context, api.Span) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	parent, _ := ctx.Value(spanKey{}).(*recordedSpan)
+	span := &recordedSpan{name: name, parent: parent, attrs: map[string]any{}}
+	span.SetAttributes(attrs...)
+	tr.spans = append(tr.spans, span)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func TestClient_Tracing(t *testing.T) {
+	attempts := 0
+	var traceHeaders []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		traceHeaders = append(traceHeaders, r.Header.Get("Traceparent"))
+		w.Header().Set("X-Request-ID", fmt.Sprintf("req-%d", attempts))
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"usage":{"total_tokens":7}}`))
+	}))
+	defer server.Close()
+
+	tracer := &recordingTracer{}
+	client := NewClient(server.Client(), server.URL, "test-key", 2, nil, "test-agent", nil)
+	client.SetRetryPolicy(&api.ExponentialBackoff{InitialDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	client.SetTracer(tracer)
+	client.SetHeaderInjector(func(ctx context.Context, header http.Header) {
+		if span, ok := ctx.Value(spanKey{}).(*recordedSpan); ok {
+			header.Set("Traceparent", span.name+"/"+fmt.Sprint(span.attrs[api.AttrAttempt]))
+		}
+	})
+
+	_, err := client.Do(context.Background(), &Request{
+		Operation: "chat.create",
+		Method:    "POST",
+		Path:      "/chat/completions",
+		Body:      map[string]any{"model": "sonar"},
+		Usage: func(body []byte) *api.UsageMetrics {
+			var result struct {
+				Usage struct {
+					TotalTokens int `json:"total_tokens"`
+				} `json:"usage"`
+			}
+			if err := json.Unmarshal(body, &result); err != nil {
+				return nil
+			}
+			return &api.UsageMetrics{TotalTokens: result.Usage.TotalTokens}
+		},
+	})
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+
+	if len(tracer.spans) != 3 {
+		t.Fatalf("Expected 3 spans, got %d", len(tracer.spans))
+	}
+	parent, first, second := tracer.spans[0], tracer.spans[1], tracer.spans[2]
+	if parent.name != "chat.create" || parent.parent != nil || !parent.ended || parent.err != nil {
+		t.Errorf("parent span = %+v", parent)
+	}
+	if parent.attrs[api.AttrModel] != "sonar" || parent.attrs[api.AttrAttempts] != 2 || parent.attrs[api.AttrStatusCode] != 200 {
+		t.Errorf("parent attributes = %v", parent.attrs)
+	}
+	if parent.attrs[api.AttrRequestID] != "req-2" || parent.attrs[api.AttrTotalTokens] != 7 {
+		t.Errorf("parent attributes = %v", parent.attrs)
+	}
+	if first.parent != parent || second.parent != parent || !first.ended || !second.ended {
+		t.Error("attempt spans are not ended children of the call span")
+	}
+	if first.attrs[api.AttrStatusCode] != 503 || first.err == nil {
+		t.Errorf("first attempt = %+v", first)
+	}
+	if _, ok := first.attrs[api.AttrRetryReason]; ok {
+		t.Errorf("first attempt has a retry reason: %v", first.attrs)
+	}
+	if second.attrs[api.AttrRetryReason] != "status 503" || second.attrs[api.AttrAttempt] != 2 || second.err != nil {
+		t.Errorf("second attempt = %+v", second)
+	}
+	if traceHeaders[0] != "chat.create.attempt/1" || traceHeaders[1] != "chat.create.attempt/2" {
+		t.Errorf("trace headers = %v", traceHeaders)
+	}
+}
+
+func TestClient_TracingStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {}\n\n"))
+	}))
+	defer server.Close()
+
+	tracer := &recordingTracer{}
+	client := NewClient(server.Client(), server.URL, "test-key", 0, nil, "test-agent", nil)
+	client.SetTracer(tracer)
+
+	resp, err := client.DoStream(context.Background(), &Request{Operation: "chat.create_stream", Method: "POST", Path: "/chat/completions"})
+	if err != nil {
+		t.Fatalf("DoStream() error = %v", err)
+	}
+	parent := tracer.spans[0]
+	if parent.ended {
+		t.Fatal("Expected the call span to stay open while streaming")
+	}
+	io.Copy(io.Discard, resp.Response.Body)
+	resp.RecordUsage(api.UsageMetrics{InputTokens: 3, OutputTokens: 4})
+	resp.Response.Body.Close()
+
+	if !parent.ended || parent.attrs[api.AttrInputTokens] != 3 || parent.attrs[api.AttrOutputTokens] != 4 {
+		t.Errorf("parent span = %+v", parent)
+	}
+	if _, ok := parent.attrs[api.AttrTimeToFirstByteMS]; !ok {
+		t.Errorf("parent attributes = %v", parent.attrs)
+	}
+}
@@ -0,0 +1,209 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Timeouts holds the client-wide timeouts that are not covered by the
+// Timeout of the underlying http.Client. Zero values disable a timeout.
+type Timeouts struct {
+	// Connect limits the time from sending an attempt until its response
+	// headers arrive, including connection setup.
+	Connect time.Duration
+
+	// Stream limits the total duration of a stream, including reading its
+	// body. When zero, the Timeout of the http.Client is used.
+	Stream time.Duration
+
+	// StreamIdle limits the time a stream may go without receiving data.
+	StreamIdle time.Duration
+}
+
+// SetTimeouts sets the client-wide connect and stream timeouts.
+func (c *Client) SetTimeouts(timeouts Timeouts) {
+	c.timeouts = timeouts
+}
+
+// StallError reports that a stream received no data within its idle
+// timeout.
+type StallError struct {
+	IdleTimeout time.Duration
+}
+
+func (e *StallError) Error() string {
+	return fmt.Sprintf("stream stalled: no data received for %s", e.IdleTimeout)
+}
+
+// headerTimeoutError reports that the response headers of an attempt did not
+// arrive within the connect timeout. It is a net.Error, so the attempt is
+// retried like other timeouts.
+type headerTimeoutError struct {
+	timeout time.Duration
+}
+
+func (e *headerTimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s waiting for response headers", e.timeout)
+}
+
+func (e *headerTimeoutError) Timeout() bool   { return true }
+func (e *headerTimeoutError) Temporary() bool { return true }
+
+func (c *Client) connectTimeout(req *Request) time.Duration {
+	if req.Options.ConnectTimeout > 0 {
+		return req.Options.ConnectTimeout
+	}
+	return c.timeouts.Connect
+}
+
+// streamTimeout returns the total duration allowed for a stream. The
+// request's StreamTimeout takes precedence over its Timeout, followed by the
+// client's stream timeout and finally the http.Client timeout.
+func (c *Client) streamTimeout(req *Request) time.Duration {
+	switch {
+	case req.Options.StreamTimeout > 0:
+		return req.Options.StreamTimeout
+	case req.Options.Timeout > 0:
+		return req.Options.Timeout
+	case c.timeouts.Stream > 0:
+		return c.timeouts.Stream
+	default:
+		return c.httpClient.Timeout
+	}
+}
+
+func (c *Client) streamIdleTimeout(req *Request) time.Duration {
+	if req.Options.StreamIdleTimeout > 0 {
+		return req.Options.StreamIdleTimeout
+	}
+	return c.timeouts.StreamIdle
+}
+
+// streamHTTPClient returns the http.Client used for streams. Its Timeout is
+// cleared because the stream timeout is enforced through the request
+// context instead.
+func (c *Client) streamHTTPClient() *http.Client {
+	if c.httpClient.Timeout == 0 {
+		return c.httpClient
+	}
+	client := *c.httpClient
+	client.Timeout = 0
+	return &client
+}
+
+// attempt is the context of a single HTTP attempt.
+type attempt struct {
+	ctx         context.Context
+	cancel      context.CancelCauseFunc
+	stopTimeout context.CancelFunc
+	headerTimer *time.Timer
+	headerLimit time.Duration
+}
+
+// newAttempt derives the context of an attempt from ctx. The context ends
+// after total, if positive, and after headerLimit unless headersReceived is
+// called first.
+func newAttempt(ctx context.Context, total, headerLimit time.Duration) *attempt {
+	a := &attempt{headerLimit: headerLimit}
+	a.ctx, a.cancel = context.WithCancelCause(ctx)
+	if total > 0 {
+		a.ctx, a.stopTimeout = context.WithTimeout(a.ctx, total)
+	}
+	if headerLimit > 0 {
+		a.headerTimer = time.AfterFunc(headerLimit, func() {
+			a.cancel(&headerTimeoutError{timeout: headerLimit})
+		})
+	}
+	return a
+}
+
+// headersReceived stops the connect timeout. It reports whether the
+// response headers arrived in time.
+func (a *attempt) headersReceived() bool {
+	return a.headerTimer == nil || a.headerTimer.Stop()
+}
+
+// headerTimeout returns the error reported when the connect timeout fired.
+func (a *attempt) headerTimeout() error {
+	return &headerTimeoutError{timeout: a.headerLimit}
+}
+
+// release ends the attempt context.
+func (a *attempt) release() {
+	if a.stopTimeout != nil {
+		a.stopTimeout()
+	}
+	a.cancel(nil)
+}
+
+// attemptBody releases the attempt context of a stream when its body is
+// closed, and aborts the stream when a read waits longer than the idle
+// timeout for data.
+type attemptBody struct {
+	io.ReadCloser
+	attempt *attempt
+
+	idle      time.Duration
+	idleTimer *time.Timer
+	stalled   atomic.Bool
+	stallErr  error
+	closeOnce sync.Once
+}
+
+func (c *Client) newAttemptBody(body io.ReadCloser, a *attempt, idle time.Duration, requestID string) *attemptBody {
+	b := &attemptBody{ReadCloser: body, attempt: a, idle: idle}
+	if idle > 0 {
+		b.stallErr = c.wrapStallError(&StallError{IdleTimeout: idle}, requestID)
+		b.idleTimer = time.AfterFunc(idle, func() {
+			b.stalled.Store(true)
+			a.cancel(b.stallErr)
+		})
+		b.idleTimer.Stop()
+	}
+	return b
+}
+
+// Read arms the idle timer only while waiting for data, so a slow consumer
+// does not count as a stalled stream.
+func (b *attemptBody) Read(p []byte) (int, error) {
+	if b.idleTimer != nil {
+		if b.stalled.Load() {
+			return 0, b.stallErr
+		}
+		b.idleTimer.Reset(b.idle)
+	}
+	n, err := b.ReadCloser.Read(p)
+	if b.idleTimer != nil {
+		b.idleTimer.Stop()
+		if b.stalled.Load() {
+			return n, b.stallErr
+		}
+	}
+	return n, err
+}
+
+func (b *attemptBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.closeOnce.Do(func() {
+		if b.idleTimer != nil {
+			b.idleTimer.Stop()
+		}
+		b.attempt.release()
+	})
+	return err
+}
+
+func (c *Client) wrapStallError(err *StallError, requestID string) error {
+	if c.errorFactory == nil {
+		return err
+	}
+	if wrapped := c.errorFactory(ErrorKindStreamStall, 0, err.Error(), nil, requestID, err); wrapped != nil {
+		return wrapped
+	}
+	return err
+}
@@ -0,0 +1,184 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity/api"
+)
+
+// streamServer sends one SSE event every interval, count times.
+func streamServer(t *testing.T, interval time.Duration, count int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+		for i := 0; i < count; i++ {
+			io.WriteString(w, "data: {}\n\n")
+			flusher.Flush()
+			select {
+			case <-time.After(interval):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClient_ConnectTimeout(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(&http.Client{}, server.URL, "test-key", 1, nil, "test", nil)
+	client.SetRetryPolicy(&api.ExponentialBackoff{InitialDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	client.SetTimeouts(Timeouts{Connect: 50 * time.Millisecond})
+
+	resp, err := client.Do(context.Background(), &Request{Method: "GET", Path: "/test"})
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || attempts.Load() != 2 {
+		t.Errorf("status = %d, attempts = %d; want 200 after a retry", resp.StatusCode, attempts.Load())
+	}
+
+	attempts.Store(0)
+	_, err = client.Do(context.Background(), &Request{
+		Method:  "GET",
+		Path:    "/test",
+		Options: api.ApplyRequestOptions([]api.RequestOption{api.WithConnectTimeout(20 * time.Millisecond), api.WithMaxRetries(0)}),
+	})
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("Do() error = %v, want a timeout", err)
+	}
+}
+
+func TestClient_DoStream_RequestTimeoutCoversBody(t *testing.T) {
+	server := streamServer(t, 20*time.Millisecond, 5)
+	client := NewClient(&http.Client{}, server.URL, "test-key", 0, nil, "test", nil)
+
+	resp, err := client.DoStream(context.Background(), &Request{
+		Method:  "POST",
+		Path:    "/stream",
+		Options: api.ApplyRequestOptions([]api.RequestOption{api.WithTimeout(5 * time.Second)}),
+	})
+	if err != nil {
+		t.Fatalf("DoStream() error = %v", err)
+	}
+	defer resp.Response.Body.Close()
+
+	body, err := io.ReadAll(resp.Response.Body)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if !strings.HasSuffix(string(body), "data: [DONE]\n\n") {
+		t.Errorf("body = %q, want the complete stream", body)
+	}
+}
+
+func TestClient_DoStream_StreamTimeout(t *testing.T) {
+	server := streamServer(t, 30*time.Millisecond, 10)
+
+	// The http.Client timeout only applies to non-streaming requests once a
+	// stream timeout is set.
+	client := NewClient(&http.Client{Timeout: 50 * time.Millisecond}, server.URL, "test-key", 0, nil, "test", nil)
+	client.SetTimeouts(Timeouts{Stream: 5 * time.Second})
+	resp, err := client.DoStream(context.Background(), &Request{Method: "POST", Path: "/stream"})
+	if err != nil {
+		t.Fatalf("DoStream() error = %v", err)
+	}
+	if _, err := io.ReadAll(resp.Response.Body); err != nil {
+		t.Errorf("ReadAll() error = %v, want the stream to outlive the http.Client timeout", err)
+	}
+	resp.Response.Body.Close()
+
+	resp, err = client.DoStream(context.Background(), &Request{
+		Method:  "POST",
+		Path:    "/stream",
+		Options: api.ApplyRequestOptions([]api.RequestOption{api.WithStreamTimeout(100 * time.Millisecond)}),
+	})
+	if err != nil {
+		t.Fatalf("DoStream() error = %v", err)
+	}
+	defer resp.Response.Body.Close()
+	if _, err := io.ReadAll(resp.Response.Body); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ReadAll() error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestClient_DoStream_IdleTimeout(t *testing.T) {
+	server := streamServer(t, time.Second, 2)
+	stallErr := errors.New("stalled")
+	factory := func(kind ErrorKind, statusCode int, message string, body []byte, requestID string, cause error) error {
+		if kind == ErrorKindStreamStall {
+			var idle *StallError
+			if !errors.As(cause, &idle) || idle.IdleTimeout != 50*time.Millisecond {
+				t.Errorf("cause = %v", cause)
+			}
+			return stallErr
+		}
+		return nil
+	}
+	client := NewClient(&http.Client{}, server.URL, "test-key", 0, nil, "test", factory)
+	client.SetTimeouts(Timeouts{StreamIdle: 50 * time.Millisecond})
+
+	resp, err := client.DoStream(context.Background(), &Request{Method: "POST", Path: "/stream"})
+	if err != nil {
+		t.Fatalf("DoStream() error = %v", err)
+	}
+	defer resp.Response.Body.Close()
+
+	start := time.Now()
+	body, err := io.ReadAll(resp.Response.Body)
+	if !errors.Is(err, stallErr) {
+		t.Fatalf("ReadAll() error = %v, want the stall error", err)
+	}
+	if string(body) != "data: {}\n\n" {
+		t.Errorf("body = %q, want the first event", body)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("stall detected after %v", elapsed)
+	}
+}
+
+func TestClient_DoStream_IdleTimeoutSlowConsumer(t *testing.T) {
+	server := streamServer(t, 0, 3)
+	client := NewClient(&http.Client{}, server.URL, "test-key", 0, nil, "test", nil)
+
+	resp, err := client.DoStream(context.Background(), &Request{
+		Method:  "POST",
+		Path:    "/stream",
+		Options: api.ApplyRequestOptions([]api.RequestOption{api.WithStreamIdleTimeout(30 * time.Millisecond)}),
+	})
+	if err != nil {
+		t.Fatalf("DoStream() error = %v", err)
+	}
+	defer resp.Response.Body.Close()
+
+	// Time spent between reads does not count as idle time.
+	time.Sleep(100 * time.Millisecond)
+	if _, err := io.ReadAll(resp.Response.Body); err != nil {
+		t.Errorf("ReadAll() error = %v", err)
+	}
+}
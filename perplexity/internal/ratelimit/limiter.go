@@ -0,0 +1,266 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity/api"
+)
+
+// AllEndpoints is the endpoint key that applies to every path without a more
+// specific limit.
+const AllEndpoints = "*"
+
+// DefaultLimitWindow is the window of a limit header when the server does not
+// send a policy header with its window. Perplexity limits are expressed in
+// requests per minute.
+const DefaultLimitWindow = time.Minute
+
+// Limiter throttles requests with one token bucket per endpoint.
+// It is safe for concurrent use.
+type Limiter struct {
+	mu      sync.RWMutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+// New creates a limiter without any limits.
+func New() *Limiter {
+	return &Limiter{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// SetLimit configures the token bucket for an endpoint. The endpoint is an API
+// path such as "/chat/completions" and also matches sub-paths; AllEndpoints
+// matches every path without a more specific limit.
+func (l *Limiter) SetLimit(endpoint string, rps float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buckets[endpoint] = &bucket{
+		rate:     rps,
+		burst:    float64(burst),
+		maxRate:  rps,
+		maxBurst: float64(burst),
+		tokens:   float64(burst),
+		last:     l.now(),
+	}
+}
+
+// Wait blocks until a request to path may be sent or ctx is done.
+func (l *Limiter) Wait(ctx context.Context, path string) error {
+	b := l.bucketFor(path)
+	if b == nil {
+		return nil
+	}
+	delay := b.reserve(l.now())
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		return ctx.Err()
+	}
+}
+
+// Observe updates the bucket for path from the rate limit headers of a
+// response. A limit header sets the rate to the limit per window, read from
+// the policy header or DefaultLimitWindow, and the burst to the limit, both
+// capped by the values set with SetLimit. A 429 response, or a response
+// reporting no remaining requests, pauses the bucket until the server says
+// the limit resets. Paths without a bucket are ignored.
+func (l *Limiter) Observe(path string, statusCode int, headers http.Header) {
+	b := l.bucketFor(path)
+	if b == nil {
+		return
+	}
+	now := l.now()
+
+	if limit, ok := headerInt(headers, "x-ratelimit-limit-requests", "x-ratelimit-limit", "ratelimit-limit"); ok && limit > 0 {
+		window := headerWindow(headers, "x-ratelimit-policy", "ratelimit-policy")
+		b.setLimit(float64(limit)/window.Seconds(), float64(limit), now)
+	}
+
+	remaining, hasRemaining := headerInt(headers, "x-ratelimit-remaining-requests", "x-ratelimit-remaining", "ratelimit-remaining")
+	reset, hasReset := headerReset(headers, now, "x-ratelimit-reset-requests", "x-ratelimit-reset", "ratelimit-reset")
+
+	if statusCode == http.StatusTooManyRequests {
+		if retryAfter, ok := api.ParseRetryAfter(headers); ok && retryAfter > 0 {
+			b.block(now.Add(retryAfter))
+			return
+		}
+		if hasReset {
+			b.block(now.Add(reset))
+			return
+		}
+		b.limitTokens(0)
+		return
+	}
+
+	if hasRemaining {
+		if remaining <= 0 && hasReset {
+			b.block(now.Add(reset))
+			return
+		}
+		b.limitTokens(float64(remaining))
+	}
+}
+
+func (l *Limiter) bucketFor(path string) *bucket {
+	if l == nil {
+		return nil
+	}
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var match *bucket
+	matchLen := -1
+	for endpoint, b := range l.buckets {
+		if endpoint == AllEndpoints {
+			continue
+		}
+		if path == endpoint || strings.HasPrefix(path, strings.TrimSuffix(endpoint, "/")+"/") {
+			if len(endpoint) > matchLen {
+				match, matchLen = b, len(endpoint)
+			}
+		}
+	}
+	if match == nil {
+		match = l.buckets[AllEndpoints]
+	}
+	return match
+}
+
+// bucket is a token bucket that hands out reservations. Tokens may go
+// negative, in which case callers wait for the deficit to refill. The rate
+// and burst follow the server's limit up to maxRate and maxBurst.
+type bucket struct {
+	mu       sync.Mutex
+	rate     float64
+	burst    float64
+	maxRate  float64
+	maxBurst float64
+	tokens   float64
+	last     time.Time
+}
+
+func (b *bucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+func (b *bucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	b.tokens--
+
+	var delay time.Duration
+	if b.last.After(now) {
+		delay = b.last.Sub(now)
+	}
+	if b.tokens < 0 {
+		delay += time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	return delay
+}
+
+func (b *bucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
+
+// block pauses the bucket until the given time, after which a single request
+// may proceed and the rest refill at the configured rate.
+func (b *bucket) block(until time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if until.After(b.last) {
+		b.last = until
+	}
+	b.tokens = math.Min(b.tokens, 1)
+}
+
+// setLimit changes the rate and burst to the server's limit, capped by the
+// configured ones.
+func (b *bucket) setLimit(rate, burst float64, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	b.rate = math.Min(b.maxRate, rate)
+	b.burst = math.Max(1, math.Min(b.maxBurst, burst))
+	b.tokens = math.Min(b.tokens, b.burst)
+}
+
+func (b *bucket) limitTokens(limit float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.tokens, limit)
+}
+
+func headerInt(headers http.Header, keys ...string) (int, bool) {
+	for _, key := range keys {
+		if value := headers.Get(key); value != "" {
+			if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+				return n, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// headerWindow reads the window of the first policy of a policy header, such
+// as "100;w=60", in seconds. It returns DefaultLimitWindow if there is none.
+func headerWindow(headers http.Header, keys ...string) time.Duration {
+	for _, key := range keys {
+		policy, _, _ := strings.Cut(headers.Get(key), ",")
+		for _, param := range strings.Split(policy, ";")[1:] {
+			name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || name != "w" {
+				continue
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				return time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+	return DefaultLimitWindow
+}
+
+// headerReset parses a reset header expressed as seconds, a Go duration such
+// as "1m30s", or a Unix timestamp.
+func headerReset(headers http.Header, now time.Time, keys ...string) (time.Duration, bool) {
+	for _, key := range keys {
+		value := strings.TrimSpace(headers.Get(key))
+		if value == "" {
+			continue
+		}
+		if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+			if seconds > 1e9 {
+				return time.Unix(int64(seconds), 0).Sub(now), true
+			}
+			return time.Duration(seconds * float64(time.Second)), true
+		}
+		if d, err := time.ParseDuration(value); err == nil {
+			return d, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,173 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func newTestLimiter() (*Limiter, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	limiter := New()
+	limiter.now = clock.Now
+	return limiter, clock
+}
+
+func TestLimiter_Reserve(t *testing.T) {
+	limiter, _ := newTestLimiter()
+	limiter.SetLimit("/chat/completions", 2, 2)
+
+	b := limiter.bucketFor("/chat/completions")
+	want := []time.Duration{0, 0, 500 * time.Millisecond, time.Second}
+	for i, expected := range want {
+		if got := b.reserve(limiter.now()); got != expected {
+			t.Errorf("reserve #%d = %v, want %v", i, got, expected)
+		}
+	}
+}
+
+func TestLimiter_Refill(t *testing.T) {
+	limiter, clock := newTestLimiter()
+	limiter.SetLimit("/search", 1, 1)
+
+	b := limiter.bucketFor("/search")
+	if got := b.reserve(clock.now); got != 0 {
+		t.Fatalf("first reserve = %v, want 0", got)
+	}
+	clock.now = clock.now.Add(time.Second)
+	if got := b.reserve(clock.now); got != 0 {
+		t.Errorf("reserve after refill = %v, want 0", got)
+	}
+}
+
+func TestLimiter_BucketFor(t *testing.T) {
+	limiter, _ := newTestLimiter()
+	limiter.SetLimit("/async/chat/completions", 1, 1)
+	limiter.SetLimit("/chat/completions", 1, 1)
+	limiter.SetLimit(AllEndpoints, 1, 1)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/chat/completions", "/chat/completions"},
+		{"/async/chat/completions/req-1?local_mode=true", "/async/chat/completions"},
+		{"/chat/completions-beta", AllEndpoints},
+		{"/search", AllEndpoints},
+	}
+	for _, tt := range tests {
+		if got := limiter.bucketFor(tt.path); got != limiter.buckets[tt.want] {
+			t.Errorf("bucketFor(%q) did not match %q", tt.path, tt.want)
+		}
+	}
+
+	if New().bucketFor("/search") != nil {
+		t.Error("Expected no bucket without limits")
+	}
+	var nilLimiter *Limiter
+	if err := nilLimiter.Wait(context.Background(), "/search"); err != nil {
+		t.Errorf("nil limiter Wait() error = %v", err)
+	}
+}
+
+func TestLimiter_ObserveRetryAfter(t *testing.T) {
+	limiter, clock := newTestLimiter()
+	limiter.SetLimit("/chat/completions", 10, 10)
+
+	headers := http.Header{}
+	headers.Set("retry-after", "3")
+	limiter.Observe("/chat/completions", http.StatusTooManyRequests, headers)
+
+	b := limiter.bucketFor("/chat/completions")
+	if got := b.reserve(clock.now); got != 3*time.Second {
+		t.Errorf("first reserve after 429 = %v, want 3s", got)
+	}
+	if got := b.reserve(clock.now); got != 3*time.Second+100*time.Millisecond {
+		t.Errorf("second reserve after 429 = %v, want 3.1s", got)
+	}
+}
+
+func TestLimiter_ObserveRemaining(t *testing.T) {
+	limiter, clock := newTestLimiter()
+	limiter.SetLimit("/search", 1, 5)
+
+	headers := http.Header{}
+	headers.Set("x-ratelimit-remaining", "1")
+	limiter.Observe("/search", http.StatusOK, headers)
+
+	b := limiter.bucketFor("/search")
+	if got := b.reserve(clock.now); got != 0 {
+		t.Errorf("reserve with remaining = %v, want 0", got)
+	}
+	if got := b.reserve(clock.now); got != time.Second {
+		t.Errorf("reserve past remaining = %v, want 1s", got)
+	}
+
+	headers = http.Header{}
+	headers.Set("x-ratelimit-remaining-requests", "0")
+	headers.Set("x-ratelimit-reset-requests", "1m0s")
+	limiter.Observe("/search", http.StatusOK, headers)
+	if got := b.reserve(clock.now); got < time.Minute {
+		t.Errorf("reserve after exhausted limit = %v, want at least 1m", got)
+	}
+}
+
+func TestLimiter_ObserveLimit(t *testing.T) {
+	limiter, clock := newTestLimiter()
+	limiter.SetLimit("/search", 10, 20)
+	b := limiter.bucketFor("/search")
+
+	headers := http.Header{}
+	headers.Set("x-ratelimit-limit-requests", "6")
+	limiter.Observe("/search", http.StatusOK, headers)
+	if b.rate != 0.1 || b.burst != 6 {
+		t.Fatalf("rate, burst = %v, %v, want 0.1, 6 for 6 requests per minute", b.rate, b.burst)
+	}
+	for i := 0; i < 6; i++ {
+		if got := b.reserve(clock.now); got != 0 {
+			t.Fatalf("reserve %d = %v, want 0 within the burst", i, got)
+		}
+	}
+	if got := b.reserve(clock.now); got != 10*time.Second {
+		t.Errorf("reserve past the burst = %v, want 10s", got)
+	}
+
+	headers = http.Header{}
+	headers.Set("ratelimit-limit", "100")
+	headers.Set("ratelimit-policy", "100;w=5, 1000;w=3600")
+	limiter.Observe("/search", http.StatusOK, headers)
+	if b.rate != 10 || b.burst != 20 {
+		t.Errorf("rate, burst = %v, %v, want the configured 10, 20 as upper bounds", b.rate, b.burst)
+	}
+
+	headers = http.Header{}
+	headers.Set("ratelimit-limit", "30")
+	headers.Set("ratelimit-policy", "30;w=10")
+	limiter.Observe("/search", http.StatusOK, headers)
+	if b.rate != 3 || b.burst != 20 {
+		t.Errorf("rate, burst = %v, %v, want 3, 20", b.rate, b.burst)
+	}
+}
+
+func TestLimiter_WaitCanceled(t *testing.T) {
+	limiter := New()
+	limiter.SetLimit("/search", 0.001, 1)
+
+	if err := limiter.Wait(context.Background(), "/search"); err != nil {
+		t.Fatalf("first Wait() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx, "/search"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait() error = %v, want context.DeadlineExceeded", err)
+	}
+}
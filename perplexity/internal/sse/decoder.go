@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
 )
 
@@ -19,13 +20,15 @@ type Event struct {
 	// ID is the event ID.
 	ID string
 
-	// Retry is the reconnection time in milliseconds.
+	// Retry is the reconnection time in milliseconds most recently set by
+	// the stream, or 0 if the stream has not set one.
 	Retry int
 }
 
 // Decoder decodes Server-Sent Events from a stream.
 type Decoder struct {
 	reader *bufio.Reader
+	retry  int
 }
 
 // NewDecoder creates a new SSE decoder.
@@ -38,7 +41,7 @@ func NewDecoder(r io.Reader) *Decoder {
 // Decode reads and decodes the next SSE event.
 // Returns io.EOF when the stream is closed.
 func (d *Decoder) Decode() (*Event, error) {
-	event := &Event{}
+	event := &Event{Retry: d.retry}
 	var dataLines []string
 
 	for {
@@ -94,12 +97,21 @@ func (d *Decoder) Decode() (*Event, error) {
 		case "id":
 			event.ID = value
 		case "retry":
-			// Parse retry as integer (not implemented for now)
-			event.Retry = 0
+			// Only values made of ASCII digits are valid.
+			if retry, err := strconv.Atoi(value); err == nil && retry >= 0 && value[0] != '+' {
+				d.retry = retry
+				event.Retry = retry
+			}
 		}
 	}
 }
 
+// Retry returns the reconnection time in milliseconds most recently set by
+// the stream, or 0 if it has not set one.
+func (d *Decoder) Retry() int {
+	return d.retry
+}
+
 // DecodeAll reads all events from the stream until EOF.
 func (d *Decoder) DecodeAll() ([]*Event, error) {
 	var events []*Event
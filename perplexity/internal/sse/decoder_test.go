@@ -72,6 +72,21 @@ func TestDecoder_Decode(t *testing.T) {
 				Data:  "something went wrong",
 			},
 		},
+		{
+			name:  "retry field",
+			input: "retry: 2500\ndata: hello\n\n",
+			want: &Event{
+				Data:  "hello",
+				Retry: 2500,
+			},
+		},
+		{
+			name:  "invalid retry field",
+			input: "retry: 2.5s\ndata: hello\n\n",
+			want: &Event{
+				Data: "hello",
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -97,10 +112,30 @@ func TestDecoder_Decode(t *testing.T) {
 			if got.ID != tt.want.ID {
 				t.Errorf("ID = %q, want %q", got.ID, tt.want.ID)
 			}
+			if got.Retry != tt.want.Retry {
+				t.Errorf("Retry = %d, want %d", got.Retry, tt.want.Retry)
+			}
 		})
 	}
 }
 
+func TestDecoder_RetryPersists(t *testing.T) {
+	decoder := NewDecoder(strings.NewReader("retry: 3000\n\ndata: first\n\nretry: +5\ndata: second\n\n"))
+
+	for _, want := range []string{"first", "second"} {
+		event, err := decoder.Decode()
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		if event.Data != want || event.Retry != 3000 {
+			t.Errorf("event = %+v, want %q with retry 3000", event, want)
+		}
+	}
+	if decoder.Retry() != 3000 {
+		t.Errorf("Retry() = %d, want 3000", decoder.Retry())
+	}
+}
+
 func TestDecoder_DecodeMultiple(t *testing.T) {
 	input := `data: first event
 
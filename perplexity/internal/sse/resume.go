@@ -0,0 +1,105 @@
+package sse
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity/api"
+)
+
+// DefaultRetry is the reconnection delay used until the server sets one
+// with a retry field.
+const DefaultRetry = time.Second
+
+// Resumer tracks the position of an event stream so that it can be reopened
+// after a dropped connection, with the Last-Event-ID of the last event
+// delivered, and without delivering any event twice.
+type Resumer struct {
+	// MaxReconnects is the number of times the stream may be reopened.
+	MaxReconnects int
+
+	// RequireID prevents reconnecting once an event without an ID has been
+	// delivered after the last event with one, since the server could not
+	// know where to resume.
+	RequireID bool
+
+	reconnects int
+	lastID     string
+	retry      time.Duration
+	seen       map[string]struct{}
+
+	// anonymous is set while an event without an ID has been delivered
+	// since lastID.
+	anonymous bool
+}
+
+// NewResumer returns a Resumer that reopens a stream up to maxReconnects
+// times.
+func NewResumer(maxReconnects int) *Resumer {
+	return &Resumer{MaxReconnects: maxReconnects, seen: make(map[string]struct{})}
+}
+
+// Observe records an event read from the stream. It reports whether the
+// event was already delivered before a reconnect and should be skipped.
+func (r *Resumer) Observe(event *Event) bool {
+	if event.Retry > 0 {
+		r.retry = time.Duration(event.Retry) * time.Millisecond
+	}
+	if event.ID == "" {
+		r.anonymous = true
+		return false
+	}
+	if _, ok := r.seen[event.ID]; ok {
+		return true
+	}
+	r.seen[event.ID] = struct{}{}
+	r.lastID = event.ID
+	r.anonymous = false
+	return false
+}
+
+// LastEventID returns the ID of the last event delivered.
+func (r *Resumer) LastEventID() string {
+	return r.lastID
+}
+
+// Reconnects returns the number of times the stream was reopened.
+func (r *Resumer) Reconnects() int {
+	return r.reconnects
+}
+
+// Wait reports whether a stream that failed with err should be reopened.
+// Only dropped connections and transport timeouts are resumed. When it
+// returns true, the server's reconnection delay has elapsed.
+func (r *Resumer) Wait(ctx context.Context, err error) bool {
+	if r == nil || r.reconnects >= r.MaxReconnects || !IsResumable(err) {
+		return false
+	}
+	if r.RequireID && r.anonymous {
+		return false
+	}
+	delay := r.retry
+	if delay == 0 {
+		delay = DefaultRetry
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return false
+	}
+	r.reconnects++
+	return true
+}
+
+// IsResumable reports whether a stream read error is a dropped connection
+// or transport timeout that reconnecting may recover from.
+func IsResumable(err error) bool {
+	if err == nil || err == io.EOF {
+		return false
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) || api.IsRetryableTransportError(err)
+}
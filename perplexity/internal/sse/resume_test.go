@@ -0,0 +1,74 @@
+package sse
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+var errReset = &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+
+func TestResumer_Observe(t *testing.T) {
+	r := NewResumer(1)
+
+	if r.Observe(&Event{ID: "1", Data: "a"}) || r.Observe(&Event{ID: "2", Data: "b"}) {
+		t.Fatal("new events reported as duplicates")
+	}
+	if !r.Observe(&Event{ID: "2", Data: "b"}) {
+		t.Error("repeated event not reported as duplicate")
+	}
+	if r.LastEventID() != "2" {
+		t.Errorf("LastEventID() = %q, want 2", r.LastEventID())
+	}
+}
+
+func TestResumer_Wait(t *testing.T) {
+	ctx := context.Background()
+
+	r := NewResumer(1)
+	r.Observe(&Event{ID: "1", Retry: 10})
+	for _, err := range []error{io.EOF, context.Canceled, errors.New("bad json")} {
+		if r.Wait(ctx, err) {
+			t.Errorf("Wait(%v) = true", err)
+		}
+	}
+	start := time.Now()
+	if !r.Wait(ctx, io.ErrUnexpectedEOF) {
+		t.Fatal("Wait() = false for a dropped connection")
+	}
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Errorf("retry delay not honored, elapsed %v", elapsed)
+	}
+	if r.Wait(ctx, errReset) || r.Reconnects() != 1 {
+		t.Errorf("reconnected past MaxReconnects, Reconnects() = %d", r.Reconnects())
+	}
+
+	anonymous := NewResumer(3)
+	anonymous.RequireID = true
+	anonymous.Observe(&Event{Data: "no id", Retry: 1})
+	if anonymous.Wait(ctx, errReset) {
+		t.Error("Wait() = true after events without IDs")
+	}
+
+	trailing := NewResumer(3)
+	trailing.RequireID = true
+	trailing.Observe(&Event{ID: "1", Data: "first", Retry: 1})
+	trailing.Observe(&Event{Data: "no id"})
+	if trailing.Wait(ctx, errReset) {
+		t.Error("Wait() = true after an event without an ID followed the last ID")
+	}
+	trailing.Observe(&Event{ID: "2", Data: "second"})
+	if !trailing.Wait(ctx, errReset) {
+		t.Error("Wait() = false once an event with an ID followed the anonymous one")
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if NewResumer(1).Wait(canceled, errReset) {
+		t.Error("Wait() = true with a canceled context")
+	}
+}
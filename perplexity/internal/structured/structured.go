@@ -0,0 +1,82 @@
+// Package structured parses structured output replies into Go values.
+package structured
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity/jsonschema"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/types"
+)
+
+// DefaultRetries is the number of times a reply that cannot be parsed is
+// requested again.
+const DefaultRetries = 2
+
+// Extract returns the JSON document of a reply, without <think> blocks and
+// markdown code fences around it.
+func Extract(content string) string {
+	content = StripThink(content)
+	if start := strings.Index(content, "```"); start >= 0 {
+		fenced := content[start+3:]
+		// Skip the language of the fence, such as json.
+		if newline := strings.IndexByte(fenced, '\n'); newline >= 0 && !strings.ContainsAny(fenced[:newline], "{[") {
+			fenced = fenced[newline+1:]
+		}
+		if end := strings.Index(fenced, "```"); end >= 0 {
+			fenced = fenced[:end]
+		}
+		content = fenced
+	}
+	return strings.TrimSpace(content)
+}
+
+// StripThink removes <think> blocks from a reply. A block that is not closed
+// removes the rest of the reply.
+func StripThink(content string) string {
+	_, answer := types.SplitThink(content)
+	return answer
+}
+
+// Decode parses the JSON document of a reply into a new T and validates it
+// against schema.
+func Decode[T any](content string, schema map[string]interface{}) (T, error) {
+	var value T
+	document := Extract(content)
+	if document == "" {
+		return value, fmt.Errorf("reply contains no JSON")
+	}
+	if err := json.Unmarshal([]byte(document), &value); err != nil {
+		return value, fmt.Errorf("failed to parse reply: %w", err)
+	}
+	if err := jsonschema.Validate(schema, []byte(document)); err != nil {
+		return value, err
+	}
+	return value, nil
+}
+
+// Feedback returns the message asking the model to correct a reply.
+func Feedback(err error) string {
+	return fmt.Sprintf("Your previous reply could not be used: %v. Reply again with only a JSON document that matches the schema.", err)
+}
+
+// SchemaName returns the schema name for T, derived from its type name.
+func SchemaName[T any]() string {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	name := t.Name()
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		name = name[:i]
+	}
+	if name == "" {
+		return "response"
+	}
+	runes := []rune(name)
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
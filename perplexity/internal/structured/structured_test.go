@@ -0,0 +1,86 @@
+package structured
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"plain", ` {"a":1} `, `{"a":1}`},
+		{"think", "<think>Let me see.</think>\n{\"a\":1}", `{"a":1}`},
+		{"two thinks", "<think>a</think>{\"a\":<think>b</think>1}", `{"a":1}`},
+		{"unclosed think", "{\"a\":1}<think>more", `{"a":1}`},
+		{"fence", "Here it is:\n```json\n{\"a\":1}\n```\nDone.", `{"a":1}`},
+		{"bare fence", "```\n[1,2]\n```", `[1,2]`},
+		{"inline fence", "```{\"a\":1}```", `{"a":1}`},
+		{"think and fence", "<think>```x```</think>```json\n{\"a\":1}\n```", `{"a":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Extract(tt.content); got != tt.want {
+				t.Errorf("Extract() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+type city struct {
+	Name  string `json:"name"`
+	Stops []struct {
+		Day int `json:"day"`
+	} `json:"stops"`
+}
+
+func TestDecode(t *testing.T) {
+	schema := map[string]interface{}{
+		"type":     "object",
+		"required": []string{"name", "stops"},
+		"properties": map[string]interface{}{
+			"name": map[string]interface{}{"type": "string"},
+			"stops": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type":     "object",
+					"required": []string{"day"},
+				},
+			},
+		},
+	}
+
+	value, err := Decode[city]("```json\n{\"name\":\"Paris\",\"stops\":[{\"day\":1}]}\n```", schema)
+	if err != nil || value.Name != "Paris" || len(value.Stops) != 1 {
+		t.Fatalf("Decode() = %+v, %v", value, err)
+	}
+
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"", "no JSON"},
+		{"{\"name\":", "failed to parse reply"},
+		{`{"name":"Paris"}`, `$: missing required property "stops"`},
+		{`{"name":"Paris","stops":[{"day":1},{}]}`, `$.stops[1]: missing required property "day"`},
+	}
+	for _, tt := range tests {
+		if _, err := Decode[city](tt.content, schema); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Decode(%q) error = %v, want %q", tt.content, err, tt.want)
+		}
+	}
+}
+
+func TestSchemaName(t *testing.T) {
+	if got := SchemaName[city](); got != "city" {
+		t.Errorf("SchemaName[city]() = %q", got)
+	}
+	if got := SchemaName[[]*city](); got != "city" {
+		t.Errorf("SchemaName[[]*city]() = %q", got)
+	}
+	if got := SchemaName[map[string]int](); got != "response" {
+		t.Errorf("SchemaName[map]() = %q", got)
+	}
+}
@@ -0,0 +1,47 @@
+// Package jsonschema generates JSON Schemas from Go types.
+//
+// The schemas are plain map[string]interface{} values, ready to be used as
+// tool parameters, chat.JSONSchema schemas, responses.FunctionTool
+// parameters and responses.JSONSchemaFormat schemas.
+//
+// # Struct Fields
+//
+// Property names follow the json tags of a struct, and fields are handled
+// like encoding/json handles them: unexported fields and fields tagged "-"
+// are skipped, and embedded structs are flattened. A field is required
+// unless it is a pointer or its json tag has omitempty.
+//
+// The jsonschema tag adds keywords to a field, separated by commas:
+//
+//	type Weather struct {
+//		City  string   `json:"city" jsonschema:"description=Name of the city"`
+//		Unit  string   `json:"unit,omitempty" jsonschema:"enum=celsius|fahrenheit,default=celsius"`
+//		Days  int      `json:"days" jsonschema:"minimum=1,maximum=7"`
+//		Notes *string  `json:"notes" jsonschema:"required"`
+//		Tags  []string `json:"tags" jsonschema:"maxItems=5,enum=news|sport"`
+//	}
+//
+// The supported keywords are description, title, format, pattern, enum,
+// default, minimum, maximum, minLength, maxLength, minItems and maxItems,
+// along with the flags required and optional. Enum values are separated by
+// "|" or given with repeated enum keywords, and apply to the items of slices.
+// A comma inside a value is escaped as "\,".
+//
+// # Strict Mode
+//
+// With WithStrict, every object sets additionalProperties to false and lists
+// all of its properties as required, as strict structured outputs expect.
+// Optional properties then also accept null.
+//
+// A type can describe its own schema by implementing Schemer.
+//
+// # Validation
+//
+// Validate checks a JSON document against a schema, whether generated by
+// this package or decoded from JSON, without third-party dependencies. It
+// supports the subset of JSON Schema accepted for structured outputs and
+// reports every mismatch with its path:
+//
+//	err := jsonschema.Validate(schema, output)
+//	// $.days: value 9 is greater than the maximum 7; $.unit: value "kelvin" is not one of ["celsius","fahrenheit"]
+package jsonschema
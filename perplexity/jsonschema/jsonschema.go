@@ -0,0 +1,422 @@
+package jsonschema
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity/types"
+)
+
+// Schemer is implemented by types that describe their own schema.
+type Schemer interface {
+	JSONSchema() map[string]interface{}
+}
+
+// Option configures schema generation.
+type Option func(*generator)
+
+// WithStrict generates schemas for strict mode: objects do not allow
+// additional properties and list every property as required, with optional
+// properties made nullable.
+func WithStrict() Option {
+	return func(g *generator) {
+		g.strict = true
+	}
+}
+
+// For returns the schema of T.
+func For[T any](opts ...Option) (map[string]interface{}, error) {
+	return Reflect(reflect.TypeOf((*T)(nil)).Elem(), opts...)
+}
+
+// MustFor is like For but panics if the schema cannot be generated. It is
+// meant for package-level tool definitions.
+func MustFor[T any](opts ...Option) map[string]interface{} {
+	schema, err := For[T](opts...)
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+// Of returns the schema of the type of v.
+func Of(v interface{}, opts ...Option) (map[string]interface{}, error) {
+	if v == nil {
+		return nil, fmt.Errorf("jsonschema: value is nil")
+	}
+	return Reflect(reflect.TypeOf(v), opts...)
+}
+
+// Reflect returns the schema of t.
+func Reflect(t reflect.Type, opts ...Option) (map[string]interface{}, error) {
+	g := &generator{visiting: make(map[reflect.Type]bool)}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g.schema(t)
+}
+
+// ToolParameters returns the schema of the struct type T as tool function
+// parameters.
+func ToolParameters[T any](opts ...Option) (types.ToolFunctionParameters, error) {
+	schema, err := For[T](opts...)
+	if err != nil {
+		return types.ToolFunctionParameters{}, err
+	}
+	if schema["type"] != "object" {
+		return types.ToolFunctionParameters{}, fmt.Errorf("jsonschema: tool parameters must be an object, got %v", schema["type"])
+	}
+
+	params := types.ToolFunctionParameters{Type: "object"}
+	params.Properties, _ = schema["properties"].(map[string]interface{})
+	params.Required, _ = schema["required"].([]string)
+	if additional, ok := schema["additionalProperties"].(bool); ok {
+		params.AdditionalProperties = &additional
+	}
+	return params, nil
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	rawMessageType    = reflect.TypeOf(json.RawMessage(nil))
+	schemerType       = reflect.TypeOf((*Schemer)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+type generator struct {
+	strict   bool
+	visiting map[reflect.Type]bool
+}
+
+func (g *generator) schema(t reflect.Type) (map[string]interface{}, error) {
+	if t.Kind() != reflect.Interface {
+		base := t
+		for base.Kind() == reflect.Pointer {
+			base = base.Elem()
+		}
+		if reflect.PointerTo(base).Implements(schemerType) {
+			// Copy the schema so that struct tags do not modify it.
+			schema := make(map[string]interface{})
+			for key, value := range reflect.New(base).Interface().(Schemer).JSONSchema() {
+				schema[key] = value
+			}
+			return schema, nil
+		}
+	}
+
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}, nil
+	case rawMessageType:
+		return map[string]interface{}{}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schema(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}, nil
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}, nil
+	case reflect.Interface:
+		return map[string]interface{}{}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}, nil
+		}
+		items, err := g.schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		schema := map[string]interface{}{"type": "array", "items": items}
+		if t.Kind() == reflect.Array {
+			schema["minItems"] = t.Len()
+			schema["maxItems"] = t.Len()
+		}
+		return schema, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String && !t.Key().Implements(textMarshalerType) {
+			return nil, fmt.Errorf("jsonschema: unsupported map key type %s", t.Key())
+		}
+		values, err := g.schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "object", "additionalProperties": values}, nil
+	case reflect.Struct:
+		return g.object(t)
+	default:
+		return nil, fmt.Errorf("jsonschema: unsupported type %s", t)
+	}
+}
+
+func (g *generator) object(t reflect.Type) (map[string]interface{}, error) {
+	if g.visiting[t] {
+		return nil, fmt.Errorf("jsonschema: recursive type %s is not supported", t)
+	}
+	g.visiting[t] = true
+	defer delete(g.visiting, t)
+
+	properties := make(map[string]interface{})
+	required := []string{}
+	if err := g.fields(t, properties, &required); err != nil {
+		return nil, err
+	}
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	if g.strict {
+		schema["additionalProperties"] = false
+	}
+	return schema, nil
+}
+
+// fields adds the properties of the fields of t, flattening embedded
+// structs the way encoding/json does.
+func (g *generator) fields(t reflect.Type, properties map[string]interface{}, required *[]string) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		jsonTag := field.Tag.Get("json")
+		if jsonTag == "-" {
+			continue
+		}
+		name, jsonOptions, _ := strings.Cut(jsonTag, ",")
+
+		fieldType := field.Type
+		if field.Anonymous && name == "" {
+			if fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				if err := g.fields(fieldType, properties, required); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		tag, err := parseTag(field.Tag.Get("jsonschema"))
+		if err != nil {
+			return fmt.Errorf("jsonschema: field %s.%s: %w", t, field.Name, err)
+		}
+
+		schema, err := g.schema(field.Type)
+		if err != nil {
+			return err
+		}
+		if hasOption(jsonOptions, "string") && isScalar(schema) {
+			schema = map[string]interface{}{"type": "string"}
+		}
+		if err := tag.apply(schema, field.Type); err != nil {
+			return fmt.Errorf("jsonschema: field %s.%s: %w", t, field.Name, err)
+		}
+
+		optional := field.Type.Kind() == reflect.Pointer || hasOption(jsonOptions, "omitempty")
+		if tag.required {
+			optional = false
+		}
+		if tag.optional {
+			optional = true
+		}
+		if g.strict && optional {
+			schema = nullable(schema)
+		}
+		if g.strict || !optional {
+			*required = append(*required, name)
+		}
+		properties[name] = schema
+	}
+	return nil
+}
+
+func hasOption(options, option string) bool {
+	for options != "" {
+		var current string
+		current, options, _ = strings.Cut(options, ",")
+		if current == option {
+			return true
+		}
+	}
+	return false
+}
+
+func isScalar(schema map[string]interface{}) bool {
+	switch schema["type"] {
+	case "boolean", "integer", "number", "string":
+		return true
+	}
+	return false
+}
+
+// nullable returns a copy of schema that also accepts null.
+func nullable(schema map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(schema))
+	for key, value := range schema {
+		result[key] = value
+	}
+	switch kind := schema["type"].(type) {
+	case string:
+		result["type"] = []interface{}{kind, "null"}
+	case nil:
+		// A schema without a type already accepts null.
+	default:
+		return map[string]interface{}{"anyOf": []interface{}{schema, map[string]interface{}{"type": "null"}}}
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		result["enum"] = append(append([]interface{}(nil), enum...), nil)
+	}
+	return result
+}
+
+// tag holds the keywords of a jsonschema struct tag.
+type tag struct {
+	keywords [][2]string
+	enum     []string
+	required bool
+	optional bool
+}
+
+func parseTag(value string) (tag, error) {
+	var t tag
+	for _, part := range splitEscaped(value) {
+		if part == "" {
+			continue
+		}
+		key, val, hasValue := strings.Cut(part, "=")
+		switch {
+		case key == "required" && !hasValue:
+			t.required = true
+		case key == "optional" && !hasValue:
+			t.optional = true
+		case key == "enum":
+			t.enum = append(t.enum, strings.Split(val, "|")...)
+		case !hasValue:
+			return t, fmt.Errorf("keyword %q has no value", key)
+		default:
+			t.keywords = append(t.keywords, [2]string{key, val})
+		}
+	}
+	return t, nil
+}
+
+// splitEscaped splits value on commas that are not escaped with a
+// backslash.
+func splitEscaped(value string) []string {
+	var parts []string
+	var current strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value) && value[i+1] == ',':
+			current.WriteByte(',')
+			i++
+		case value[i] == ',':
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(value[i])
+		}
+	}
+	return append(parts, current.String())
+}
+
+func (t tag) apply(schema map[string]interface{}, fieldType reflect.Type) error {
+	// Enums of slices constrain their items.
+	target, valueType := schema, fieldType
+	for valueType.Kind() == reflect.Pointer {
+		valueType = valueType.Elem()
+	}
+	if items, ok := schema["items"].(map[string]interface{}); ok && len(t.enum) > 0 {
+		target, valueType = items, valueType.Elem()
+		for valueType.Kind() == reflect.Pointer {
+			valueType = valueType.Elem()
+		}
+	}
+	if len(t.enum) > 0 {
+		enum := make([]interface{}, 0, len(t.enum))
+		for _, raw := range t.enum {
+			value, err := parseValue(raw, target)
+			if err != nil {
+				return fmt.Errorf("enum: %w", err)
+			}
+			enum = append(enum, value)
+		}
+		target["enum"] = enum
+	}
+
+	for _, keyword := range t.keywords {
+		key, raw := keyword[0], keyword[1]
+		switch key {
+		case "description", "title", "format", "pattern":
+			schema[key] = raw
+		case "default":
+			value, err := parseValue(raw, schema)
+			if err != nil {
+				return fmt.Errorf("default: %w", err)
+			}
+			schema[key] = value
+		case "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum", "multipleOf":
+			value, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			schema[key] = number(value)
+		case "minLength", "maxLength", "minItems", "maxItems", "minProperties", "maxProperties":
+			value, err := strconv.Atoi(raw)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			schema[key] = value
+		default:
+			return fmt.Errorf("unknown keyword %q", key)
+		}
+	}
+	return nil
+}
+
+// parseValue converts a tag value to the JSON type of schema.
+func parseValue(raw string, schema map[string]interface{}) (interface{}, error) {
+	switch schema["type"] {
+	case "integer":
+		return strconv.ParseInt(raw, 10, 64)
+	case "number":
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, err
+		}
+		return number(value), nil
+	case "boolean":
+		return strconv.ParseBool(raw)
+	default:
+		return raw, nil
+	}
+}
+
+// number returns whole numbers as integers so that they marshal without an
+// exponent.
+func number(value float64) interface{} {
+	if value == float64(int64(value)) {
+		return int64(value)
+	}
+	return value
+}
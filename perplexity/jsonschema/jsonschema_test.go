@@ -0,0 +1,202 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity/types"
+)
+
+type address struct {
+	Street string `json:"street"`
+	City   string `json:"city" jsonschema:"description=City name\\, in English"`
+}
+
+type Metadata struct {
+	Source string `json:"source,omitempty"`
+}
+
+type weatherRequest struct {
+	Metadata
+	Location   address           `json:"location"`
+	Unit       string            `json:"unit,omitempty" jsonschema:"enum=celsius|fahrenheit,default=celsius"`
+	Days       int               `json:"days" jsonschema:"minimum=1,maximum=7"`
+	Ratio      float64           `json:"ratio" jsonschema:"enum=0.5,enum=1.5"`
+	Note       *string           `json:"note"`
+	Forced     *string           `json:"forced" jsonschema:"required"`
+	Tags       []string          `json:"tags" jsonschema:"maxItems=3,enum=news|sport"`
+	Stops      []address         `json:"stops,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	At         time.Time         `json:"at" jsonschema:"optional"`
+	Any        interface{}       `json:"any,omitempty"`
+	ID         int64             `json:"id,string"`
+	Ignored    string            `json:"-"`
+	unexported string
+}
+
+func schemaJSON(t *testing.T, schema map[string]interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(schema)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	return string(data)
+}
+
+func TestFor(t *testing.T) {
+	schema, err := For[weatherRequest]()
+	if err != nil {
+		t.Fatalf("For failed: %v", err)
+	}
+
+	properties := schema["properties"].(map[string]interface{})
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"source", `{"type":"string"}`},
+		{"location", `{"properties":{"city":{"description":"City name, in English","type":"string"},"street":{"type":"string"}},"required":["street","city"],"type":"object"}`},
+		{"unit", `{"default":"celsius","enum":["celsius","fahrenheit"],"type":"string"}`},
+		{"days", `{"maximum":7,"minimum":1,"type":"integer"}`},
+		{"ratio", `{"enum":[0.5,1.5],"type":"number"}`},
+		{"note", `{"type":"string"}`},
+		{"forced", `{"type":"string"}`},
+		{"tags", `{"items":{"enum":["news","sport"],"type":"string"},"maxItems":3,"type":"array"}`},
+		{"stops", `{"items":{"properties":{"city":{"description":"City name, in English","type":"string"},"street":{"type":"string"}},"required":["street","city"],"type":"object"},"type":"array"}`},
+		{"labels", `{"additionalProperties":{"type":"string"},"type":"object"}`},
+		{"at", `{"format":"date-time","type":"string"}`},
+		{"any", `{}`},
+		{"id", `{"type":"string"}`},
+	}
+	for _, tt := range tests {
+		property, ok := properties[tt.name].(map[string]interface{})
+		if !ok {
+			t.Errorf("property %q missing", tt.name)
+			continue
+		}
+		if got := schemaJSON(t, property); got != tt.want {
+			t.Errorf("property %q = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+	if len(properties) != len(tests) {
+		t.Errorf("properties = %v, want %d properties", properties, len(tests))
+	}
+
+	required := strings.Join(schema["required"].([]string), ",")
+	if required != "location,days,ratio,forced,tags,id" {
+		t.Errorf("required = %s", required)
+	}
+	if _, ok := schema["additionalProperties"]; ok {
+		t.Error("additionalProperties set outside strict mode")
+	}
+}
+
+func TestFor_Strict(t *testing.T) {
+	type item struct {
+		Name  string  `json:"name"`
+		Count *int    `json:"count"`
+		Kind  *string `json:"kind" jsonschema:"enum=a|b"`
+	}
+	type order struct {
+		Items []item `json:"items"`
+	}
+
+	schema, err := For[order](WithStrict())
+	if err != nil {
+		t.Fatalf("For failed: %v", err)
+	}
+	want := `{"additionalProperties":false,"properties":{"items":{"items":{"additionalProperties":false,` +
+		`"properties":{"count":{"type":["integer","null"]},"kind":{"enum":["a","b",null],"type":["string","null"]},"name":{"type":"string"}},` +
+		`"required":["name","count","kind"],"type":"object"},"type":"array"}},"required":["items"],"type":"object"}`
+	if got := schemaJSON(t, schema); got != want {
+		t.Errorf("schema = %s\nwant %s", got, want)
+	}
+}
+
+type celsius float64
+
+func (celsius) JSONSchema() map[string]interface{} {
+	return map[string]interface{}{"type": "number", "minimum": -273.15}
+}
+
+func TestFor_Schemer(t *testing.T) {
+	type reading struct {
+		Temperature celsius  `json:"temperature" jsonschema:"description=Temperature"`
+		Previous    *celsius `json:"previous"`
+	}
+	schema, err := For[reading]()
+	if err != nil {
+		t.Fatalf("For failed: %v", err)
+	}
+	properties := schema["properties"].(map[string]interface{})
+	if got := schemaJSON(t, properties["temperature"].(map[string]interface{})); got != `{"description":"Temperature","minimum":-273.15,"type":"number"}` {
+		t.Errorf("temperature = %s", got)
+	}
+	if _, ok := properties["previous"].(map[string]interface{})["description"]; ok {
+		t.Error("tag of one field leaked into the shared schema")
+	}
+}
+
+func TestFor_Errors(t *testing.T) {
+	type node struct {
+		Children []node `json:"children"`
+	}
+	type badTag struct {
+		Days int `json:"days" jsonschema:"minimum=one"`
+	}
+	type unknownKeyword struct {
+		Days int `json:"days" jsonschema:"minimum=1,color=red"`
+	}
+	type channel struct {
+		C chan int `json:"c"`
+	}
+
+	tests := []struct {
+		name string
+		fn   func() error
+		want string
+	}{
+		{"recursive", func() error { _, err := For[node](); return err }, "recursive type"},
+		{"bad value", func() error { _, err := For[badTag](); return err }, "badTag.Days: minimum"},
+		{"unknown keyword", func() error { _, err := For[unknownKeyword](); return err }, `unknown keyword "color"`},
+		{"unsupported", func() error { _, err := For[channel](); return err }, "unsupported type chan int"},
+		{"nil", func() error { _, err := Of(nil); return err }, "value is nil"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.fn(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolParameters(t *testing.T) {
+	type args struct {
+		Query string `json:"query" jsonschema:"description=Search query"`
+		Limit *int   `json:"limit"`
+	}
+	params, err := ToolParameters[args](WithStrict())
+	if err != nil {
+		t.Fatalf("ToolParameters failed: %v", err)
+	}
+
+	tool := types.Tool{
+		Type:     types.ToolTypeFunction,
+		Function: types.ToolFunction{Name: "search", Parameters: params},
+	}
+	data, err := json.Marshal(tool.Function.Parameters)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	want := `{"properties":{"limit":{"type":["integer","null"]},"query":{"description":"Search query","type":"string"}},"type":"object","additional_properties":false,"required":["query","limit"]}`
+	if string(data) != want {
+		t.Errorf("parameters = %s\nwant %s", data, want)
+	}
+
+	if _, err := ToolParameters[[]string](); err == nil {
+		t.Error("expected an error for non-object parameters")
+	}
+}
@@ -0,0 +1,416 @@
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidationError is a value that does not match its schema.
+type ValidationError struct {
+	// Path locates the value in the document, such as $.items[2].name.
+	Path string
+
+	// Message describes the mismatch.
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationErrors holds every mismatch found in a document.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Validate checks the JSON document data against schema. It returns a
+// ValidationErrors listing every mismatch, or an error if data is not valid
+// JSON.
+//
+// The supported keywords are type, properties, required,
+// additionalProperties, items, enum, const, anyOf, minimum, maximum,
+// exclusiveMinimum, exclusiveMaximum, multipleOf, minLength, maxLength,
+// pattern, minItems, maxItems, minProperties and maxProperties. Other
+// keywords are ignored.
+func Validate(schema map[string]interface{}, data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("jsonschema: invalid JSON: %w", err)
+	}
+	if decoder.More() {
+		return fmt.Errorf("jsonschema: invalid JSON: data after the top-level value")
+	}
+	return ValidateValue(schema, value)
+}
+
+// ValidateValue is like Validate for a value decoded from JSON, such as
+// the result of json.Unmarshal into an interface{}.
+func ValidateValue(schema map[string]interface{}, value interface{}) error {
+	v := &validator{patterns: make(map[string]*regexp.Regexp)}
+	v.validate(schema, value, "$")
+	if len(v.errors) > 0 {
+		return v.errors
+	}
+	return nil
+}
+
+type validator struct {
+	errors   ValidationErrors
+	patterns map[string]*regexp.Regexp
+}
+
+func (v *validator) fail(path, format string, args ...interface{}) {
+	v.errors = append(v.errors, &ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// matches reports whether value matches schema without recording errors.
+func (v *validator) matches(schema map[string]interface{}, value interface{}, path string) bool {
+	errors := v.errors
+	v.errors = nil
+	v.validate(schema, value, path)
+	ok := len(v.errors) == 0
+	v.errors = errors
+	return ok
+}
+
+func (v *validator) validate(schema map[string]interface{}, value interface{}, path string) {
+	if kinds := typeNames(schema["type"]); len(kinds) > 0 {
+		actual := typeOf(value)
+		allowed := false
+		for _, kind := range kinds {
+			if kind == actual || (kind == "number" && actual == "integer") {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			v.fail(path, "expected %s, got %s", strings.Join(kinds, " or "), actual)
+			return
+		}
+	}
+
+	if enum, ok := schema["enum"]; ok {
+		if values := toSlice(enum); !containsValue(values, value) {
+			v.fail(path, "value %s is not one of %s", encode(value), encode(values))
+		}
+	}
+	if constant, ok := schema["const"]; ok && !equalValues(constant, value) {
+		v.fail(path, "value %s is not %s", encode(value), encode(constant))
+	}
+	if anyOf, ok := schema["anyOf"]; ok {
+		matched := false
+		for _, option := range toSlice(anyOf) {
+			if option, ok := option.(map[string]interface{}); ok && v.matches(option, value, path) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.fail(path, "value does not match any schema of anyOf")
+		}
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		v.object(schema, value, path)
+	case []interface{}:
+		v.array(schema, value, path)
+	case string:
+		v.string(schema, value, path)
+	case json.Number:
+		v.number(schema, value, path)
+	case float64:
+		v.number(schema, json.Number(strconv.FormatFloat(value, 'g', -1, 64)), path)
+	}
+}
+
+func (v *validator) object(schema map[string]interface{}, value map[string]interface{}, path string) {
+	for _, name := range toStrings(schema["required"]) {
+		if _, ok := value[name]; !ok {
+			v.fail(path, "missing required property %q", name)
+		}
+	}
+	if limit, ok := toInt(schema["minProperties"]); ok && len(value) < limit {
+		v.fail(path, "expected at least %d properties, got %d", limit, len(value))
+	}
+	if limit, ok := toInt(schema["maxProperties"]); ok && len(value) > limit {
+		v.fail(path, "expected at most %d properties, got %d", limit, len(value))
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		propertyPath := PropertyPath(path, name)
+		if property, ok := properties[name]; ok {
+			if property, ok := property.(map[string]interface{}); ok {
+				v.validate(property, value[name], propertyPath)
+			}
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.fail(propertyPath, "additional property is not allowed")
+			}
+		case map[string]interface{}:
+			v.validate(additional, value[name], propertyPath)
+		}
+	}
+}
+
+func (v *validator) array(schema map[string]interface{}, value []interface{}, path string) {
+	if limit, ok := toInt(schema["minItems"]); ok && len(value) < limit {
+		v.fail(path, "expected at least %d items, got %d", limit, len(value))
+	}
+	if limit, ok := toInt(schema["maxItems"]); ok && len(value) > limit {
+		v.fail(path, "expected at most %d items, got %d", limit, len(value))
+	}
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		for i, item := range value {
+			v.validate(items, item, fmt.Sprintf("%s[%d]", path, i))
+		}
+	}
+}
+
+func (v *validator) string(schema map[string]interface{}, value string, path string) {
+	length := utf8.RuneCountInString(value)
+	if limit, ok := toInt(schema["minLength"]); ok && length < limit {
+		v.fail(path, "expected at least %d characters, got %d", limit, length)
+	}
+	if limit, ok := toInt(schema["maxLength"]); ok && length > limit {
+		v.fail(path, "expected at most %d characters, got %d", limit, length)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, ok := v.patterns[pattern]
+		if !ok {
+			var err error
+			if re, err = regexp.Compile(pattern); err != nil {
+				v.fail(path, "invalid pattern %q: %v", pattern, err)
+				return
+			}
+			v.patterns[pattern] = re
+		}
+		if !re.MatchString(value) {
+			v.fail(path, "value %q does not match pattern %q", value, pattern)
+		}
+	}
+}
+
+func (v *validator) number(schema map[string]interface{}, value json.Number, path string) {
+	n, err := value.Float64()
+	if err != nil {
+		v.fail(path, "invalid number %s", value)
+		return
+	}
+	if limit, ok := toFloat(schema["minimum"]); ok && n < limit {
+		v.fail(path, "value %s is less than the minimum %v", value, limit)
+	}
+	if limit, ok := toFloat(schema["maximum"]); ok && n > limit {
+		v.fail(path, "value %s is greater than the maximum %v", value, limit)
+	}
+	if limit, ok := toFloat(schema["exclusiveMinimum"]); ok && n <= limit {
+		v.fail(path, "value %s is not greater than %v", value, limit)
+	}
+	if limit, ok := toFloat(schema["exclusiveMaximum"]); ok && n >= limit {
+		v.fail(path, "value %s is not less than %v", value, limit)
+	}
+	if divisor, ok := toFloat(schema["multipleOf"]); ok && divisor > 0 {
+		quotient := n / divisor
+		if math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			v.fail(path, "value %s is not a multiple of %v", value, divisor)
+		}
+	}
+}
+
+// PropertyPath appends a property name to a path in the "$.a[0].b"
+// notation of ValidationError, quoting names that are not identifiers, as in
+// $["a b"].
+func PropertyPath(path, name string) string {
+	if name == "" {
+		return path + `[""]`
+	}
+	for i, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9') {
+			return fmt.Sprintf("%s[%q]", path, name)
+		}
+	}
+	return path + "." + name
+}
+
+// typeOf returns the JSON Schema type of a decoded JSON value.
+func typeOf(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case json.Number:
+		if _, err := value.Int64(); err == nil {
+			return "integer"
+		}
+		if f, err := value.Float64(); err == nil && f == math.Trunc(f) && !math.IsInf(f, 0) {
+			return "integer"
+		}
+		return "number"
+	case float64:
+		if value == math.Trunc(value) && !math.IsInf(value, 0) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// typeNames returns the types allowed by a type keyword.
+func typeNames(kind interface{}) []string {
+	if kind, ok := kind.(string); ok {
+		return []string{kind}
+	}
+	return toStrings(kind)
+}
+
+// toSlice converts a keyword value that holds a list, such as []string from
+// a generated schema or []interface{} from a decoded one.
+func toSlice(value interface{}) []interface{} {
+	if values, ok := value.([]interface{}); ok {
+		return values
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil
+	}
+	values := make([]interface{}, rv.Len())
+	for i := range values {
+		values[i] = rv.Index(i).Interface()
+	}
+	return values
+}
+
+func toStrings(value interface{}) []string {
+	if values, ok := value.([]string); ok {
+		return values
+	}
+	var values []string
+	for _, item := range toSlice(value) {
+		if item, ok := item.(string); ok {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch value := value.(type) {
+	case float64:
+		return value, true
+	case float32:
+		return float64(value), true
+	case int:
+		return float64(value), true
+	case int64:
+		return float64(value), true
+	case json.Number:
+		f, err := value.Float64()
+		return f, err == nil
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	}
+	return 0, false
+}
+
+func toInt(value interface{}) (int, bool) {
+	f, ok := toFloat(value)
+	return int(f), ok
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, candidate := range values {
+		if equalValues(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// equalValues compares JSON values, treating numbers of any Go type as
+// equal when their values are.
+func equalValues(a, b interface{}) bool {
+	if af, ok := toFloat(a); ok {
+		bf, ok := toFloat(b)
+		return ok && af == bf
+	}
+	if _, ok := toFloat(b); ok {
+		return false
+	}
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			other, ok := b[key]
+			if !ok || !equalValues(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equalValues(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if reflect.TypeOf(a) != reflect.TypeOf(b) || !reflect.TypeOf(a).Comparable() {
+		return false
+	}
+	return a == b
+}
+
+func encode(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
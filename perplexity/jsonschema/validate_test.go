@@ -0,0 +1,138 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	schema, err := For[weatherRequest](WithStrict())
+	if err != nil {
+		t.Fatalf("For failed: %v", err)
+	}
+	valid := `{"source":null,"location":{"street":"Rue de Rivoli","city":"Paris"},"unit":"celsius","days":3,` +
+		`"ratio":0.5,"note":null,"forced":"yes","tags":["news"],"stops":null,"labels":{"a":"b"},` +
+		`"at":"2024-01-01T00:00:00Z","any":[1,{"x":true}],"id":"42"}`
+	if err := Validate(schema, []byte(valid)); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		patch map[string]interface{}
+		want  []string
+	}{
+		{"wrong type", map[string]interface{}{"days": "3"}, []string{"$.days: expected integer, got string"}},
+		{"fraction", map[string]interface{}{"days": 2.5}, []string{"$.days: expected integer, got number"}},
+		{"minimum", map[string]interface{}{"days": 0}, []string{"$.days: value 0 is less than the minimum 1"}},
+		{"maximum", map[string]interface{}{"days": 8}, []string{"$.days: value 8 is greater than the maximum 7"}},
+		{"enum", map[string]interface{}{"unit": "kelvin"}, []string{`$.unit: value "kelvin" is not one of ["celsius","fahrenheit",null]`}},
+		{"number enum", map[string]interface{}{"ratio": 2}, []string{"$.ratio: value 2 is not one of [0.5,1.5]"}},
+		{"item enum", map[string]interface{}{"tags": []string{"news", "art"}}, []string{`$.tags[1]: value "art" is not one of ["news","sport"]`}},
+		{"max items", map[string]interface{}{"tags": []string{"news", "news", "news", "news"}}, []string{"$.tags: expected at most 3 items, got 4"}},
+		{"nested required", map[string]interface{}{"location": map[string]interface{}{"city": "Paris"}}, []string{`$.location: missing required property "street"`}},
+		{"additional", map[string]interface{}{"extra": 1, "my key": 2}, []string{"$.extra: additional property is not allowed", `$["my key"]: additional property is not allowed`}},
+		{"map values", map[string]interface{}{"labels": map[string]interface{}{"a": 1}}, []string{"$.labels.a: expected string, got integer"}},
+		{"not nullable", map[string]interface{}{"days": nil}, []string{"$.days: expected integer, got null"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var document map[string]interface{}
+			if err := json.Unmarshal([]byte(valid), &document); err != nil {
+				t.Fatal(err)
+			}
+			for key, value := range tt.patch {
+				document[key] = value
+			}
+			data, _ := json.Marshal(document)
+
+			err := Validate(schema, data)
+			var validationErrors ValidationErrors
+			if !errors.As(err, &validationErrors) {
+				t.Fatalf("error = %v, want ValidationErrors", err)
+			}
+			if got := strings.Split(err.Error(), "; "); strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("errors = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate_Keywords(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		data   string
+		want   string
+	}{
+		{"pattern", `{"type":"string","pattern":"^[A-Z]{3}$"}`, `"eur"`, `$: value "eur" does not match pattern "^[A-Z]{3}$"`},
+		{"min length", `{"type":"string","minLength":2}`, `"é"`, "$: expected at least 2 characters, got 1"},
+		{"max length", `{"type":"string","maxLength":2}`, `"abc"`, "$: expected at most 2 characters, got 3"},
+		{"exclusive minimum", `{"type":"number","exclusiveMinimum":0}`, `0`, "$: value 0 is not greater than 0"},
+		{"multiple of", `{"type":"number","multipleOf":0.5}`, `1.2`, "$: value 1.2 is not a multiple of 0.5"},
+		{"min items", `{"type":"array","minItems":1}`, `[]`, "$: expected at least 1 items, got 0"},
+		{"type list", `{"type":["string","null"]}`, `1`, "$: expected string or null, got integer"},
+		{"const", `{"const":"a"}`, `"b"`, `$: value "b" is not "a"`},
+		{"any of", `{"anyOf":[{"type":"string"},{"type":"array","items":{"type":"integer"}}]}`, `[1,"x"]`, "$: value does not match any schema of anyOf"},
+		{"additional schema", `{"type":"object","properties":{"a":{}},"additionalProperties":{"type":"boolean"}}`, `{"a":1,"b":1}`, "$.b: expected boolean, got integer"},
+		{"invalid pattern", `{"pattern":"("}`, `"x"`, `$: invalid pattern "("`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var schema map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.schema), &schema); err != nil {
+				t.Fatal(err)
+			}
+			err := Validate(schema, []byte(tt.data))
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	valid := map[string]string{
+		`{"type":"number","multipleOf":0.1}`:                                   `0.3`,
+		`{"type":"integer"}`:                                                   `2.0`,
+		`{"anyOf":[{"type":"string"},{"type":"null"}]}`:                        `null`,
+		`{"enum":[{"a":[1]},2]}`:                                               `{"a":[1.0]}`,
+		`{"type":"object","properties":{"a":{"type":"string"}},"required":[]}`: `{"b":1}`,
+	}
+	for schemaJSON, data := range valid {
+		var schema map[string]interface{}
+		if err := json.Unmarshal([]byte(schemaJSON), &schema); err != nil {
+			t.Fatal(err)
+		}
+		if err := Validate(schema, []byte(data)); err != nil {
+			t.Errorf("Validate(%s, %s) = %v", schemaJSON, data, err)
+		}
+	}
+}
+
+func TestValidate_InvalidJSON(t *testing.T) {
+	for _, data := range []string{`{"a":`, `{} {}`, ``} {
+		err := Validate(map[string]interface{}{"type": "object"}, []byte(data))
+		var validationErrors ValidationErrors
+		if err == nil || errors.As(err, &validationErrors) || !strings.Contains(err.Error(), "invalid JSON") {
+			t.Errorf("Validate(%q) = %v, want invalid JSON", data, err)
+		}
+	}
+}
+
+func TestPropertyPath(t *testing.T) {
+	for name, want := range map[string]string{
+		"name":    "$.name",
+		"_id2":    "$._id2",
+		"2fa":     `$["2fa"]`,
+		"a b":     `$["a b"]`,
+		"":        `$[""]`,
+		`quo"te`:  `$["quo\"te"]`,
+		"ümlaut":  `$["ümlaut"]`,
+		"snake_c": "$.snake_c",
+	} {
+		if got := PropertyPath("$", name); got != want {
+			t.Errorf("PropertyPath(%q) = %s, want %s", name, got, want)
+		}
+	}
+}
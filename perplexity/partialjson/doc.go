@@ -0,0 +1,25 @@
+// Package partialjson parses JSON documents while they are being streamed,
+// so that structured outputs can be shown before the response ends.
+//
+// A Parser receives the deltas of a chat stream with WriteChunk, of a
+// responses stream with WriteEvent, or raw text with Write. After each
+// delta, it holds the best-effort document received so far: open strings,
+// arrays and objects are closed, and property names or values that are cut
+// off are left out. PartialInto decodes that document into a Go type, and
+// Complete reports which values have been received in full:
+//
+//	parser := partialjson.NewParser()
+//	for {
+//		chunk, err := stream.Next()
+//		if err != nil {
+//			break
+//		}
+//		if err := parser.WriteChunk(chunk); err != nil {
+//			return err
+//		}
+//		forecast, _ := partialjson.PartialInto[Forecast](parser)
+//		if parser.Complete("$.city") {
+//			fmt.Println("City:", forecast.City)
+//		}
+//	}
+package partialjson
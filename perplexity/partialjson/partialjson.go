@@ -0,0 +1,565 @@
+package partialjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity/jsonschema"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/responses"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/types"
+)
+
+// SyntaxError reports text that can never become valid JSON, whatever
+// arrives after it.
+type SyntaxError struct {
+	// Offset is the byte offset of the error from the start of the
+	// document, at its first '{' or '['.
+	Offset int
+
+	msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("partialjson: %s at offset %d", e.msg, e.Offset)
+}
+
+// Parser parses a JSON document from the deltas of a stream. After each
+// delta, Value holds the document parsed so far with its open strings,
+// arrays and objects closed.
+//
+// Text before the first object or array, such as <think> blocks and the
+// opening of a markdown code fence, is skipped, and so is text after the
+// document. Each delta is parsed once: only a string, number or literal cut
+// off at the end of a delta is parsed again with the next one. A Parser is
+// not safe for concurrent use.
+type Parser struct {
+	think   types.ThinkSplitter
+	started bool
+	buf     strings.Builder
+	scanner scanner
+
+	// stack holds the objects and arrays that are still open, outermost
+	// first. partial is the value cut off at the end of the text, if
+	// hasPartial is set.
+	stack      []*frame
+	partial    interface{}
+	hasPartial bool
+
+	root  interface{}
+	value interface{}
+	stale bool
+	done  bool
+	err   error
+}
+
+// NewParser creates a parser for a new document.
+func NewParser() *Parser {
+	return &Parser{}
+}
+
+// Write appends delta to the document and parses it. It returns a
+// *SyntaxError if the document is not valid JSON; the parser then keeps the
+// last valid state and ignores further deltas.
+func (p *Parser) Write(delta string) error {
+	if p.err != nil {
+		return p.err
+	}
+	if p.done || delta == "" {
+		return nil
+	}
+	if !p.started {
+		start := p.documentStart(delta)
+		if start < 0 {
+			return nil
+		}
+		delta = delta[start:]
+		p.started = true
+	}
+	p.buf.WriteString(delta)
+	p.scanner.data = p.buf.String()
+	p.stale = true
+	if err := p.parse(); err != nil {
+		p.err = err
+		return err
+	}
+	return nil
+}
+
+// documentStart returns the offset in delta of the first '{' or '[' outside
+// <think> blocks, or -1 if there is none. Text inside the document is not
+// checked for think blocks, since it may contain tags in string values.
+func (p *Parser) documentStart(delta string) int {
+	from := 0
+	for {
+		i := strings.IndexAny(delta[from:], "{[")
+		if i < 0 {
+			p.think.Write(delta[from:])
+			return -1
+		}
+		i += from
+		p.think.Write(delta[from:i])
+		if !p.think.InThink() {
+			return i
+		}
+		p.think.Write(delta[i : i+1])
+		from = i + 1
+	}
+}
+
+// WriteChunk writes the content delta of the first choice of a chat stream
+// chunk.
+func (p *Parser) WriteChunk(chunk *types.StreamChunk) error {
+	if chunk == nil {
+		return nil
+	}
+	for _, choice := range chunk.Choices {
+		if choice.Index == 0 {
+			return p.Write(types.ContentText(choice.Delta.Content))
+		}
+	}
+	return nil
+}
+
+// WriteEvent writes the delta of a responses text delta event. Events of
+// other types are ignored.
+func (p *Parser) WriteEvent(event *responses.StreamEvent) error {
+	if event == nil {
+		return nil
+	}
+	if delta, ok := event.AsTextDelta(); ok {
+		return p.Write(delta.Delta)
+	}
+	return nil
+}
+
+// Value returns the document parsed so far, or nil before the document
+// starts. Objects are map[string]interface{}, arrays are []interface{} and
+// numbers are json.Number. Later deltas do not change a value that has been
+// returned.
+func (p *Parser) Value() interface{} {
+	if p.stale {
+		p.value = p.snapshot()
+		p.stale = false
+	}
+	return p.value
+}
+
+// JSON returns Value encoded as JSON, or nil before the document starts.
+func (p *Parser) JSON() []byte {
+	value := p.Value()
+	if value == nil {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// Done reports whether the whole document has been received.
+func (p *Parser) Done() bool {
+	return p.done
+}
+
+// Complete reports whether the value at path has been received in full.
+// Paths start at $ for the document, followed by .name for properties and
+// [i] for array items, such as $.stops[0].city. Property names that are not
+// identifiers are written as ["name"].
+func (p *Parser) Complete(path string) bool {
+	for _, completed := range p.scanner.completed {
+		if completed == path {
+			return true
+		}
+	}
+	return false
+}
+
+// Completed returns the paths of the values received in full, in the order
+// in which they were completed.
+func (p *Parser) Completed() []string {
+	return append([]string(nil), p.scanner.completed...)
+}
+
+// Err returns the syntax error that stopped the parser, if any.
+func (p *Parser) Err() error {
+	return p.err
+}
+
+// PartialInto decodes the document parsed so far into a new T. Values that
+// are still being received may be cut short: strings end at the last
+// character received and numbers at the last digit. The error of decoding
+// the partial document into T is returned along with the value.
+func PartialInto[T any](p *Parser) (T, error) {
+	var value T
+	data := p.JSON()
+	if data == nil {
+		return value, nil
+	}
+	err := json.Unmarshal(data, &value)
+	return value, err
+}
+
+type state int
+
+const (
+	// stateNone means that no part of the value has been received.
+	stateNone state = iota
+	statePartial
+	stateComplete
+)
+
+// expect is the next token of an open object or array.
+type expect int
+
+const (
+	expectValue expect = iota
+	expectKey
+	expectColon
+	// expectEnd expects a comma or the end of the object or array.
+	expectEnd
+)
+
+// frame is an object or array that is still open. It holds the values
+// received in full; the value being received is held by the next frame or
+// by the parser's partial value.
+type frame struct {
+	path   string
+	object map[string]interface{} // nil for arrays
+	array  []interface{}
+	count  int
+	key    string
+	next   expect
+}
+
+func (f *frame) childPath() string {
+	if f.object != nil {
+		return jsonschema.PropertyPath(f.path, f.key)
+	}
+	return fmt.Sprintf("%s[%d]", f.path, f.count)
+}
+
+func (f *frame) add(value interface{}) {
+	if f.object != nil {
+		f.object[f.key] = value
+	} else {
+		f.array = append(f.array, value)
+	}
+	f.count++
+	f.next = expectEnd
+}
+
+// parse consumes the tokens of the text from the end of the last value or
+// delimiter parsed, up to the end of the text or of the document.
+func (p *Parser) parse() error {
+	s := &p.scanner
+	p.hasPartial = false
+	for !p.done {
+		s.skipSpace()
+		if s.eof() {
+			return nil
+		}
+		c := s.data[s.pos]
+		if len(p.stack) == 0 {
+			p.open(c, "$")
+			continue
+		}
+
+		top := p.stack[len(p.stack)-1]
+		switch top.next {
+		case expectKey:
+			if c == '}' && top.count == 0 {
+				p.close()
+				continue
+			}
+			if c != '"' {
+				return s.syntaxError("invalid character %q looking for a property name", c)
+			}
+			start := s.pos
+			key, st, err := s.string()
+			if err != nil {
+				return err
+			}
+			if st != stateComplete {
+				s.pos = start
+				return nil
+			}
+			top.key = key.(string)
+			top.next = expectColon
+		case expectColon:
+			if c != ':' {
+				return s.syntaxError("invalid character %q after property name", c)
+			}
+			s.pos++
+			top.next = expectValue
+		case expectValue:
+			if c == ']' && top.object == nil && top.count == 0 {
+				p.close()
+				continue
+			}
+			if c == '{' || c == '[' {
+				p.open(c, top.childPath())
+				continue
+			}
+			start := s.pos
+			value, st, err := s.scalar(c)
+			if err != nil {
+				return err
+			}
+			if st != stateComplete {
+				s.pos = start
+				p.partial, p.hasPartial = value, st != stateNone
+				return nil
+			}
+			s.completed = append(s.completed, top.childPath())
+			top.add(value)
+		case expectEnd:
+			switch {
+			case c == ',':
+				s.pos++
+				if top.object != nil {
+					top.next = expectKey
+				} else {
+					top.next = expectValue
+				}
+			case c == '}' && top.object != nil, c == ']' && top.object == nil:
+				p.close()
+			case top.object != nil:
+				return s.syntaxError("invalid character %q after property value", c)
+			default:
+				return s.syntaxError("invalid character %q after array item", c)
+			}
+		}
+	}
+	return nil
+}
+
+// open starts the object or array at c.
+func (p *Parser) open(c byte, path string) {
+	p.scanner.pos++
+	f := &frame{path: path, next: expectValue}
+	if c == '{' {
+		f.object = make(map[string]interface{})
+		f.next = expectKey
+	} else {
+		f.array = []interface{}{}
+	}
+	p.stack = append(p.stack, f)
+}
+
+// close ends the innermost open object or array and adds it to its parent.
+func (p *Parser) close() {
+	s := &p.scanner
+	s.pos++
+	f := p.stack[len(p.stack)-1]
+	p.stack = p.stack[:len(p.stack)-1]
+	s.completed = append(s.completed, f.path)
+
+	var value interface{} = f.array
+	if f.object != nil {
+		value = f.object
+	}
+	if len(p.stack) == 0 {
+		p.root = value
+		p.done = true
+		return
+	}
+	p.stack[len(p.stack)-1].add(value)
+}
+
+// snapshot returns the document parsed so far with its open values closed.
+// Open objects and arrays are copied, since they still change; the values
+// they hold are complete and are shared.
+func (p *Parser) snapshot() interface{} {
+	if len(p.stack) == 0 {
+		return p.root
+	}
+	child, hasChild := p.partial, p.hasPartial
+	for i := len(p.stack) - 1; i >= 0; i-- {
+		f := p.stack[i]
+		if f.object != nil {
+			object := make(map[string]interface{}, len(f.object)+1)
+			for key, value := range f.object {
+				object[key] = value
+			}
+			if hasChild {
+				object[f.key] = child
+			}
+			child = object
+		} else {
+			array := make([]interface{}, len(f.array), len(f.array)+1)
+			copy(array, f.array)
+			if hasChild {
+				array = append(array, child)
+			}
+			child = array
+		}
+		hasChild = true
+	}
+	return child
+}
+
+// scanner reads the values of a possibly truncated JSON document.
+type scanner struct {
+	data      string
+	pos       int
+	completed []string
+}
+
+func (s *scanner) syntaxError(format string, args ...interface{}) error {
+	return &SyntaxError{Offset: s.pos, msg: fmt.Sprintf(format, args...)}
+}
+
+func (s *scanner) skipSpace() {
+	for s.pos < len(s.data) {
+		switch s.data[s.pos] {
+		case ' ', '\t', '\n', '\r':
+			s.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (s *scanner) eof() bool {
+	return s.pos >= len(s.data)
+}
+
+// scalar parses the string, number or literal starting with c.
+func (s *scanner) scalar(c byte) (interface{}, state, error) {
+	switch {
+	case c == '"':
+		return s.string()
+	case c == '-' || c >= '0' && c <= '9':
+		return s.number()
+	case c == 't':
+		return s.literal("true", true)
+	case c == 'f':
+		return s.literal("false", false)
+	case c == 'n':
+		return s.literal("null", nil)
+	}
+	return nil, stateNone, s.syntaxError("invalid character %q looking for a value", c)
+}
+
+func (s *scanner) string() (interface{}, state, error) {
+	start := s.pos
+	for i := start + 1; i < len(s.data); i++ {
+		switch s.data[i] {
+		case '\\':
+			i++
+		case '"':
+			var value string
+			if err := json.Unmarshal([]byte(s.data[start:i+1]), &value); err != nil {
+				return nil, stateNone, s.syntaxError("invalid string")
+			}
+			s.pos = i + 1
+			return value, stateComplete, nil
+		}
+	}
+
+	// Close the string after the last complete character.
+	raw := trimIncompleteRune(trimIncompleteEscape(s.data[start:]))
+	var value string
+	if err := json.Unmarshal([]byte(raw+`"`), &value); err != nil {
+		return nil, stateNone, s.syntaxError("invalid string")
+	}
+	s.pos = len(s.data)
+	return value, statePartial, nil
+}
+
+// trimIncompleteEscape removes an escape sequence cut off at the end of raw,
+// including the first half of a surrogate pair.
+func trimIncompleteEscape(raw string) string {
+	backslashes := 0
+	for i := len(raw) - 1; i >= 0 && raw[i] == '\\'; i-- {
+		backslashes++
+	}
+	if backslashes%2 == 1 {
+		return raw[:len(raw)-1]
+	}
+	if i := strings.LastIndex(raw, `\u`); i >= 0 && isEscape(raw, i) {
+		if len(raw)-i < 6 {
+			return raw[:i]
+		}
+		if len(raw)-i == 6 && isHighSurrogate(raw[i+2:i+6]) {
+			return raw[:i]
+		}
+	}
+	return raw
+}
+
+// trimIncompleteRune removes a UTF-8 sequence cut off at the end of raw.
+func trimIncompleteRune(raw string) string {
+	for i := len(raw) - 1; i >= 0 && i >= len(raw)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(raw[i]) {
+			if !utf8.FullRuneInString(raw[i:]) {
+				return raw[:i]
+			}
+			break
+		}
+	}
+	return raw
+}
+
+// isEscape reports whether the backslash at i starts an escape sequence.
+func isEscape(raw string, i int) bool {
+	backslashes := 0
+	for j := i; j >= 0 && raw[j] == '\\'; j-- {
+		backslashes++
+	}
+	return backslashes%2 == 1
+}
+
+func isHighSurrogate(hex string) bool {
+	r, err := strconv.ParseUint(hex, 16, 16)
+	return err == nil && r >= 0xD800 && r < 0xDC00
+}
+
+func (s *scanner) number() (interface{}, state, error) {
+	start := s.pos
+	for s.pos < len(s.data) && strings.IndexByte("+-.eE0123456789", s.data[s.pos]) >= 0 {
+		s.pos++
+	}
+	raw := s.data[start:s.pos]
+	if !s.eof() {
+		if !isNumber(raw) {
+			s.pos = start
+			return nil, stateNone, s.syntaxError("invalid number %q", raw)
+		}
+		return json.Number(raw), stateComplete, nil
+	}
+
+	// The number may continue; keep its longest valid prefix.
+	for len(raw) > 0 && !isNumber(raw) {
+		raw = raw[:len(raw)-1]
+	}
+	if raw == "" {
+		return nil, stateNone, nil
+	}
+	return json.Number(raw), statePartial, nil
+}
+
+func isNumber(raw string) bool {
+	if raw == "" || raw[0] != '-' && (raw[0] < '0' || raw[0] > '9') {
+		return false
+	}
+	return json.Valid([]byte(raw))
+}
+
+func (s *scanner) literal(name string, value interface{}) (interface{}, state, error) {
+	rest := s.data[s.pos:]
+	if len(rest) < len(name) {
+		if strings.HasPrefix(name, rest) {
+			s.pos = len(s.data)
+			return value, statePartial, nil
+		}
+	} else if rest[:len(name)] == name {
+		s.pos += len(name)
+		return value, stateComplete, nil
+	}
+	return nil, stateNone, s.syntaxError("invalid literal, expected %s", name)
+}
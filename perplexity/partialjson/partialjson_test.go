@@ -0,0 +1,220 @@
+package partialjson
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity/responses"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/types"
+)
+
+func TestParser_Prefixes(t *testing.T) {
+	document := `{"city":"Pa\"ris","high":21.5,"tags":["sun",true,null],"stops":[{"day":1}],"note":"café 😀"}`
+	for i := 0; i <= len(document); i++ {
+		p := NewParser()
+		if err := p.Write(document[:i]); err != nil {
+			t.Fatalf("Write(%q) failed: %v", document[:i], err)
+		}
+		if i > 0 && !json.Valid(p.JSON()) {
+			t.Fatalf("JSON() for %q = %s is not valid", document[:i], p.JSON())
+		}
+	}
+
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{`{"ci`, `{}`},
+		{`{"city"`, `{}`},
+		{`{"city":`, `{}`},
+		{`{"city":"Pa\`, `{"city":"Pa"}`},
+		{`{"city":"Pa\"r`, `{"city":"Pa\"r"}`},
+		{`{"city":"Paris","high":2`, `{"city":"Paris","high":2}`},
+		{`{"city":"Paris","high":21.`, `{"city":"Paris","high":21}`},
+		{`{"city":"Paris","high":-`, `{"city":"Paris"}`},
+		{`{"tags":["sun",tr`, `{"tags":["sun",true]}`},
+		{`{"tags":["sun",true,n`, `{"tags":["sun",true,null]}`},
+		{`{"stops":[{"day":1},{`, `{"stops":[{"day":1},{}]}`},
+		{`{"note":"caf\u00`, `{"note":"caf"}`},
+		{`{"note":"\ud83d`, `{"note":""}`},
+		{`{"note":"😀`, `{"note":"😀"}`},
+		{"{\"note\":\"caf\xc3", `{"note":"caf"}`},
+	}
+	for _, tt := range tests {
+		p := NewParser()
+		if err := p.Write(tt.prefix); err != nil {
+			t.Fatalf("Write(%q) failed: %v", tt.prefix, err)
+		}
+		if got := string(p.JSON()); got != tt.want {
+			t.Errorf("JSON() for %q = %s, want %s", tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestParser_Completed(t *testing.T) {
+	p := NewParser()
+	for _, delta := range []string{"<think>Use {braces}.</think>```json\n", `{"city":"Par`, `is","hi`, `gh":21`, `,"stops":[{"day":1},`, `{"my day":2}]}`, "\n```"} {
+		if err := p.Write(delta); err != nil {
+			t.Fatalf("Write(%q) failed: %v", delta, err)
+		}
+		if delta == `gh":21` {
+			if !p.Complete("$.city") || p.Complete("$.high") || p.Done() {
+				t.Errorf("completed = %v after %q", p.Completed(), delta)
+			}
+		}
+	}
+
+	want := `$.city,$.high,$.stops[0].day,$.stops[0],$.stops[1]["my day"],$.stops[1],$.stops,$`
+	if got := strings.Join(p.Completed(), ","); got != want {
+		t.Errorf("Completed() = %s, want %s", got, want)
+	}
+	if !p.Done() {
+		t.Error("Done() = false")
+	}
+}
+
+func TestParser_Deltas(t *testing.T) {
+	document := `{"city":"Pa\"ris","high":21.5,"tags":["sun",true,null],"stops":[{"day":1},{"day":[2,3]}],"note":"café 😀"}`
+	whole := NewParser()
+	if err := whole.Write(document); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	p := NewParser()
+	var snapshots []string
+	var values []interface{}
+	for i := 0; i < len(document); i++ {
+		if err := p.Write(document[i : i+1]); err != nil {
+			t.Fatalf("Write(%q) failed: %v", document[:i+1], err)
+		}
+		prefix := NewParser()
+		_ = prefix.Write(document[:i+1])
+		if got, want := string(p.JSON()), string(prefix.JSON()); got != want {
+			t.Fatalf("JSON() after %q = %s, want %s", document[:i+1], got, want)
+		}
+		snapshots = append(snapshots, string(p.JSON()))
+		values = append(values, p.Value())
+	}
+	if got, want := string(p.JSON()), string(whole.JSON()); got != want || !p.Done() {
+		t.Errorf("JSON() = %s, want %s", got, want)
+	}
+	if got, want := strings.Join(p.Completed(), ","), strings.Join(whole.Completed(), ","); got != want {
+		t.Errorf("Completed() = %s, want %s", got, want)
+	}
+
+	// Earlier values are not changed by later deltas.
+	for i, value := range values {
+		data, _ := json.Marshal(value)
+		if string(data) != snapshots[i] {
+			t.Fatalf("Value() after %d bytes changed to %s, was %s", i+1, data, snapshots[i])
+		}
+	}
+}
+
+func TestParser_ThinkInString(t *testing.T) {
+	content := "<think>Plan {a} and [b].</think>\n" + `{"note":"x <think>y</think>  z","list":["<think>"]}`
+	type document struct {
+		Note string   `json:"note"`
+		List []string `json:"list"`
+	}
+	for i := 0; i <= len(content); i++ {
+		p := NewParser()
+		for _, delta := range []string{content[:i], content[i:]} {
+			if err := p.Write(delta); err != nil {
+				t.Fatalf("Write(%q) failed: %v", delta, err)
+			}
+		}
+		got, err := PartialInto[document](p)
+		if err != nil || got.Note != "x <think>y</think>  z" || len(got.List) != 1 || got.List[0] != "<think>" || !p.Done() {
+			t.Fatalf("split at %d: PartialInto() = %+v, %v", i, got, err)
+		}
+	}
+}
+
+type forecast struct {
+	City  string   `json:"city"`
+	High  float64  `json:"high"`
+	Tags  []string `json:"tags"`
+	Extra *string  `json:"extra"`
+}
+
+func TestPartialInto(t *testing.T) {
+	p := NewParser()
+	value, err := PartialInto[forecast](p)
+	if err != nil || value.City != "" {
+		t.Fatalf("PartialInto before the document = %+v, %v", value, err)
+	}
+
+	chunk := func(text string) *types.StreamChunk {
+		return &types.StreamChunk{Choices: []types.Choice{{Index: 0, Delta: types.ChatMessage{Content: types.TextContent(text)}}}}
+	}
+	for _, delta := range []string{`{"city":"Rome",`, `"high":2`, `5,"tags":["su`} {
+		if err := p.WriteChunk(chunk(delta)); err != nil {
+			t.Fatalf("WriteChunk failed: %v", err)
+		}
+	}
+	value, err = PartialInto[forecast](p)
+	if err != nil {
+		t.Fatalf("PartialInto failed: %v", err)
+	}
+	if value.City != "Rome" || value.High != 25 || len(value.Tags) != 1 || value.Tags[0] != "su" {
+		t.Errorf("value = %+v", value)
+	}
+}
+
+func TestParser_WriteEvent(t *testing.T) {
+	p := NewParser()
+	for _, raw := range []string{
+		`{"type":"response.output_text.delta","sequence_number":1,"delta":"[1, 2"}`,
+		`{"type":"response.in_progress","sequence_number":2}`,
+		`{"type":"response.output_text.delta","sequence_number":3,"delta":", 3]"}`,
+	} {
+		var event responses.StreamEvent
+		if err := json.Unmarshal([]byte(raw), &event); err != nil {
+			t.Fatalf("Unmarshal failed: %v", err)
+		}
+		if err := p.WriteEvent(&event); err != nil {
+			t.Fatalf("WriteEvent failed: %v", err)
+		}
+	}
+	if got := string(p.JSON()); got != "[1,2,3]" || !p.Done() {
+		t.Errorf("JSON() = %s, done = %v", got, p.Done())
+	}
+}
+
+func TestParser_SyntaxError(t *testing.T) {
+	p := NewParser()
+	if err := p.Write(`{"a":1,"b":[2`); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	err := p.Write(` x`)
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) || syntaxErr.Offset != 14 {
+		t.Fatalf("error = %v, want SyntaxError at offset 14", err)
+	}
+	if err := p.Write(`]}`); err != syntaxErr || p.Err() != syntaxErr {
+		t.Errorf("error after a syntax error = %v", err)
+	}
+	if got := string(p.JSON()); got != `{"a":1,"b":[2]}` {
+		t.Errorf("JSON() = %s, want the last valid state", got)
+	}
+
+	for _, document := range []string{`{"a":tru3}`, `{"a" 1}`, `{a:1}`, `[1 2]`, `{"a":1.2.3}`, `["a\x"]`} {
+		if err := NewParser().Write(document); err == nil {
+			t.Errorf("Write(%q) succeeded", document)
+		}
+	}
+}
+
+func BenchmarkParser_Write(b *testing.B) {
+	item := `{"name":"stop","lat":48.8566,"tags":["a","b"]},`
+	document := `{"stops":[` + strings.Repeat(item, 200) + `{}]}`
+	for i := 0; i < b.N; i++ {
+		p := NewParser()
+		for j := 0; j < len(document); j += 8 {
+			_ = p.Write(document[j:min(j+8, len(document))])
+		}
+	}
+}
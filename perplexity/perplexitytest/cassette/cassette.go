@@ -0,0 +1,435 @@
+// Package cassette records HTTP interactions with the Perplexity API to disk
+// and replays them, so tests can run against real API behavior without the
+// network.
+//
+// A cassette is a JSON file holding the recorded requests and responses,
+// including complete Server-Sent Events bodies for streaming calls. Requests
+// are matched on method, path and a normalized form of the body, and each
+// recorded interaction is replayed once, in order. Credential headers are
+// scrubbed before anything is written to disk.
+//
+// # Usage
+//
+// Attach a cassette to a client with WithMiddleware:
+//
+//	func TestChat(t *testing.T) {
+//		rec := cassette.Start(t, "testdata/chat.json")
+//		client, err := perplexity.NewClient(os.Getenv("PERPLEXITY_API_KEY"),
+//			perplexity.WithMiddleware(rec.Middleware()),
+//		)
+//		...
+//	}
+//
+// The mode is read from the PERPLEXITY_CASSETTE_MODE environment variable
+// unless set with WithMode. Run the suite once with
+// PERPLEXITY_CASSETTE_MODE=record and a real API key to create the fixtures,
+// then commit them; CI runs in the default replay mode and never touches the
+// network.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity/api"
+)
+
+// EnvMode is the environment variable that selects the cassette mode.
+const EnvMode = "PERPLEXITY_CASSETTE_MODE"
+
+// Mode controls whether a cassette records or replays interactions.
+type Mode string
+
+const (
+	// ModeReplay serves every request from the cassette and fails requests
+	// that were not recorded. It is the default.
+	ModeReplay Mode = "replay"
+
+	// ModeRecord sends every request to the API and replaces the cassette
+	// with the recorded interactions when saved.
+	ModeRecord Mode = "record"
+
+	// ModeAuto replays recorded interactions and records requests that have
+	// no match.
+	ModeAuto Mode = "auto"
+)
+
+// Scrubbed is the value that replaces scrubbed header values.
+const Scrubbed = "[SCRUBBED]"
+
+// ErrNoInteraction is returned in replay mode for a request that has no
+// unused recorded interaction.
+var ErrNoInteraction = errors.New("cassette: no recorded interaction matches request")
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded request.
+type Request struct {
+	Operation string      `json:"operation,omitempty"`
+	Method    string      `json:"method"`
+	Path      string      `json:"path"`
+	Query     string      `json:"query,omitempty"`
+	Headers   http.Header `json:"headers,omitempty"`
+	Body      string      `json:"body,omitempty"`
+}
+
+// Response is a recorded response. Body holds the full response body,
+// including every event of a stream.
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       string      `json:"body"`
+}
+
+type file struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Option configures a Cassette.
+type Option func(*Cassette)
+
+// WithMode sets the mode, overriding the environment variable.
+func WithMode(mode Mode) Option {
+	return func(c *Cassette) {
+		c.mode = mode
+	}
+}
+
+// WithTransport sets the transport used to reach the API when a cassette is
+// used as an http.RoundTripper. It defaults to http.DefaultTransport.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Cassette) {
+		c.transport = transport
+	}
+}
+
+// WithScrubHeaders adds headers to scrub from recorded requests and
+// responses, in addition to Authorization, Proxy-Authorization, Cookie,
+// Set-Cookie and X-Api-Key.
+func WithScrubHeaders(names ...string) Option {
+	return func(c *Cassette) {
+		for _, name := range names {
+			c.scrub[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+}
+
+// Cassette records and replays HTTP interactions. It is safe for concurrent
+// use.
+type Cassette struct {
+	path      string
+	mode      Mode
+	transport http.RoundTripper
+	scrub     map[string]bool
+
+	mu           sync.Mutex
+	interactions []*Interaction
+	used         []bool
+	changed      bool
+}
+
+// New opens the cassette at path. In replay and auto mode the file is loaded
+// if it exists; in replay mode a missing file is an error.
+func New(path string, opts ...Option) (*Cassette, error) {
+	c := &Cassette{
+		path:      path,
+		mode:      Mode(os.Getenv(EnvMode)),
+		transport: http.DefaultTransport,
+		scrub: map[string]bool{
+			"Authorization":       true,
+			"Proxy-Authorization": true,
+			"Cookie":              true,
+			"Set-Cookie":          true,
+			"X-Api-Key":           true,
+		},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.mode == "" {
+		c.mode = ModeReplay
+	}
+
+	switch c.mode {
+	case ModeRecord:
+	case ModeReplay, ModeAuto:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if c.mode == ModeAuto && errors.Is(err, os.ErrNotExist) {
+				break
+			}
+			return nil, fmt.Errorf("cassette: %w", err)
+		}
+		var f file
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, fmt.Errorf("cassette: failed to parse %s: %w", path, err)
+		}
+		c.interactions = f.Interactions
+		c.used = make([]bool, len(f.Interactions))
+	default:
+		return nil, fmt.Errorf("cassette: unknown mode %q", c.mode)
+	}
+	return c, nil
+}
+
+// Start opens the cassette at path for a test and saves it when the test
+// finishes. It fails the test if the cassette cannot be opened or saved.
+func Start(t testing.TB, path string, opts ...Option) *Cassette {
+	t.Helper()
+	c, err := New(path, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := c.Save(); err != nil {
+			t.Error(err)
+		}
+	})
+	return c
+}
+
+// Mode returns the mode of the cassette.
+func (c *Cassette) Mode() Mode {
+	return c.mode
+}
+
+// Interactions returns the interactions currently held by the cassette.
+func (c *Cassette) Interactions() []Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	interactions := make([]Interaction, len(c.interactions))
+	for i, interaction := range c.interactions {
+		interactions[i] = *interaction
+	}
+	return interactions
+}
+
+// Save writes recorded interactions to disk. It does nothing in replay mode
+// or when nothing new was recorded.
+func (c *Cassette) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.mode == ModeReplay || !c.changed {
+		return nil
+	}
+	data, err := json.MarshalIndent(file{Interactions: c.interactions}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cassette: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return fmt.Errorf("cassette: %w", err)
+	}
+	if err := os.WriteFile(c.path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("cassette: %w", err)
+	}
+	c.changed = false
+	return nil
+}
+
+// RoundTrip implements http.RoundTripper, so a cassette can back the
+// http.Client passed to perplexity.WithHTTPClient.
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	return c.handle(req, "", c.transport.RoundTrip)
+}
+
+// Middleware returns middleware that records or replays every attempt made
+// by a client configured with perplexity.WithMiddleware.
+func (c *Cassette) Middleware() api.Middleware {
+	return func(req *http.Request, info api.RequestInfo, next api.MiddlewareNext) (*http.Response, error) {
+		return c.handle(req, info.Operation, next)
+	}
+}
+
+func (c *Cassette) handle(req *http.Request, operation string, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, fmt.Errorf("cassette: %w", err)
+	}
+
+	if c.mode != ModeRecord {
+		if interaction, ok := c.match(req, body); ok {
+			return interaction.Response.httpResponse(req), nil
+		}
+		if c.mode == ModeReplay {
+			return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, req.Method, req.URL.Path)
+		}
+	}
+	return c.record(req, operation, body, send)
+}
+
+func (c *Cassette) match(req *http.Request, body []byte) (*Interaction, bool) {
+	normalized := normalizeBody(body)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, interaction := range c.interactions {
+		if c.used[i] {
+			continue
+		}
+		recorded := interaction.Request
+		if recorded.Method != req.Method || recorded.Path != req.URL.Path {
+			continue
+		}
+		if normalizeBody([]byte(recorded.Body)) != normalized {
+			continue
+		}
+		c.used[i] = true
+		return interaction, true
+	}
+	return nil, false
+}
+
+func (c *Cassette) record(req *http.Request, operation string, body []byte, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	interaction := &Interaction{
+		Request: Request{
+			Operation: operation,
+			Method:    req.Method,
+			Path:      req.URL.Path,
+			Query:     req.URL.RawQuery,
+			Headers:   c.scrubHeaders(req.Header),
+			Body:      string(body),
+		},
+	}
+
+	resp, err := send(req)
+	if err != nil {
+		return nil, err
+	}
+	interaction.Response = Response{
+		StatusCode: resp.StatusCode,
+		Headers:    c.scrubHeaders(resp.Header),
+	}
+
+	// Reserve the slot now so interactions keep the order of the requests,
+	// and fill in the body once it has been read in full.
+	c.mu.Lock()
+	c.interactions = append(c.interactions, interaction)
+	c.used = append(c.used, true)
+	c.mu.Unlock()
+
+	resp.Body = &recordingBody{ReadCloser: resp.Body, cassette: c, interaction: interaction}
+	return resp, nil
+}
+
+// recordingBody copies a response body into its interaction as it is read.
+// The copy is committed when the body reaches EOF or is closed. Close may run
+// concurrently with Read, so buf and done are guarded by mu; data read after
+// the copy is committed is not recorded.
+type recordingBody struct {
+	io.ReadCloser
+	cassette    *Cassette
+	interaction *Interaction
+
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	done bool
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.done {
+		b.buf.Write(p[:n])
+	}
+	if err == io.EOF {
+		b.commit()
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.mu.Lock()
+	b.commit()
+	b.mu.Unlock()
+	return b.ReadCloser.Close()
+}
+
+// commit stores the copy in the interaction once. b.mu must be held.
+func (b *recordingBody) commit() {
+	if b.done {
+		return
+	}
+	b.done = true
+	b.cassette.mu.Lock()
+	defer b.cassette.mu.Unlock()
+	b.interaction.Response.Body = b.buf.String()
+	b.cassette.changed = true
+}
+
+func (c *Cassette) scrubHeaders(headers http.Header) http.Header {
+	if len(headers) == 0 {
+		return nil
+	}
+	scrubbed := headers.Clone()
+	for key := range scrubbed {
+		if c.scrub[http.CanonicalHeaderKey(key)] {
+			scrubbed[key] = []string{Scrubbed}
+		}
+	}
+	return scrubbed
+}
+
+func (r Response) httpResponse(req *http.Request) *http.Response {
+	headers := r.Headers.Clone()
+	if headers == nil {
+		headers = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        headers,
+		Body:          io.NopCloser(strings.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
+
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// normalizeBody returns a canonical form of a request body. JSON bodies are
+// re-encoded with sorted keys and no insignificant whitespace; other bodies
+// are compared with surrounding whitespace trimmed.
+func normalizeBody(body []byte) string {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return ""
+	}
+	var value any
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return string(trimmed)
+	}
+	normalized, err := json.Marshal(value)
+	if err != nil {
+		return string(trimmed)
+	}
+	return string(normalized)
+}
@@ -0,0 +1,248 @@
+package cassette
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/chat"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/responses"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/types"
+)
+
+func newAPIServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Set-Cookie", "session=secret")
+		switch {
+		case r.URL.Path == "/chat/completions" && strings.Contains(string(body), `"stream":true`):
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "data: {\"id\":\"1\",\"model\":\"sonar\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"Hel\"}}]}\n\n")
+			io.WriteString(w, "data: {\"id\":\"1\",\"model\":\"sonar\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"lo\"}}]}\n\n")
+			io.WriteString(w, "data: [DONE]\n\n")
+		case r.URL.Path == "/chat/completions":
+			io.WriteString(w, `{"id":"1","model":"sonar","choices":[{"index":0,"message":{"role":"assistant","content":"Hello"}}]}`)
+		case r.URL.Path == "/v1/responses":
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "data: {\"sequence_number\":1,\"type\":\"response.output_text.delta\",\"delta\":\"Hi\"}\n\n")
+			io.WriteString(w, "data: [DONE]\n\n")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func runCalls(t *testing.T, client *perplexity.Client) {
+	t.Helper()
+	ctx := context.Background()
+	params := &chat.CompletionParams{Model: "sonar", Messages: []types.ChatMessage{types.UserMessage("Hello")}}
+
+	result, err := client.Chat.Create(ctx, params)
+	if err != nil {
+		t.Fatalf("Chat.Create() error = %v", err)
+	}
+	if result.Choices[0].Message.Content != types.TextContent("Hello") {
+		t.Errorf("content = %v", result.Choices[0].Message.Content)
+	}
+
+	stream, err := client.Chat.CreateStream(ctx, &chat.CompletionParams{Model: "sonar", Messages: []types.ChatMessage{types.UserMessage("Hello")}})
+	if err != nil {
+		t.Fatalf("Chat.CreateStream() error = %v", err)
+	}
+	var content strings.Builder
+	for {
+		chunk, err := stream.Next()
+		if err != nil {
+			break
+		}
+		if text, ok := chunk.Choices[0].Delta.Content.(types.TextContent); ok {
+			content.WriteString(string(text))
+		}
+	}
+	stream.Close()
+	if content.String() != "Hello" {
+		t.Errorf("streamed content = %q", content.String())
+	}
+
+	events, err := client.Responses.CreateStream(ctx, &responses.CreateParams{Input: responses.Input{Text: types.String("hi")}})
+	if err != nil {
+		t.Fatalf("Responses.CreateStream() error = %v", err)
+	}
+	event, err := events.Next()
+	if err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	if delta, ok := event.AsTextDelta(); !ok || delta.Delta != "Hi" {
+		t.Errorf("event = %#v", event)
+	}
+	events.Close()
+}
+
+func TestCassette_RecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixtures", "calls.json")
+	server := newAPIServer(t)
+
+	rec, err := New(path, WithMode(ModeRecord))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	client, err := perplexity.NewClient("secret-api-key", perplexity.WithBaseURL(server.URL), perplexity.WithMiddleware(rec.Middleware()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	runCalls(t, client)
+	if err := rec.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	server.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if strings.Contains(string(data), "secret-api-key") || strings.Contains(string(data), "session=secret") {
+		t.Errorf("cassette contains credentials:\n%s", data)
+	}
+	interactions := rec.Interactions()
+	if len(interactions) != 3 {
+		t.Fatalf("Expected 3 interactions, got %d", len(interactions))
+	}
+	if interactions[0].Request.Operation != "chat.create" || interactions[0].Request.Headers.Get("Authorization") != Scrubbed {
+		t.Errorf("first request = %+v", interactions[0].Request)
+	}
+	if !strings.HasSuffix(interactions[1].Response.Body, "data: [DONE]\n\n") {
+		t.Errorf("stream body not recorded in full: %q", interactions[1].Response.Body)
+	}
+
+	replay, err := New(path, WithMode(ModeReplay))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	client, err = perplexity.NewClient("other-key", perplexity.WithBaseURL(server.URL), perplexity.WithMaxRetries(0), perplexity.WithMiddleware(replay.Middleware()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	runCalls(t, client)
+
+	if _, err := client.Chat.Create(context.Background(), &chat.CompletionParams{Model: "sonar", Messages: []types.ChatMessage{types.UserMessage("Hello")}}); err == nil || !strings.Contains(err.Error(), ErrNoInteraction.Error()) {
+		t.Errorf("Create() error = %v, want ErrNoInteraction once interactions are used", err)
+	}
+}
+
+func TestCassette_RoundTripper(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "calls.json")
+	server := newAPIServer(t)
+	defer server.Close()
+
+	rec := Start(t, path, WithMode(ModeAuto))
+	client, err := perplexity.NewClient("secret-api-key", perplexity.WithBaseURL(server.URL), perplexity.WithHTTPClient(&http.Client{Transport: rec}))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	runCalls(t, client)
+	if err := rec.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	auto, err := New(path, WithMode(ModeAuto), WithTransport(failingTransport{}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	client, err = perplexity.NewClient("secret-api-key", perplexity.WithBaseURL(server.URL), perplexity.WithHTTPClient(&http.Client{Transport: auto}))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	runCalls(t, client)
+}
+
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("unexpected network call")
+}
+
+func TestNew_ModeFromEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.json")
+
+	t.Setenv(EnvMode, "")
+	if _, err := New(path); err == nil {
+		t.Error("Expected error for a missing cassette in replay mode")
+	}
+
+	t.Setenv(EnvMode, "record")
+	c, err := New(path)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if c.Mode() != ModeRecord {
+		t.Errorf("Mode() = %q, want record", c.Mode())
+	}
+
+	t.Setenv(EnvMode, "bogus")
+	if _, err := New(path); err == nil {
+		t.Error("Expected error for an unknown mode")
+	}
+}
+
+func TestNormalizeBody(t *testing.T) {
+	a := normalizeBody([]byte(`{"model": "sonar", "messages": [{"content": "hi", "role": "user"}], "n": 1.50}`))
+	b := normalizeBody([]byte("{\"messages\":[{\"role\":\"user\",\"content\":\"hi\"}],\n \"n\":1.50,\"model\":\"sonar\"}"))
+	if a != b {
+		t.Errorf("normalizeBody() = %s and %s", a, b)
+	}
+	if got := normalizeBody([]byte("  plain text \n")); got != "plain text" {
+		t.Errorf("normalizeBody() = %q", got)
+	}
+}
+
+type pipeTransport struct {
+	body io.ReadCloser
+}
+
+func (t pipeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: t.body, Request: req}, nil
+}
+
+func TestCassette_CloseDuringRead(t *testing.T) {
+	pr, pw := io.Pipe()
+	rec, err := New(filepath.Join(t.TempDir(), "calls.json"), WithMode(ModeRecord), WithTransport(pipeTransport{body: pr}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/v1/responses", nil)
+	resp, err := rec.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 8)
+		for {
+			if _, err := resp.Body.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		io.WriteString(pw, "data: x\n\n")
+	}
+	if err := resp.Body.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	<-done
+
+	interactions := rec.Interactions()
+	if len(interactions) != 1 || !strings.HasPrefix(interactions[0].Response.Body, "data: x\n\n") {
+		t.Errorf("interactions = %+v", interactions)
+	}
+}
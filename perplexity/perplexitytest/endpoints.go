@@ -0,0 +1,485 @@
+package perplexitytest
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// asyncJob is an async chat completion. Each get advances its status from
+// CREATED to IN_PROGRESS to COMPLETED.
+type asyncJob struct {
+	id        string
+	model     string
+	createdAt int64
+	status    string
+	startedAt *int64
+	doneAt    *int64
+	content   string
+}
+
+func (s *Server) defaultReply(req Request) Response {
+	path := req.Path
+	switch {
+	case req.Method == http.MethodPost && path == "/chat/completions":
+		return s.chatCompletion(req)
+	case req.Method == http.MethodPost && path == "/search":
+		return s.search(req)
+	case req.Method == http.MethodPost && path == "/async/chat/completions":
+		return s.createAsync(req)
+	case req.Method == http.MethodGet && path == "/async/chat/completions":
+		return s.listAsync()
+	case req.Method == http.MethodGet && strings.HasPrefix(path, "/async/chat/completions/"):
+		return s.getAsync(strings.TrimPrefix(path, "/async/chat/completions/"))
+	case req.Method == http.MethodPost && path == "/v1/responses":
+		return s.response(req)
+	case req.Method == http.MethodPost && path == "/v1/embeddings":
+		return s.embeddings(req)
+	case req.Method == http.MethodPost && path == "/v1/contextualizedembeddings":
+		return s.contextualizedEmbeddings(req)
+	case req.Method == http.MethodPost && path == "/v1/browser/sessions":
+		return s.createSession()
+	case req.Method == http.MethodDelete && strings.HasPrefix(path, "/v1/browser/sessions/"):
+		return s.deleteSession(strings.TrimPrefix(path, "/v1/browser/sessions/"))
+	default:
+		return Error(http.StatusNotFound, fmt.Sprintf("no route for %s %s", req.Method, path))
+	}
+}
+
+func decodeBody(req Request) (map[string]any, Response, bool) {
+	var body map[string]any
+	if err := req.Decode(&body); err != nil {
+		return nil, Error(http.StatusBadRequest, "invalid JSON body: "+err.Error()), false
+	}
+	return body, Response{}, true
+}
+
+func stringField(body map[string]any, key string) string {
+	value, _ := body[key].(string)
+	return value
+}
+
+func chatUsage(prompt, completion int) map[string]any {
+	return map[string]any{
+		"prompt_tokens":     prompt,
+		"completion_tokens": completion,
+		"total_tokens":      prompt + completion,
+		"cost": map[string]any{
+			"input_tokens_cost":  float64(prompt) * 1e-6,
+			"output_tokens_cost": float64(completion) * 1e-6,
+			"total_cost":         float64(prompt+completion) * 1e-6,
+		},
+	}
+}
+
+func (s *Server) chatCompletion(req Request) Response {
+	body, reply, ok := decodeBody(req)
+	if !ok {
+		return reply
+	}
+	model := stringField(body, "model")
+	if model == "" {
+		return Error(http.StatusBadRequest, "model is required")
+	}
+	if messages, _ := body["messages"].([]any); len(messages) == 0 {
+		return Error(http.StatusBadRequest, "messages are required")
+	}
+
+	id := s.newID("chat")
+	created := time.Now().Unix()
+	words := strings.Fields(s.ChatContent)
+	usage := chatUsage(8, len(words))
+
+	if stream, _ := body["stream"].(bool); !stream {
+		return Response{Body: map[string]any{
+			"id":      id,
+			"object":  "chat.completion",
+			"created": created,
+			"model":   model,
+			"choices": []any{map[string]any{
+				"index":         0,
+				"finish_reason": "stop",
+				"message":       map[string]any{"role": "assistant", "content": s.ChatContent},
+			}},
+			"usage": usage,
+		}}
+	}
+
+	events := make([]any, 0, len(words)+1)
+	for i, word := range words {
+		if i > 0 {
+			word = " " + word
+		}
+		delta := map[string]any{"content": word}
+		if i == 0 {
+			delta["role"] = "assistant"
+		}
+		events = append(events, map[string]any{
+			"id":      id,
+			"object":  "chat.completion.chunk",
+			"created": created,
+			"model":   model,
+			"choices": []any{map[string]any{"index": 0, "delta": delta}},
+		})
+	}
+	events = append(events, map[string]any{
+		"id":      id,
+		"object":  "chat.completion.chunk",
+		"created": created,
+		"model":   model,
+		"choices": []any{map[string]any{"index": 0, "delta": map[string]any{}, "finish_reason": "stop"}},
+		"usage":   usage,
+	})
+	return Response{Events: events}
+}
+
+func (s *Server) search(req Request) Response {
+	body, reply, ok := decodeBody(req)
+	if !ok {
+		return reply
+	}
+	var queries []string
+	switch query := body["query"].(type) {
+	case string:
+		queries = []string{query}
+	case []any:
+		for _, q := range query {
+			if text, ok := q.(string); ok {
+				queries = append(queries, text)
+			}
+		}
+	}
+	if len(queries) == 0 {
+		return Error(http.StatusBadRequest, "query is required")
+	}
+	maxResults := 3
+	if n, ok := body["max_results"].(float64); ok && n > 0 {
+		maxResults = int(n)
+	}
+
+	var results []any
+	for _, query := range queries {
+		for i := 1; i <= maxResults; i++ {
+			results = append(results, map[string]any{
+				"title":   fmt.Sprintf("Result %d for %s", i, query),
+				"url":     fmt.Sprintf("https://example.com/%s/%d", strings.ReplaceAll(query, " ", "-"), i),
+				"snippet": fmt.Sprintf("Snippet %d about %s.", i, query),
+				"date":    "2025-01-01",
+			})
+		}
+	}
+	return Response{Body: map[string]any{
+		"id":          s.newID("search"),
+		"results":     results,
+		"server_time": time.Now().UTC().Format(time.RFC3339),
+	}}
+}
+
+func (s *Server) createAsync(req Request) Response {
+	body, reply, ok := decodeBody(req)
+	if !ok {
+		return reply
+	}
+	request, _ := body["request"].(map[string]any)
+	if request == nil || stringField(request, "model") == "" {
+		return Error(http.StatusBadRequest, "request.model is required")
+	}
+	job := &asyncJob{
+		id:        s.newID("async"),
+		model:     stringField(request, "model"),
+		createdAt: time.Now().Unix(),
+		status:    "CREATED",
+		content:   s.ChatContent,
+	}
+	s.mu.Lock()
+	s.async[job.id] = job
+	s.order = append(s.order, job.id)
+	s.mu.Unlock()
+	return Response{Body: job.json(false)}
+}
+
+func (s *Server) listAsync() Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	requests := make([]any, 0, len(s.order))
+	for _, id := range s.order {
+		requests = append(requests, s.async[id].json(false))
+	}
+	return Response{Body: map[string]any{"requests": requests}}
+}
+
+func (s *Server) getAsync(id string) Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.async[id]
+	if !ok {
+		return Error(http.StatusNotFound, "async request not found: "+id)
+	}
+	now := time.Now().Unix()
+	switch job.status {
+	case "CREATED":
+		job.status = "IN_PROGRESS"
+		job.startedAt = &now
+	case "IN_PROGRESS":
+		job.status = "COMPLETED"
+		job.doneAt = &now
+	}
+	return Response{Body: job.json(true)}
+}
+
+func (j *asyncJob) json(withResponse bool) map[string]any {
+	body := map[string]any{
+		"id":         j.id,
+		"created_at": j.createdAt,
+		"model":      j.model,
+		"status":     j.status,
+	}
+	if j.startedAt != nil {
+		body["started_at"] = *j.startedAt
+	}
+	if j.doneAt != nil {
+		body["completed_at"] = *j.doneAt
+	}
+	if withResponse && j.status == "COMPLETED" {
+		body["response"] = map[string]any{
+			"id":      j.id,
+			"object":  "chat.completion",
+			"created": j.createdAt,
+			"model":   j.model,
+			"choices": []any{map[string]any{
+				"index":         0,
+				"finish_reason": "stop",
+				"message":       map[string]any{"role": "assistant", "content": j.content},
+			}},
+			"usage": chatUsage(8, len(strings.Fields(j.content))),
+		}
+	}
+	return body
+}
+
+func (s *Server) response(req Request) Response {
+	body, reply, ok := decodeBody(req)
+	if !ok {
+		return reply
+	}
+	if body["input"] == nil {
+		return Error(http.StatusBadRequest, "input is required")
+	}
+	model := stringField(body, "model")
+	if model == "" {
+		model = "sonar"
+	}
+
+	id := s.newID("resp")
+	itemID := s.newID("msg")
+	words := strings.Fields(s.ChatContent)
+	usage := map[string]any{
+		"input_tokens":  8,
+		"output_tokens": len(words),
+		"total_tokens":  8 + len(words),
+		"cost": map[string]any{
+			"currency":    "USD",
+			"input_cost":  8e-6,
+			"output_cost": float64(len(words)) * 1e-6,
+			"total_cost":  float64(8+len(words)) * 1e-6,
+		},
+	}
+	message := map[string]any{
+		"id":      itemID,
+		"type":    "message",
+		"role":    "assistant",
+		"status":  "completed",
+		"content": []any{map[string]any{"type": "output_text", "text": s.ChatContent}},
+	}
+	response := func(status string, output []any, usage any) map[string]any {
+		r := map[string]any{
+			"id":         id,
+			"object":     "response",
+			"created_at": time.Now().Unix(),
+			"model":      model,
+			"status":     status,
+			"output":     output,
+		}
+		if usage != nil {
+			r["usage"] = usage
+		}
+		return r
+	}
+
+	if stream, _ := body["stream"].(bool); !stream {
+		return Response{Body: response("completed", []any{message}, usage)}
+	}
+
+	sequence := 0
+	event := func(fields map[string]any) map[string]any {
+		sequence++
+		fields["sequence_number"] = sequence
+		return fields
+	}
+	events := []any{
+		event(map[string]any{"type": "response.created", "response": response("in_progress", []any{}, nil)}),
+		event(map[string]any{"type": "response.output_item.added", "output_index": 0, "item": map[string]any{
+			"id": itemID, "type": "message", "role": "assistant", "status": "in_progress", "content": []any{},
+		}}),
+	}
+	for i, word := range words {
+		if i > 0 {
+			word = " " + word
+		}
+		events = append(events, event(map[string]any{
+			"type": "response.output_text.delta", "item_id": itemID, "output_index": 0, "content_index": 0, "delta": word,
+		}))
+	}
+	events = append(events,
+		event(map[string]any{"type": "response.output_text.done", "item_id": itemID, "output_index": 0, "content_index": 0, "text": s.ChatContent}),
+		event(map[string]any{"type": "response.output_item.done", "output_index": 0, "item": message}),
+		event(map[string]any{"type": "response.completed", "response": response("completed", []any{message}, usage)}),
+	)
+	return Response{Events: events}
+}
+
+func embeddingInputs(value any) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var texts []string
+		for _, item := range v {
+			if text, ok := item.(string); ok {
+				texts = append(texts, text)
+			}
+		}
+		return texts
+	}
+	return nil
+}
+
+// embedding returns a deterministic base64 embedding derived from text.
+func embedding(text string, dimensions int, format string) string {
+	size := dimensions
+	if format == "base64_binary" {
+		size = (dimensions + 7) / 8
+	}
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(len(text)*31 + i*17)
+		if len(text) > 0 {
+			data[i] ^= text[i%len(text)]
+		}
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func embeddingOptions(body map[string]any) (int, string) {
+	dimensions := 8
+	if n, ok := body["dimensions"].(float64); ok && n > 0 {
+		dimensions = int(n)
+	}
+	format := stringField(body, "encoding_format")
+	if format == "" {
+		format = "base64_int8"
+	}
+	return dimensions, format
+}
+
+func embeddingUsage(tokens int) map[string]any {
+	return map[string]any{
+		"prompt_tokens": tokens,
+		"total_tokens":  tokens,
+		"cost": map[string]any{
+			"currency":   "USD",
+			"input_cost": float64(tokens) * 1e-7,
+			"total_cost": float64(tokens) * 1e-7,
+		},
+	}
+}
+
+func (s *Server) embeddings(req Request) Response {
+	body, reply, ok := decodeBody(req)
+	if !ok {
+		return reply
+	}
+	inputs := embeddingInputs(body["input"])
+	if len(inputs) == 0 {
+		return Error(http.StatusBadRequest, "input cannot be empty")
+	}
+	dimensions, format := embeddingOptions(body)
+
+	data := make([]any, len(inputs))
+	tokens := 0
+	for i, text := range inputs {
+		data[i] = map[string]any{"object": "embedding", "index": i, "embedding": embedding(text, dimensions, format)}
+		tokens += len(strings.Fields(text))
+	}
+	return Response{Body: map[string]any{
+		"object": "list",
+		"model":  stringField(body, "model"),
+		"data":   data,
+		"usage":  embeddingUsage(tokens),
+	}}
+}
+
+func (s *Server) contextualizedEmbeddings(req Request) Response {
+	body, reply, ok := decodeBody(req)
+	if !ok {
+		return reply
+	}
+	documents, _ := body["input"].([]any)
+	if len(documents) == 0 {
+		return Error(http.StatusBadRequest, "input cannot be empty")
+	}
+	dimensions, format := embeddingOptions(body)
+
+	data := make([]any, len(documents))
+	tokens := 0
+	for i, document := range documents {
+		chunks := embeddingInputs(document)
+		embeddings := make([]any, len(chunks))
+		for j, text := range chunks {
+			embeddings[j] = map[string]any{"object": "embedding", "index": j, "embedding": embedding(text, dimensions, format)}
+			tokens += len(strings.Fields(text))
+		}
+		data[i] = map[string]any{"object": "list", "index": i, "data": embeddings}
+	}
+	return Response{Body: map[string]any{
+		"object": "list",
+		"model":  stringField(body, "model"),
+		"data":   data,
+		"usage":  embeddingUsage(tokens),
+	}}
+}
+
+func (s *Server) createSession() Response {
+	id := s.newID("session")
+	s.mu.Lock()
+	s.sessions[id] = "running"
+	s.mu.Unlock()
+	return Response{Body: map[string]any{"session_id": id, "status": "running"}}
+}
+
+func (s *Server) deleteSession(id string) Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[id]; !ok {
+		return Error(http.StatusNotFound, "session not found: "+id)
+	}
+	s.sessions[id] = "stopped"
+	return Response{StatusCode: http.StatusNoContent}
+}
+
+// Sessions returns the IDs of browser sessions that are still running.
+func (s *Server) Sessions() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var running []string
+	for id, status := range s.sessions {
+		if status == "running" {
+			running = append(running, id)
+		}
+	}
+	sort.Strings(running)
+	return running
+}
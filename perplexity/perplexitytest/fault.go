@@ -0,0 +1,387 @@
+package perplexitytest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity/api"
+)
+
+// FaultKind identifies the failure injected by a Fault.
+type FaultKind int
+
+const (
+	// FaultLatency delays the request and then sends it unchanged.
+	FaultLatency FaultKind = iota + 1
+
+	// FaultReset fails the request with a connection reset error before it
+	// is sent.
+	FaultReset
+
+	// FaultStatus replies with StatusCode and an optional Retry-After header
+	// without sending the request.
+	FaultStatus
+
+	// FaultTruncate sends the request and cuts the response body after
+	// After bytes, leaving incomplete JSON.
+	FaultTruncate
+
+	// FaultStreamCut sends the request and resets the connection after
+	// After Server-Sent Events.
+	FaultStreamCut
+
+	// FaultStreamStall sends the request and blocks the response body after
+	// After Server-Sent Events until the request context ends or the body is
+	// closed.
+	FaultStreamStall
+)
+
+// String returns the name of the fault kind.
+func (k FaultKind) String() string {
+	switch k {
+	case FaultLatency:
+		return "latency"
+	case FaultReset:
+		return "reset"
+	case FaultStatus:
+		return "status"
+	case FaultTruncate:
+		return "truncate"
+	case FaultStreamCut:
+		return "stream_cut"
+	case FaultStreamStall:
+		return "stream_stall"
+	default:
+		return "FaultKind(" + strconv.Itoa(int(k)) + ")"
+	}
+}
+
+// Fault describes a failure injected into a request.
+type Fault struct {
+	Kind FaultKind
+
+	// Latency is waited before the request is sent or the fault is applied.
+	Latency time.Duration
+
+	// StatusCode and RetryAfter configure FaultStatus.
+	StatusCode int
+	RetryAfter time.Duration
+
+	// After is the number of bytes kept by FaultTruncate, or the number of
+	// events delivered by FaultStreamCut and FaultStreamStall.
+	After int
+}
+
+// LatencyFault returns a fault that delays requests by d.
+func LatencyFault(d time.Duration) Fault {
+	return Fault{Kind: FaultLatency, Latency: d}
+}
+
+// ResetFault returns a fault that fails requests with a connection reset.
+func ResetFault() Fault {
+	return Fault{Kind: FaultReset}
+}
+
+// StatusFault returns a fault that replies with statusCode. A positive
+// retryAfter is sent as a Retry-After header.
+func StatusFault(statusCode int, retryAfter time.Duration) Fault {
+	return Fault{Kind: FaultStatus, StatusCode: statusCode, RetryAfter: retryAfter}
+}
+
+// TruncateFault returns a fault that cuts response bodies after n bytes.
+func TruncateFault(n int) Fault {
+	return Fault{Kind: FaultTruncate, After: n}
+}
+
+// StreamCutFault returns a fault that resets streams after n events.
+func StreamCutFault(n int) Fault {
+	return Fault{Kind: FaultStreamCut, After: n}
+}
+
+// StreamStallFault returns a fault that stalls streams after n events.
+func StreamStallFault(n int) Fault {
+	return Fault{Kind: FaultStreamStall, After: n}
+}
+
+// FaultRule selects the requests a fault is injected into.
+type FaultRule struct {
+	// Method matches the request method. Empty matches any method.
+	Method string
+
+	// Path matches the request path, using path.Match patterns such as
+	// "/async/chat/completions/*". Empty matches any path.
+	Path string
+
+	// Probability is the chance, between 0 and 1, that a matching request is
+	// faulted. Zero never faults, unless Always is set.
+	Probability float64
+
+	// Always faults every matching request, ignoring Probability.
+	Always bool
+
+	// Times limits how many requests the rule faults. Zero means no limit.
+	Times int
+
+	Fault Fault
+}
+
+// Injection records a fault injected by a FaultTransport.
+type Injection struct {
+	Method string
+	Path   string
+	Fault  Fault
+}
+
+// FaultTransport is an http.RoundTripper that injects faults into requests
+// before passing them to Base. Rules are checked in order and the first
+// matching rule that fires is applied. It is safe for concurrent use.
+//
+// Use it as the transport of the HTTP client, or as middleware so that
+// faults are injected into every retry attempt:
+//
+//	faults := perplexitytest.NewFaultTransport(nil, perplexitytest.FaultRule{
+//		Path:        "/chat/completions",
+//		Probability: 0.3,
+//		Fault:       perplexitytest.StatusFault(http.StatusServiceUnavailable, time.Second),
+//	})
+//	client, err := perplexity.NewClient(key, perplexity.WithHTTPClient(&http.Client{Transport: faults}))
+type FaultTransport struct {
+	// Base sends requests that are not replaced by a fault. Defaults to
+	// http.DefaultTransport.
+	Base http.RoundTripper
+
+	mu         sync.Mutex
+	rules      []FaultRule
+	fired      []int
+	rand       *rand.Rand
+	injections []Injection
+}
+
+// NewFaultTransport returns a transport that injects faults according to
+// rules. A nil base uses http.DefaultTransport.
+func NewFaultTransport(base http.RoundTripper, rules ...FaultRule) *FaultTransport {
+	t := &FaultTransport{
+		Base: base,
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	t.Add(rules...)
+	return t
+}
+
+// Add appends rules after the existing ones.
+func (t *FaultTransport) Add(rules ...FaultRule) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rules = append(t.rules, rules...)
+	t.fired = append(t.fired, make([]int, len(rules))...)
+}
+
+// Seed makes the probability of each rule reproducible.
+func (t *FaultTransport) Seed(seed int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rand = rand.New(rand.NewSource(seed))
+}
+
+// Injections returns the faults injected so far.
+func (t *FaultTransport) Injections() []Injection {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Injection(nil), t.injections...)
+}
+
+// Middleware returns client middleware that injects faults into every
+// attempt, including retries, without replacing the HTTP client.
+func (t *FaultTransport) Middleware() api.Middleware {
+	return func(req *http.Request, info api.RequestInfo, next api.MiddlewareNext) (*http.Response, error) {
+		return t.roundTrip(req, next)
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *FaultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return t.roundTrip(req, base.RoundTrip)
+}
+
+func (t *FaultTransport) roundTrip(req *http.Request, next func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	fault, ok := t.match(req)
+	if !ok {
+		return next(req)
+	}
+
+	if fault.Latency > 0 {
+		timer := time.NewTimer(fault.Latency)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+
+	switch fault.Kind {
+	case FaultReset:
+		return nil, connectionReset("write")
+	case FaultStatus:
+		return statusResponse(req, fault), nil
+	}
+
+	resp, err := next(req)
+	if err != nil {
+		return resp, err
+	}
+	switch fault.Kind {
+	case FaultTruncate:
+		data, err := io.ReadAll(io.LimitReader(resp.Body, int64(fault.After)))
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+		resp.ContentLength = int64(len(data))
+		resp.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	case FaultStreamCut, FaultStreamStall:
+		resp.Body = &faultyStream{
+			body:  resp.Body,
+			ctx:   req.Context(),
+			kind:  fault.Kind,
+			after: fault.After,
+			done:  make(chan struct{}),
+		}
+	}
+	return resp, nil
+}
+
+// match picks the fault for a request and records the injection.
+func (t *FaultTransport) match(req *http.Request) (Fault, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, rule := range t.rules {
+		if rule.Method != "" && rule.Method != req.Method {
+			continue
+		}
+		if rule.Path != "" {
+			if matched, _ := path.Match(rule.Path, req.URL.Path); !matched {
+				continue
+			}
+		}
+		if rule.Times > 0 && t.fired[i] >= rule.Times {
+			continue
+		}
+		if !rule.Always && t.rand.Float64() >= rule.Probability {
+			continue
+		}
+		t.fired[i]++
+		t.injections = append(t.injections, Injection{Method: req.Method, Path: req.URL.Path, Fault: rule.Fault})
+		return rule.Fault, true
+	}
+	return Fault{}, false
+}
+
+func connectionReset(op string) error {
+	return &net.OpError{Op: op, Net: "tcp", Err: syscall.ECONNRESET}
+}
+
+func statusResponse(req *http.Request, fault Fault) *http.Response {
+	statusCode := fault.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusServiceUnavailable
+	}
+	body := fmt.Sprintf(`{"message":%q,"type":"injected_fault"}`, http.StatusText(statusCode))
+	header := http.Header{"Content-Type": []string{"application/json"}}
+	if fault.RetryAfter > 0 {
+		header.Set("Retry-After", strconv.Itoa(int(fault.RetryAfter.Seconds())))
+		header.Set("Retry-After-Ms", strconv.FormatInt(fault.RetryAfter.Milliseconds(), 10))
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader([]byte(body))),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// faultyStream delivers the first events of a Server-Sent Events body and
+// then resets or stalls.
+type faultyStream struct {
+	body    io.ReadCloser
+	ctx     context.Context
+	kind    FaultKind
+	after   int
+	events  int
+	last    byte
+	pending []byte
+	closed  sync.Once
+	done    chan struct{}
+}
+
+func (s *faultyStream) Read(p []byte) (int, error) {
+	for len(s.pending) == 0 {
+		if s.events >= s.after {
+			return 0, s.fail()
+		}
+		buf := make([]byte, 4096)
+		n, err := s.body.Read(buf)
+		s.pending = s.keep(buf[:n])
+		if err != nil && len(s.pending) == 0 {
+			return 0, err
+		}
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// keep returns the prefix of data that ends within the allowed events,
+// counting a blank line as the end of an event.
+func (s *faultyStream) keep(data []byte) []byte {
+	for i, b := range data {
+		if b == '\n' && s.last == '\n' {
+			s.events++
+			if s.events >= s.after {
+				s.last = b
+				return data[:i+1]
+			}
+		}
+		if b != '\r' {
+			s.last = b
+		}
+	}
+	return data
+}
+
+func (s *faultyStream) fail() error {
+	if s.kind == FaultStreamCut {
+		return connectionReset("read")
+	}
+	select {
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	case <-s.done:
+		return net.ErrClosed
+	}
+}
+
+func (s *faultyStream) Close() error {
+	s.closed.Do(func() { close(s.done) })
+	return s.body.Close()
+}
@@ -0,0 +1,222 @@
+package perplexitytest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity"
+)
+
+func faultClient(t *testing.T, server *Server, faults *FaultTransport) *perplexity.Client {
+	t.Helper()
+	return newTestClient(t, server, perplexity.WithHTTPClient(&http.Client{Transport: faults}), perplexity.WithMaxRetries(3))
+}
+
+func TestFaultTransport_RetriedFaults(t *testing.T) {
+	server := NewServer(t)
+	faults := NewFaultTransport(nil,
+		FaultRule{Path: "/chat/completions", Always: true, Times: 1, Fault: StatusFault(http.StatusTooManyRequests, 0)},
+		FaultRule{Path: "/chat/completions", Always: true, Times: 1, Fault: StatusFault(http.StatusServiceUnavailable, 0)},
+		FaultRule{Path: "/chat/completions", Always: true, Times: 1, Fault: ResetFault()},
+	)
+	client := faultClient(t, server, faults)
+
+	result, err := client.Chat.Create(context.Background(), chatParams())
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if len(result.Choices) == 0 {
+		t.Errorf("result = %+v", result)
+	}
+	if got := len(faults.Injections()); got != 3 {
+		t.Errorf("Injections() = %d, want 3", got)
+	}
+	server.AssertCalled(t, "POST", "/chat/completions", 1)
+}
+
+func TestFaultTransport_RetryAfter(t *testing.T) {
+	server := NewServer(t)
+	faults := NewFaultTransport(nil, FaultRule{Times: 1, Always: true, Fault: StatusFault(http.StatusTooManyRequests, 200*time.Millisecond)})
+	client := faultClient(t, server, faults)
+
+	start := time.Now()
+	if _, err := client.Chat.Create(context.Background(), chatParams()); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Retry-After not honored, elapsed %v", elapsed)
+	}
+}
+
+func TestFaultTransport_Truncate(t *testing.T) {
+	server := NewServer(t)
+	faults := NewFaultTransport(nil, FaultRule{Method: "POST", Path: "/chat/completions", Always: true, Fault: TruncateFault(20)})
+	client := faultClient(t, server, faults)
+
+	if _, err := client.Chat.Create(context.Background(), chatParams()); err == nil {
+		t.Error("Expected error decoding a truncated body")
+	}
+}
+
+func TestFaultTransport_StreamCut(t *testing.T) {
+	server := NewServer(t)
+	faults := NewFaultTransport(nil, FaultRule{Path: "/chat/completions", Always: true, Fault: StreamCutFault(2)})
+	client := faultClient(t, server, faults)
+
+	stream, err := client.Chat.CreateStream(context.Background(), chatParams())
+	if err != nil {
+		t.Fatalf("CreateStream() error = %v", err)
+	}
+	defer stream.Close()
+	chunks := 0
+	for {
+		_, err = stream.Next()
+		if err != nil {
+			break
+		}
+		chunks++
+	}
+	if chunks != 2 || err == io.EOF {
+		t.Errorf("chunks = %d, err = %v; want 2 chunks and a non-EOF error", chunks, err)
+	}
+}
+
+func TestFaultTransport_StreamStall(t *testing.T) {
+	server := NewServer(t)
+	faults := NewFaultTransport(nil, FaultRule{Path: "/chat/completions", Always: true, Fault: StreamStallFault(1)})
+	client := faultClient(t, server, faults)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	stream, err := client.Chat.CreateStream(ctx, chatParams())
+	if err != nil {
+		t.Fatalf("CreateStream() error = %v", err)
+	}
+	defer stream.Close()
+	if _, err := stream.Next(); err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	if _, err := stream.Next(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Next() error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestFaultTransport_Selection(t *testing.T) {
+	server := NewServer(t)
+	faults := NewFaultTransport(http.DefaultTransport,
+		FaultRule{Method: "GET", Path: "/async/chat/completions/*", Always: true, Fault: StatusFault(http.StatusBadGateway, 0)},
+		FaultRule{Path: "/search", Probability: 0.5, Fault: StatusFault(http.StatusServiceUnavailable, 0)},
+		FaultRule{Path: "/chat/completions", Fault: StatusFault(http.StatusServiceUnavailable, 0)},
+	)
+	faults.Seed(1)
+	httpClient := &http.Client{Transport: faults}
+
+	get := func(method, path string) int {
+		req, _ := http.NewRequest(method, server.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer test-key")
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if got := get("GET", "/async/chat/completions/abc"); got != http.StatusBadGateway {
+		t.Errorf("GET status = %d, want 502", got)
+	}
+	if got := get("GET", "/async/chat/completions"); got == http.StatusBadGateway {
+		t.Error("list request matched the get pattern")
+	}
+
+	faulted := 0
+	for i := 0; i < 100; i++ {
+		if get("POST", "/search") == http.StatusServiceUnavailable {
+			faulted++
+		}
+	}
+	if got := get("POST", "/chat/completions"); got == http.StatusServiceUnavailable {
+		t.Error("rule with zero probability faulted a request")
+	}
+	if faulted < 25 || faulted > 75 {
+		t.Errorf("faulted %d of 100 requests with probability 0.5", faulted)
+	}
+	if got := len(faults.Injections()); got != faulted+1 {
+		t.Errorf("Injections() = %d, want %d", got, faulted+1)
+	}
+}
+
+func TestFaultTransport_Middleware(t *testing.T) {
+	server := NewServer(t)
+	faults := NewFaultTransport(nil, FaultRule{Times: 1, Always: true, Fault: ResetFault()}, FaultRule{Always: true, Fault: LatencyFault(50 * time.Millisecond)})
+	client := newTestClient(t, server, perplexity.WithMiddleware(faults.Middleware()))
+
+	start := time.Now()
+	if _, err := client.Chat.Create(context.Background(), chatParams()); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("latency not injected, elapsed %v", elapsed)
+	}
+	injections := faults.Injections()
+	if len(injections) != 2 || injections[0].Fault.Kind != FaultReset || injections[1].Fault.Kind != FaultLatency {
+		t.Errorf("Injections() = %+v", injections)
+	}
+}
+
+func TestFaultTransport_StreamIdleTimeout(t *testing.T) {
+	server := NewServer(t)
+	faults := NewFaultTransport(nil, FaultRule{Path: "/chat/completions", Always: true, Fault: StreamStallFault(1)})
+	client := newTestClient(t, server,
+		perplexity.WithHTTPClient(&http.Client{Transport: faults}),
+		perplexity.WithStreamIdleTimeout(50*time.Millisecond),
+	)
+
+	stream, err := client.Chat.CreateStream(context.Background(), chatParams())
+	if err != nil {
+		t.Fatalf("CreateStream() error = %v", err)
+	}
+	defer stream.Close()
+	if _, err := stream.Next(); err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	_, err = stream.Next()
+	var stallErr *perplexity.StreamStallError
+	if !errors.As(err, &stallErr) || stallErr.IdleTimeout != 50*time.Millisecond {
+		t.Fatalf("Next() error = %v, want StreamStallError", err)
+	}
+	if !perplexity.IsRetryable(err) {
+		t.Error("IsRetryable() = false for a stalled stream")
+	}
+}
+
+func TestFaultTransport_StreamResumeAfterStall(t *testing.T) {
+	server := NewServer(t)
+	server.Enqueue("POST", "/chat/completions", Response{Retry: time.Millisecond})
+	faults := NewFaultTransport(nil, FaultRule{Path: "/chat/completions", Always: true, Times: 1, Fault: StreamStallFault(2)})
+	client := newTestClient(t, server,
+		perplexity.WithHTTPClient(&http.Client{Transport: faults}),
+		perplexity.WithStreamIdleTimeout(50*time.Millisecond),
+		perplexity.WithStreamResume(1),
+	)
+
+	stream, err := client.Chat.CreateStream(context.Background(), chatParams())
+	if err != nil {
+		t.Fatalf("CreateStream() error = %v", err)
+	}
+	defer stream.Close()
+	for {
+		_, err := stream.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+	}
+	server.AssertCalled(t, "POST", "/chat/completions", 2)
+}
@@ -0,0 +1,393 @@
+// Package perplexitytest provides a fake Perplexity API server for
+// integration tests.
+//
+// Server emulates every endpoint used by the SDK with plausible default
+// responses, lets tests script replies per endpoint, inject rate limits,
+// server errors and mid-stream disconnects, and records every request for
+// assertions:
+//
+//	func TestSummarize(t *testing.T) {
+//		server := perplexitytest.NewServer(t)
+//		server.Enqueue("POST", "/chat/completions", perplexitytest.RateLimited(time.Second))
+//
+//		client, err := perplexity.NewClient("test-key", perplexity.WithBaseURL(server.URL))
+//		...
+//		server.AssertCalled(t, "POST", "/chat/completions", 2)
+//	}
+//
+// FaultTransport injects latency, connection resets, error statuses,
+// truncated bodies, and cut or stalled streams at the transport level, for
+// testing against the fake server or any other backend.
+package perplexitytest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity"
+)
+
+// DefaultChatContent is the assistant message returned by default for chat
+// completions and responses.
+const DefaultChatContent = "Hello from the Perplexity test server."
+
+// Request is a request received by the server.
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+}
+
+// Decode unmarshals the JSON body of the request into v.
+func (r Request) Decode(v any) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// Response is a scripted reply. A reply without a Body or Events and with a
+// status below 400 keeps the default response of the endpoint, but still
+// applies Header, Delay, Check and the disconnect settings.
+type Response struct {
+	// StatusCode is the status to send. Defaults to 200.
+	StatusCode int
+
+	// Header is added to the response headers.
+	Header http.Header
+
+	// Body is sent as the response body. Strings and byte slices are sent
+	// as is; other values are encoded as JSON.
+	Body any
+
+	// Events are sent as a Server-Sent Events stream, with one data line per
+	// line of each event, followed by a [DONE] marker. Strings are sent as is; other values are
+	// encoded as JSON. Each event gets its position, starting at 1, as its
+	// ID, and a request with a Last-Event-ID header resumes after that event.
+	Events []any
+
+	// Retry is sent as the retry field of a stream, in milliseconds.
+	Retry time.Duration
+
+	// Disconnect drops the connection during a stream, after
+	// DisconnectAfter events and without a [DONE] marker. For non-streaming
+	// replies the connection is dropped before any body is sent.
+	Disconnect      bool
+	DisconnectAfter int
+
+	// Delay is how long to wait before replying.
+	Delay time.Duration
+
+	// Check inspects the request before the reply is sent. A non-nil error
+	// fails the test that created the server.
+	Check func(Request) error
+}
+
+// RateLimited returns a 429 reply with Retry-After, rounded up to whole
+// seconds, and Retry-After-Ms headers.
+func RateLimited(retryAfter time.Duration) Response {
+	return Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header: http.Header{
+			"Retry-After":    []string{strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))},
+			"Retry-After-Ms": []string{strconv.FormatInt(retryAfter.Milliseconds(), 10)},
+		},
+		Body: errorBody("rate limit exceeded", "rate_limit_error"),
+	}
+}
+
+// ServerError returns a reply with the given 5xx status.
+func ServerError(statusCode int) Response {
+	return Response{
+		StatusCode: statusCode,
+		Body:       errorBody(http.StatusText(statusCode), "server_error"),
+	}
+}
+
+// Error returns a reply with the given status and error message.
+func Error(statusCode int, message string) Response {
+	return Response{
+		StatusCode: statusCode,
+		Body:       errorBody(message, "invalid_request_error"),
+	}
+}
+
+// DisconnectAfter returns a reply that sends the default stream of the
+// endpoint but drops the connection after n events.
+func DisconnectAfter(n int) Response {
+	return Response{Disconnect: true, DisconnectAfter: n}
+}
+
+func errorBody(message, kind string) map[string]any {
+	return map[string]any{"message": message, "type": kind}
+}
+
+// Server is a fake Perplexity API server. It is safe for concurrent use.
+type Server struct {
+	*httptest.Server
+
+	// APIKey, when set, is the only bearer token the server accepts.
+	// Otherwise any non-empty bearer token is accepted.
+	APIKey string
+
+	// ChatContent is the assistant message of default chat completions and
+	// responses. It must be set before the first request.
+	ChatContent string
+
+	t        testing.TB
+	mu       sync.Mutex
+	requests []Request
+	scripts  map[string][]Response
+	nextID   int
+	async    map[string]*asyncJob
+	order    []string
+	sessions map[string]string
+}
+
+// NewServer starts a server that is closed when the test finishes.
+func NewServer(t testing.TB) *Server {
+	s := &Server{
+		ChatContent: DefaultChatContent,
+		t:           t,
+		scripts:     make(map[string][]Response),
+		async:       make(map[string]*asyncJob),
+		sessions:    make(map[string]string),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// NewClient returns a client that talks to the server.
+func (s *Server) NewClient(opts ...perplexity.ClientOption) (*perplexity.Client, error) {
+	apiKey := s.APIKey
+	if apiKey == "" {
+		apiKey = "test-key"
+	}
+	return perplexity.NewClient(apiKey, append([]perplexity.ClientOption{perplexity.WithBaseURL(s.URL)}, opts...)...)
+}
+
+// Enqueue scripts replies for the next requests to method and path. Replies
+// are used in order, one per request, before the endpoint falls back to its
+// default behavior.
+func (s *Server) Enqueue(method, path string, replies ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := method + " " + path
+	s.scripts[key] = append(s.scripts[key], replies...)
+}
+
+// Requests returns every request received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// RequestsTo returns the requests received for method and path.
+func (s *Server) RequestsTo(method, path string) []Request {
+	var matched []Request
+	for _, req := range s.Requests() {
+		if req.Method == method && req.Path == path {
+			matched = append(matched, req)
+		}
+	}
+	return matched
+}
+
+// LastRequest returns the most recent request, if any.
+func (s *Server) LastRequest() (Request, bool) {
+	requests := s.Requests()
+	if len(requests) == 0 {
+		return Request{}, false
+	}
+	return requests[len(requests)-1], true
+}
+
+// AssertCalled fails the test unless method and path received exactly times
+// requests.
+func (s *Server) AssertCalled(t testing.TB, method, path string, times int) {
+	t.Helper()
+	if got := len(s.RequestsTo(method, path)); got != times {
+		t.Errorf("%s %s called %d times, want %d", method, path, got, times)
+	}
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	req := Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+		Header: r.Header.Clone(),
+		Body:   body,
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	script, scripted := s.dequeue(r.Method + " " + r.URL.Path)
+	s.mu.Unlock()
+
+	if !s.authorized(r) {
+		s.write(w, r, Error(http.StatusUnauthorized, "invalid API key"))
+		return
+	}
+
+	if scripted {
+		if script.Check != nil {
+			if err := script.Check(req); err != nil {
+				s.t.Errorf("perplexitytest: %s %s: %v", r.Method, r.URL.Path, err)
+			}
+		}
+		if script.Delay > 0 {
+			select {
+			case <-time.After(script.Delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if script.Body != nil || script.Events != nil || script.StatusCode >= 400 {
+			s.write(w, r, script)
+			return
+		}
+	}
+
+	reply := s.defaultReply(req)
+	if scripted {
+		for key, values := range script.Header {
+			if reply.Header == nil {
+				reply.Header = make(http.Header)
+			}
+			reply.Header[key] = values
+		}
+		if script.StatusCode != 0 {
+			reply.StatusCode = script.StatusCode
+		}
+		reply.Disconnect = script.Disconnect
+		reply.DisconnectAfter = script.DisconnectAfter
+		if script.Retry > 0 {
+			reply.Retry = script.Retry
+		}
+	}
+	s.write(w, r, reply)
+}
+
+func (s *Server) dequeue(key string) (Response, bool) {
+	queue := s.scripts[key]
+	if len(queue) == 0 {
+		return Response{}, false
+	}
+	s.scripts[key] = queue[1:]
+	return queue[0], true
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	token := r.Header.Get("Authorization")
+	if len(token) <= len("Bearer ") || token[:len("Bearer ")] != "Bearer " {
+		return false
+	}
+	return s.APIKey == "" || token[len("Bearer "):] == s.APIKey
+}
+
+func (s *Server) newID(prefix string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	return fmt.Sprintf("%s_%d", prefix, s.nextID)
+}
+
+func (s *Server) write(w http.ResponseWriter, r *http.Request, reply Response) {
+	for key, values := range reply.Header {
+		w.Header()[key] = values
+	}
+	w.Header().Set("X-Request-ID", s.newID("req"))
+	statusCode := reply.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+
+	if reply.Events != nil {
+		s.writeEvents(w, r, statusCode, reply)
+		return
+	}
+	if reply.Disconnect {
+		panic(http.ErrAbortHandler)
+	}
+
+	var body []byte
+	switch v := reply.Body.(type) {
+	case nil:
+	case []byte:
+		body = v
+	case string:
+		body = []byte(v)
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			s.t.Errorf("perplexitytest: failed to encode reply for %s %s: %v", r.Method, r.URL.Path, err)
+			statusCode = http.StatusInternalServerError
+		}
+		body = encoded
+	}
+	if body != nil && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
+func (s *Server) writeEvents(w http.ResponseWriter, r *http.Request, statusCode int, reply Response) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(statusCode)
+	flusher, _ := w.(http.Flusher)
+
+	if reply.Retry > 0 {
+		fmt.Fprintf(w, "retry: %d\n\n", reply.Retry.Milliseconds())
+	}
+	lastID, _ := strconv.Atoi(r.Header.Get("Last-Event-ID"))
+	sent := 0
+	for i, event := range reply.Events {
+		if i < lastID {
+			continue
+		}
+		if reply.Disconnect && sent >= reply.DisconnectAfter {
+			break
+		}
+		sent++
+		var data []byte
+		switch v := event.(type) {
+		case string:
+			data = []byte(v)
+		case []byte:
+			data = v
+		default:
+			data, _ = json.Marshal(v)
+		}
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "id: %d\n", i+1)
+		for _, line := range bytes.Split(data, []byte("\n")) {
+			buf.WriteString("data: ")
+			buf.Write(line)
+			buf.WriteString("\n")
+		}
+		buf.WriteString("\n")
+		w.Write(buf.Bytes())
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	if reply.Disconnect {
+		panic(http.ErrAbortHandler)
+	}
+	io.WriteString(w, "data: [DONE]\n\n")
+}
@@ -0,0 +1,405 @@
+package perplexitytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/api"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/asyncchat"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/chat"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/contextualizedembeddings"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/embeddings"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/responses"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/search"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/types"
+)
+
+func newTestClient(t *testing.T, server *Server, opts ...perplexity.ClientOption) *perplexity.Client {
+	t.Helper()
+	fast := &api.ExponentialBackoff{InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, MaxRetryAfter: time.Minute}
+	client, err := server.NewClient(append([]perplexity.ClientOption{perplexity.WithRetryPolicy(fast)}, opts...)...)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return client
+}
+
+func chatParams() *chat.CompletionParams {
+	return &chat.CompletionParams{Model: "sonar", Messages: []types.ChatMessage{types.UserMessage("Hello")}}
+}
+
+func TestServer_Chat(t *testing.T) {
+	server := NewServer(t)
+	client := newTestClient(t, server)
+	ctx := context.Background()
+
+	result, err := client.Chat.Create(ctx, chatParams())
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if result.Choices[0].Message.Content != types.TextContent(DefaultChatContent) || result.Usage == nil {
+		t.Errorf("result = %+v", result)
+	}
+
+	stream, err := client.Chat.CreateStream(ctx, chatParams())
+	if err != nil {
+		t.Fatalf("CreateStream() error = %v", err)
+	}
+	defer stream.Close()
+	var content strings.Builder
+	var usage *types.UsageInfo
+	for {
+		chunk, err := stream.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		if text, ok := chunk.Choices[0].Delta.Content.(types.TextContent); ok {
+			content.WriteString(string(text))
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+	}
+	if content.String() != DefaultChatContent || usage == nil {
+		t.Errorf("streamed %q, usage %v", content.String(), usage)
+	}
+
+	server.AssertCalled(t, "POST", "/chat/completions", 2)
+	var body map[string]any
+	if err := server.RequestsTo("POST", "/chat/completions")[1].Decode(&body); err != nil || body["stream"] != true {
+		t.Errorf("stream request body = %v, %v", body, err)
+	}
+}
+
+func TestServer_Search(t *testing.T) {
+	server := NewServer(t)
+	client := newTestClient(t, server)
+
+	params := &search.SearchParams{MaxResults: types.Int(2)}
+	params.QueryString("golang")
+	result, err := client.Search.Create(context.Background(), params)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if len(result.Results) != 2 || !strings.Contains(result.Results[0].Title, "golang") {
+		t.Errorf("results = %+v", result.Results)
+	}
+}
+
+func TestServer_AsyncChat(t *testing.T) {
+	server := NewServer(t)
+	client := newTestClient(t, server)
+	ctx := context.Background()
+
+	created, err := client.AsyncChat.Create(ctx, &asyncchat.CompletionCreateParams{Request: chatParams()})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if created.Status != asyncchat.CompletionStatusCreated {
+		t.Errorf("Status = %s", created.Status)
+	}
+
+	var statuses []asyncchat.CompletionStatus
+	for i := 0; i < 3; i++ {
+		got, err := client.AsyncChat.Get(ctx, created.ID, nil)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		statuses = append(statuses, got.Status)
+		if got.Status == asyncchat.CompletionStatusCompleted && got.Response == nil {
+			t.Error("completed request has no response")
+		}
+	}
+	want := []asyncchat.CompletionStatus{asyncchat.CompletionStatusInProgress, asyncchat.CompletionStatusCompleted, asyncchat.CompletionStatusCompleted}
+	if fmt.Sprint(statuses) != fmt.Sprint(want) {
+		t.Errorf("statuses = %v, want %v", statuses, want)
+	}
+
+	list, err := client.AsyncChat.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(list.Requests) != 1 || list.Requests[0].ID != created.ID {
+		t.Errorf("List() = %+v", list)
+	}
+
+	var notFound *perplexity.NotFoundError
+	if _, err := client.AsyncChat.Get(ctx, "missing", nil); !errors.As(err, &notFound) {
+		t.Errorf("Get() error = %v, want NotFoundError", err)
+	}
+}
+
+func TestServer_Responses(t *testing.T) {
+	server := NewServer(t)
+	server.ChatContent = "Two words"
+	client := newTestClient(t, server)
+	ctx := context.Background()
+	params := func() *responses.CreateParams {
+		return &responses.CreateParams{Input: responses.Input{Text: types.String("hi")}, Model: types.String("sonar-pro")}
+	}
+
+	result, err := client.Responses.Create(ctx, params())
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if result.OutputText() != "Two words" || result.Model != "sonar-pro" || result.Usage == nil {
+		t.Errorf("result = %+v", result)
+	}
+
+	stream, err := client.Responses.CreateStream(ctx, params())
+	if err != nil {
+		t.Fatalf("CreateStream() error = %v", err)
+	}
+	defer stream.Close()
+	var text strings.Builder
+	completed := false
+	for {
+		event, err := stream.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		if delta, ok := event.AsTextDelta(); ok {
+			text.WriteString(delta.Delta)
+		}
+		if _, ok := event.AsResponseCompleted(); ok {
+			completed = true
+		}
+	}
+	if text.String() != "Two words" || !completed {
+		t.Errorf("streamed %q, completed %v", text.String(), completed)
+	}
+
+	stream, err = client.Responses.CreateStream(ctx, params())
+	if err != nil {
+		t.Fatalf("CreateStream() error = %v", err)
+	}
+	defer stream.Close()
+	collected, err := stream.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if collected.OutputText() != "Two words" || collected.Status != responses.StatusCompleted || collected.Usage == nil {
+		t.Errorf("collected = %+v", collected)
+	}
+}
+
+func TestServer_Embeddings(t *testing.T) {
+	server := NewServer(t)
+	client := newTestClient(t, server)
+	ctx := context.Background()
+
+	result, err := client.Embeddings.Create(ctx, &embeddings.CreateParams{
+		Model:      embeddings.ModelEmbedV14B,
+		Input:      embeddings.Input{Texts: []string{"a", "b"}},
+		Dimensions: types.Int(16),
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if len(result.Data) != 2 || result.Data[1].Embedding == nil || result.Usage == nil {
+		t.Errorf("result = %+v", result)
+	}
+
+	contextual, err := client.ContextualizedEmbeddings.Create(ctx, &contextualizedembeddings.CreateParams{
+		Model: contextualizedembeddings.ModelEmbedContextV14B,
+		Input: [][]string{{"a", "b"}, {"c"}},
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if len(contextual.Data) != 2 || len(contextual.Data[0].Data) != 2 {
+		t.Errorf("result = %+v", contextual)
+	}
+}
+
+func TestServer_BrowserSessions(t *testing.T) {
+	server := NewServer(t)
+	client := newTestClient(t, server)
+	ctx := context.Background()
+
+	session, err := client.Browser.Sessions.Create(ctx)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if session.SessionID == nil || len(server.Sessions()) != 1 {
+		t.Fatalf("session = %+v", session)
+	}
+	if err := client.Browser.Sessions.Delete(ctx, *session.SessionID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if len(server.Sessions()) != 0 {
+		t.Errorf("Sessions() = %v", server.Sessions())
+	}
+	if err := client.Browser.Sessions.Delete(ctx, *session.SessionID+"x"); err == nil {
+		t.Error("Expected error deleting an unknown session")
+	}
+}
+
+func TestServer_ErrorInjection(t *testing.T) {
+	server := NewServer(t)
+	server.Enqueue("POST", "/chat/completions", RateLimited(time.Second), ServerError(http.StatusBadGateway))
+	client := newTestClient(t, server)
+
+	start := time.Now()
+	if _, err := client.Chat.Create(context.Background(), chatParams()); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Retry-After not honored, elapsed %v", elapsed)
+	}
+	server.AssertCalled(t, "POST", "/chat/completions", 3)
+
+	server.Enqueue("POST", "/search", Error(http.StatusBadRequest, "bad query"))
+	params := &search.SearchParams{}
+	params.QueryString("x")
+	_, err := client.Search.Create(context.Background(), params)
+	var badRequest *perplexity.BadRequestError
+	if !errors.As(err, &badRequest) || !strings.Contains(err.Error(), "bad query") {
+		t.Errorf("Create() error = %v, want BadRequestError", err)
+	}
+}
+
+func TestServer_Disconnect(t *testing.T) {
+	server := NewServer(t)
+	server.Enqueue("POST", "/chat/completions", DisconnectAfter(2))
+	client := newTestClient(t, server)
+
+	stream, err := client.Chat.CreateStream(context.Background(), chatParams())
+	if err != nil {
+		t.Fatalf("CreateStream() error = %v", err)
+	}
+	defer stream.Close()
+	chunks := 0
+	for {
+		_, err = stream.Next()
+		if err != nil {
+			break
+		}
+		chunks++
+	}
+	if chunks != 2 || err == io.EOF {
+		t.Errorf("chunks = %d, err = %v; want 2 chunks and a non-EOF error", chunks, err)
+	}
+}
+
+func TestServer_ScriptedReplies(t *testing.T) {
+	server := NewServer(t)
+	var checked bool
+	server.Enqueue("POST", "/chat/completions",
+		Response{
+			Header: http.Header{"X-Custom": []string{"yes"}},
+			Check: func(r Request) error {
+				checked = true
+				if r.Header.Get("Authorization") != "Bearer test-key" {
+					return fmt.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+				}
+				return nil
+			},
+		},
+		Response{Body: map[string]any{"id": "scripted", "model": "sonar", "choices": []any{}}},
+	)
+	client := newTestClient(t, server)
+	ctx := context.Background()
+
+	raw, err := client.Chat.CreateRaw(ctx, chatParams())
+	if err != nil {
+		t.Fatalf("CreateRaw() error = %v", err)
+	}
+	if !checked || raw.Headers.Get("X-Custom") != "yes" || raw.Data.ID == "scripted" {
+		t.Errorf("first reply = %+v", raw)
+	}
+	result, err := client.Chat.Create(ctx, chatParams())
+	if err != nil || result.ID != "scripted" {
+		t.Errorf("second reply = %+v, %v", result, err)
+	}
+	if last, ok := server.LastRequest(); !ok || last.Path != "/chat/completions" {
+		t.Errorf("LastRequest() = %+v", last)
+	}
+}
+
+func TestServer_Unauthorized(t *testing.T) {
+	server := NewServer(t)
+	server.APIKey = "right-key"
+	client, err := perplexity.NewClient("wrong-key", perplexity.WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	var authErr *perplexity.AuthenticationError
+	if _, err := client.Chat.Create(context.Background(), chatParams()); !errors.As(err, &authErr) {
+		t.Errorf("Create() error = %v, want AuthenticationError", err)
+	}
+}
+
+func TestServer_StreamResume(t *testing.T) {
+	server := NewServer(t)
+	server.Enqueue("POST", "/chat/completions", Response{Disconnect: true, DisconnectAfter: 2, Retry: time.Millisecond})
+	client := newTestClient(t, server, perplexity.WithStreamResume(1))
+
+	stream, err := client.Chat.CreateStream(context.Background(), chatParams())
+	if err != nil {
+		t.Fatalf("CreateStream() error = %v", err)
+	}
+	defer stream.Close()
+	var content strings.Builder
+	for {
+		chunk, err := stream.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		if len(chunk.Choices) > 0 {
+			if text, ok := chunk.Choices[0].Delta.Content.(types.TextContent); ok {
+				content.WriteString(string(text))
+			}
+		}
+	}
+	if content.String() != DefaultChatContent {
+		t.Errorf("streamed %q, want %q", content.String(), DefaultChatContent)
+	}
+	requests := server.RequestsTo("POST", "/chat/completions")
+	if len(requests) != 2 || requests[1].Header.Get("Last-Event-ID") != "2" {
+		t.Errorf("got %d requests, want a resume after event 2", len(requests))
+	}
+}
+
+func TestServer_RawReplies(t *testing.T) {
+	server := NewServer(t)
+	server.Enqueue("POST", "/chat/completions",
+		RateLimited(200*time.Millisecond),
+		Response{Events: []any{"{\n\"a\":1}"}},
+	)
+	post := func() (*http.Response, string) {
+		req, _ := http.NewRequest("POST", server.URL+"/chat/completions", strings.NewReader(`{}`))
+		req.Header.Set("Authorization", "Bearer test-key")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	resp, _ := post()
+	if resp.Header.Get("Retry-After") != "1" || resp.Header.Get("Retry-After-Ms") != "200" {
+		t.Errorf("Retry-After = %q, Retry-After-Ms = %q; want 1 and 200", resp.Header.Get("Retry-After"), resp.Header.Get("Retry-After-Ms"))
+	}
+	if _, body := post(); !strings.Contains(body, "id: 1\ndata: {\ndata: \"a\":1}\n\n") {
+		t.Errorf("stream body = %q, want one data line per line", body)
+	}
+}
@@ -0,0 +1,233 @@
+package responses
+
+import "fmt"
+
+// SequenceError reports a stream event whose sequence number does not
+// directly follow the previous event, because events were lost or repeated.
+type SequenceError struct {
+	Previous int
+	Got      int
+}
+
+func (e *SequenceError) Error() string {
+	if e.Got <= e.Previous {
+		return fmt.Sprintf("duplicate stream event: sequence number %d after %d", e.Got, e.Previous)
+	}
+	return fmt.Sprintf("missing stream events: sequence number %d after %d", e.Got, e.Previous)
+}
+
+// ResponseFailedError is returned when a stream reports that the response
+// failed with a response.failed event.
+type ResponseFailedError struct {
+	ErrorInfo
+	SequenceNumber int
+}
+
+func (e *ResponseFailedError) Error() string {
+	if e.Code != nil && *e.Code != "" {
+		return fmt.Sprintf("response failed: %s: %s", *e.Code, e.Message)
+	}
+	return "response failed: " + e.Message
+}
+
+// Accumulator rebuilds a CreateResponse from the events of a stream.
+//
+// Output items are added and replaced by the output item events, text deltas
+// are appended to the content part they address, and search and fetch
+// results reported while reasoning are attached as output items unless the
+// response already carries items of that type. Add checks that sequence
+// numbers have no gaps or duplicates and returns a *ResponseFailedError once
+// the response fails.
+//
+// An Accumulator is not safe for concurrent use.
+type Accumulator struct {
+	response     CreateResponse
+	items        []OutputItem
+	reasoning    []OutputItem
+	queries      []string
+	lastSequence int
+	sequenced    bool
+	failed       *ResponseFailedError
+}
+
+// NewAccumulator returns an empty Accumulator.
+func NewAccumulator() *Accumulator {
+	return &Accumulator{}
+}
+
+// Add applies a stream event to the accumulated response. Sequence numbers
+// may start at 0 or 1, and each must follow the previous one. Unknown events
+// without a sequence number are not checked.
+func (a *Accumulator) Add(event *StreamEvent) error {
+	if event == nil {
+		return nil
+	}
+	if a.failed != nil {
+		return a.failed
+	}
+	if unknown, ok := event.value.(UnknownEvent); ok && unknown.SequenceNumber == 0 {
+		return nil
+	}
+	sequence := event.SequenceNumber()
+	if a.sequenced && sequence != a.lastSequence+1 {
+		return &SequenceError{Previous: a.lastSequence, Got: sequence}
+	}
+	a.lastSequence = sequence
+	a.sequenced = true
+
+	switch v := event.value.(type) {
+	case ResponseCreatedEvent:
+		a.setResponse(v.Response)
+	case ResponseInProgressEvent:
+		a.setResponse(v.Response)
+	case ResponseCompletedEvent:
+		a.setResponse(v.Response)
+		if a.response.Status == "" {
+			a.response.Status = StatusCompleted
+		}
+	case ResponseFailedEvent:
+		info := v.Error
+		a.response.Status = StatusFailed
+		a.response.Error = &info
+		a.failed = &ResponseFailedError{ErrorInfo: info, SequenceNumber: v.SequenceNumber}
+		return a.failed
+	case OutputItemAddedEvent:
+		a.setItem(v.OutputIndex, v.Item)
+	case OutputItemDoneEvent:
+		a.setItem(v.OutputIndex, v.Item)
+	case TextDeltaEvent:
+		a.updateText(v.OutputIndex, v.ItemID, v.ContentIndex, func(part *ContentPart) { part.Text += v.Delta })
+	case TextDoneEvent:
+		a.updateText(v.OutputIndex, v.ItemID, v.ContentIndex, func(part *ContentPart) { part.Text = v.Text })
+	case SearchQueriesEvent:
+		a.queries = append(a.queries, v.Queries...)
+	case SearchResultsEvent:
+		if v.Usage != nil {
+			a.response.Usage = v.Usage
+		}
+		a.reasoning = append(a.reasoning, NewOutputItemFromSearchResults(SearchResultsOutputItem{
+			Results: v.Results,
+			Type:    OutputItemTypeSearchResults,
+			Queries: a.queries,
+		}))
+		a.queries = nil
+	case FetchURLResultsEvent:
+		a.reasoning = append(a.reasoning, NewOutputItemFromFetchURLResults(FetchURLResultsOutputItem{
+			Contents: v.Contents,
+			Type:     OutputItemTypeFetchURLResults,
+		}))
+	}
+	return nil
+}
+
+// setResponse copies the response metadata carried by a lifecycle event.
+// The output of the completed response replaces the accumulated output.
+func (a *Accumulator) setResponse(response *CreateResponse) {
+	if response == nil {
+		return
+	}
+	items := a.items
+	usage := a.response.Usage
+	a.response = *response
+	if a.response.Usage == nil {
+		a.response.Usage = usage
+	}
+	if len(response.Output) > 0 {
+		items = append([]OutputItem(nil), response.Output...)
+	}
+	a.items = items
+	a.response.Output = nil
+}
+
+func (a *Accumulator) setItem(index int, item OutputItem) {
+	if index < 0 {
+		return
+	}
+	for len(a.items) <= index {
+		a.items = append(a.items, OutputItem{})
+	}
+	a.items[index] = item
+}
+
+// updateText updates a content part of the message item at index. The item
+// is created when a text event arrives before it was added.
+func (a *Accumulator) updateText(index int, itemID string, contentIndex int, update func(*ContentPart)) {
+	index = max(index, 0)
+	var message MessageOutputItem
+	found := false
+	if index < len(a.items) {
+		var existing *MessageOutputItem
+		if existing, found = a.items[index].AsMessage(); found {
+			message = *existing
+		}
+	}
+	if !found {
+		message = MessageOutputItem{
+			ID:     itemID,
+			Role:   MessageOutputRoleAssistant,
+			Status: StatusInProgress,
+			Type:   OutputItemTypeMessage,
+		}
+	}
+
+	// Copy the content so that responses returned earlier are not modified.
+	contentIndex = max(contentIndex, 0)
+	content := make([]ContentPart, max(len(message.Content), contentIndex+1))
+	copy(content, message.Content)
+	for i := len(message.Content); i < len(content); i++ {
+		content[i].Type = ContentPartTypeOutputText
+	}
+	update(&content[contentIndex])
+	message.Content = content
+	a.setItem(index, NewOutputItemFromMessage(message))
+}
+
+// Response returns the response accumulated so far. Later calls to Add do
+// not modify a returned response.
+func (a *Accumulator) Response() *CreateResponse {
+	response := a.response
+	response.Output = make([]OutputItem, 0, len(a.reasoning)+len(a.items))
+	for _, item := range a.reasoning {
+		if !a.hasItemType(item) {
+			response.Output = append(response.Output, item)
+		}
+	}
+	for _, item := range a.items {
+		if item.value != nil {
+			response.Output = append(response.Output, item)
+		}
+	}
+	return &response
+}
+
+func (a *Accumulator) hasItemType(item OutputItem) bool {
+	for _, existing := range a.items {
+		if existing.itemType() == item.itemType() {
+			return true
+		}
+	}
+	return false
+}
+
+func (o OutputItem) itemType() OutputItemType {
+	switch o.value.(type) {
+	case MessageOutputItem:
+		return OutputItemTypeMessage
+	case SearchResultsOutputItem:
+		return OutputItemTypeSearchResults
+	case FetchURLResultsOutputItem:
+		return OutputItemTypeFetchURLResults
+	case FunctionCallOutputItem:
+		return OutputItemTypeFunctionCall
+	default:
+		return ""
+	}
+}
+
+// Collect reads the stream to the end and returns the accumulated response.
+// If the stream fails, reports a failed response, or skips or repeats an
+// event, Collect returns the response received so far along with the error.
+// The stream is not closed.
+func (s *Stream) Collect() (*CreateResponse, error) {
+	return s.Run(nil)
+}
@@ -0,0 +1,164 @@
+package responses
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func decodeEvents(t *testing.T, lines ...string) []*StreamEvent {
+	t.Helper()
+	events := make([]*StreamEvent, 0, len(lines))
+	for _, line := range lines {
+		var event StreamEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("Unmarshal(%s) failed: %v", line, err)
+		}
+		events = append(events, &event)
+	}
+	return events
+}
+
+func TestAccumulator(t *testing.T) {
+	events := decodeEvents(t,
+		`{"type":"response.created","sequence_number":1,"response":{"id":"resp_1","model":"sonar-pro","object":"response","status":"in_progress","output":[]}}`,
+		`{"type":"response.reasoning.search_queries","sequence_number":2,"queries":["go streams"]}`,
+		`{"type":"response.reasoning.search_results","sequence_number":3,"results":[{"id":1,"title":"Go","url":"https://go.dev","snippet":"Go"}]}`,
+		`{"type":"response.reasoning.fetch_url_results","sequence_number":4,"contents":[{"title":"Go","url":"https://go.dev","snippet":"Go"}]}`,
+		`{"type":"response.output_item.added","sequence_number":5,"output_index":0,"item":{"id":"msg_1","type":"message","role":"assistant","status":"in_progress","content":[]}}`,
+		`{"type":"response.output_text.delta","sequence_number":6,"item_id":"msg_1","output_index":0,"content_index":0,"delta":"Hello"}`,
+		`{"type":"response.output_text.delta","sequence_number":7,"item_id":"msg_1","output_index":0,"content_index":0,"delta":" world"}`,
+		`{"type":"response.output_text.delta","sequence_number":8,"item_id":"msg_2","output_index":1,"content_index":1,"delta":"Second"}`,
+	)
+
+	acc := NewAccumulator()
+	for _, event := range events[:6] {
+		if err := acc.Add(event); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	partial := acc.Response()
+	if partial.OutputText() != "Hello" {
+		t.Fatalf("partial OutputText = %q, want Hello", partial.OutputText())
+	}
+
+	for _, event := range events[6:] {
+		if err := acc.Add(event); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	response := acc.Response()
+	if response.ID != "resp_1" || response.Status != StatusInProgress {
+		t.Fatalf("response = %+v", response)
+	}
+	if len(response.Output) != 4 {
+		t.Fatalf("len(Output) = %d, want 4", len(response.Output))
+	}
+	search, ok := response.Output[0].AsSearchResults()
+	if !ok || len(search.Results) != 1 || len(search.Queries) != 1 || search.Queries[0] != "go streams" {
+		t.Fatalf("Output[0] = %#v, want the search results", response.Output[0])
+	}
+	if _, ok := response.Output[1].AsFetchURLResults(); !ok {
+		t.Fatalf("Output[1] = %#v, want the fetch results", response.Output[1])
+	}
+	if response.OutputText() != "Hello worldSecond" {
+		t.Fatalf("OutputText = %q, want Hello worldSecond", response.OutputText())
+	}
+	second, _ := response.Output[3].AsMessage()
+	if second.ID != "msg_2" || len(second.Content) != 2 {
+		t.Fatalf("Output[3] = %#v, want msg_2 with two content parts", second)
+	}
+	if partial.OutputText() != "Hello" {
+		t.Fatalf("partial OutputText after Add = %q, want Hello", partial.OutputText())
+	}
+}
+
+func TestAccumulator_Completed(t *testing.T) {
+	events := decodeEvents(t,
+		`{"type":"response.created","sequence_number":1,"response":{"id":"resp_1","status":"in_progress","output":[]}}`,
+		`{"type":"response.reasoning.search_results","sequence_number":2,"results":[{"id":1,"title":"Go","url":"https://go.dev","snippet":"Go"}],"usage":{"input_tokens":1,"output_tokens":0,"total_tokens":1}}`,
+		`{"type":"response.output_text.delta","sequence_number":3,"item_id":"msg_1","output_index":0,"content_index":0,"delta":"Hel"}`,
+		`{"type":"response.output_text.done","sequence_number":4,"item_id":"msg_1","output_index":0,"content_index":0,"text":"Hello"}`,
+		`{"type":"response.completed","sequence_number":5,"response":{"id":"resp_1","status":"completed","output":[{"type":"search_results","results":[]},{"id":"msg_1","type":"message","role":"assistant","status":"completed","content":[{"type":"output_text","text":"Hello!"}]}],"usage":{"input_tokens":1,"output_tokens":2,"total_tokens":3}}}`,
+	)
+
+	acc := NewAccumulator()
+	for i, event := range events {
+		if err := acc.Add(event); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+		if i == 3 && acc.Response().OutputText() != "Hello" {
+			t.Fatalf("OutputText after done = %q, want Hello", acc.Response().OutputText())
+		}
+	}
+
+	response := acc.Response()
+	if response.Status != StatusCompleted || response.Usage == nil || response.Usage.TotalTokens != 3 {
+		t.Fatalf("response = %+v", response)
+	}
+	if len(response.Output) != 2 || response.OutputText() != "Hello!" {
+		t.Fatalf("Output = %#v, want the completed output", response.Output)
+	}
+}
+
+func TestAccumulator_SequenceErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		first    string
+		sequence string
+		want     string
+	}{
+		{name: "gap", first: "1", sequence: "3", want: "missing stream events: sequence number 3 after 1"},
+		{name: "duplicate", first: "1", sequence: "1", want: "duplicate stream event: sequence number 1 after 1"},
+		{name: "gap from 0", first: "0", sequence: "2", want: "missing stream events: sequence number 2 after 0"},
+		{name: "duplicate 0", first: "0", sequence: "0", want: "duplicate stream event: sequence number 0 after 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := decodeEvents(t,
+				`{"type":"response.output_text.delta","sequence_number":`+tt.first+`,"output_index":0,"content_index":0,"delta":"a"}`,
+				`{"type":"response.output_text.delta","sequence_number":`+tt.sequence+`,"output_index":0,"content_index":0,"delta":"b"}`,
+			)
+			acc := NewAccumulator()
+			if err := acc.Add(events[0]); err != nil {
+				t.Fatalf("Add failed: %v", err)
+			}
+			err := acc.Add(events[1])
+			var sequenceErr *SequenceError
+			if !errors.As(err, &sequenceErr) || err.Error() != tt.want {
+				t.Fatalf("Add error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestStream_Collect(t *testing.T) {
+	sseData := strings.Join([]string{
+		`data: {"type":"response.created","sequence_number":1,"response":{"id":"resp_1","status":"in_progress","output":[]}}`,
+		`data: {"type":"response.output_text.delta","sequence_number":2,"item_id":"msg_1","output_index":0,"content_index":0,"delta":"Hi"}`,
+		`data: {"type":"response.failed","sequence_number":3,"error":{"message":"upstream timeout","code":"timeout"}}`,
+		`data: [DONE]`,
+	}, "\n\n") + "\n\n"
+	stream := newStream(context.Background(), &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(sseData)),
+		Header:     make(http.Header),
+	})
+	defer func() { _ = stream.Close() }()
+
+	response, err := stream.Collect()
+	var failed *ResponseFailedError
+	if !errors.As(err, &failed) {
+		t.Fatalf("Collect error = %v, want *ResponseFailedError", err)
+	}
+	if failed.Message != "upstream timeout" || failed.SequenceNumber != 3 || err.Error() != "response failed: timeout: upstream timeout" {
+		t.Fatalf("failed = %+v (%v)", failed, err)
+	}
+	if response.Status != StatusFailed || response.Error == nil || response.OutputText() != "Hi" {
+		t.Fatalf("response = %+v, want the failed partial response", response)
+	}
+}
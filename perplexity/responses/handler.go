@@ -0,0 +1,107 @@
+package responses
+
+import (
+	"errors"
+	"io"
+)
+
+// StreamHandler holds callbacks for the events of a response stream, used
+// with Stream.Run. Every callback is optional. A callback that returns an
+// error stops the stream, and Run returns that error.
+type StreamHandler struct {
+	OnCreated          func(ResponseCreatedEvent) error
+	OnInProgress       func(ResponseInProgressEvent) error
+	OnCompleted        func(ResponseCompletedEvent) error
+	OnFailed           func(ResponseFailedEvent) error
+	OnOutputItemAdded  func(OutputItemAddedEvent) error
+	OnOutputItemDone   func(OutputItemDoneEvent) error
+	OnTextDelta        func(TextDeltaEvent) error
+	OnTextDone         func(TextDoneEvent) error
+	OnReasoningStarted func(ReasoningStartedEvent) error
+	OnSearchQueries    func(SearchQueriesEvent) error
+	OnSearchResults    func(SearchResultsEvent) error
+	OnFetchURLQueries  func(FetchURLQueriesEvent) error
+	OnFetchURLResults  func(FetchURLResultsEvent) error
+	OnReasoningStopped func(ReasoningStoppedEvent) error
+
+	// OnUnknown receives events of types this package does not know.
+	OnUnknown func(UnknownEvent) error
+}
+
+func (h *StreamHandler) handle(event *StreamEvent) error {
+	if h == nil {
+		return nil
+	}
+	switch v := event.value.(type) {
+	case ResponseCreatedEvent:
+		return call(h.OnCreated, v)
+	case ResponseInProgressEvent:
+		return call(h.OnInProgress, v)
+	case ResponseCompletedEvent:
+		return call(h.OnCompleted, v)
+	case ResponseFailedEvent:
+		return call(h.OnFailed, v)
+	case OutputItemAddedEvent:
+		return call(h.OnOutputItemAdded, v)
+	case OutputItemDoneEvent:
+		return call(h.OnOutputItemDone, v)
+	case TextDeltaEvent:
+		return call(h.OnTextDelta, v)
+	case TextDoneEvent:
+		return call(h.OnTextDone, v)
+	case ReasoningStartedEvent:
+		return call(h.OnReasoningStarted, v)
+	case SearchQueriesEvent:
+		return call(h.OnSearchQueries, v)
+	case SearchResultsEvent:
+		return call(h.OnSearchResults, v)
+	case FetchURLQueriesEvent:
+		return call(h.OnFetchURLQueries, v)
+	case FetchURLResultsEvent:
+		return call(h.OnFetchURLResults, v)
+	case ReasoningStoppedEvent:
+		return call(h.OnReasoningStopped, v)
+	case UnknownEvent:
+		return call(h.OnUnknown, v)
+	default:
+		return nil
+	}
+}
+
+func call[T any](callback func(T) error, event T) error {
+	if callback == nil {
+		return nil
+	}
+	return callback(event)
+}
+
+// Run reads the stream to the end, passing each event to the matching
+// callback of handler, and returns the accumulated response. It stops at
+// the first error from the stream, the accumulator or a callback, and
+// returns the response received so far along with that error. A failed
+// response is passed to OnFailed before Run returns its
+// *ResponseFailedError. The stream is not closed.
+func (s *Stream) Run(handler *StreamHandler) (*CreateResponse, error) {
+	acc := NewAccumulator()
+	for {
+		event, err := s.Next()
+		if err == io.EOF {
+			return acc.Response(), nil
+		}
+		if err != nil {
+			return acc.Response(), err
+		}
+
+		addErr := acc.Add(event)
+		var failed *ResponseFailedError
+		if addErr != nil && !errors.As(addErr, &failed) {
+			return acc.Response(), addErr
+		}
+		if err := handler.handle(event); err != nil {
+			return acc.Response(), err
+		}
+		if addErr != nil {
+			return acc.Response(), addErr
+		}
+	}
+}
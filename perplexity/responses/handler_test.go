@@ -0,0 +1,125 @@
+package responses
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func handlerStream(events ...string) *Stream {
+	var body strings.Builder
+	for _, event := range events {
+		body.WriteString("data: " + event + "\n\n")
+	}
+	body.WriteString("data: [DONE]\n\n")
+	return newStream(context.Background(), &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(body.String())),
+		Header:     make(http.Header),
+	})
+}
+
+func TestStream_Run(t *testing.T) {
+	stream := handlerStream(
+		`{"type":"response.created","sequence_number":1,"response":{"id":"resp_1","status":"in_progress","output":[]}}`,
+		`{"type":"response.reasoning.started","sequence_number":2,"thought":"thinking"}`,
+		`{"type":"response.reasoning.search_queries","sequence_number":3,"queries":["a","b"]}`,
+		`{"type":"response.reasoning.search_results","sequence_number":4,"results":[{"id":1,"title":"A","url":"https://a.example","snippet":"a"}]}`,
+		`{"type":"response.annotation.added","sequence_number":5,"annotation":{"url":"https://a.example"}}`,
+		`{"type":"response.output_text.delta","sequence_number":6,"item_id":"msg_1","output_index":0,"content_index":0,"delta":"Hi"}`,
+		`{"type":"response.completed","sequence_number":7,"response":{"id":"resp_1","status":"completed","output":[]}}`,
+	)
+	defer func() { _ = stream.Close() }()
+
+	var calls []string
+	record := func(call string) error {
+		calls = append(calls, call)
+		return nil
+	}
+	var unknown UnknownEvent
+	response, err := stream.Run(&StreamHandler{
+		OnCreated:          func(e ResponseCreatedEvent) error { return record("created") },
+		OnReasoningStarted: func(e ReasoningStartedEvent) error { return record("reasoning:" + *e.Thought) },
+		OnSearchQueries:    func(e SearchQueriesEvent) error { return record("queries:" + strings.Join(e.Queries, ",")) },
+		OnSearchResults:    func(e SearchResultsEvent) error { return record("results:" + e.Results[0].URL) },
+		OnTextDelta:        func(e TextDeltaEvent) error { return record("delta:" + e.Delta) },
+		OnCompleted:        func(e ResponseCompletedEvent) error { return record("completed") },
+		OnUnknown: func(e UnknownEvent) error {
+			unknown = e
+			return record("unknown:" + string(e.Type))
+		},
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	want := "created reasoning:thinking queries:a,b results:https://a.example unknown:response.annotation.added delta:Hi completed"
+	if got := strings.Join(calls, " "); got != want {
+		t.Fatalf("calls = %q, want %q", got, want)
+	}
+	if unknown.SequenceNumber != 5 || !strings.Contains(string(unknown.Raw), `"annotation"`) {
+		t.Fatalf("unknown = %+v", unknown)
+	}
+	if data, err := json.Marshal(StreamEvent{value: unknown}); err != nil || string(data) != string(unknown.Raw) {
+		t.Fatalf("Marshal(unknown) = %s, %v; want the raw event", data, err)
+	}
+	if response.Status != StatusCompleted || response.OutputText() != "Hi" {
+		t.Fatalf("response = %+v", response)
+	}
+}
+
+func TestStream_RunErrors(t *testing.T) {
+	t.Run("failed response", func(t *testing.T) {
+		stream := handlerStream(`{"type":"response.failed","sequence_number":1,"error":{"message":"boom"}}`)
+		defer func() { _ = stream.Close() }()
+
+		var reported string
+		_, err := stream.Run(&StreamHandler{
+			OnFailed: func(e ResponseFailedEvent) error { reported = e.Error.Message; return nil },
+		})
+		var failed *ResponseFailedError
+		if !errors.As(err, &failed) || reported != "boom" {
+			t.Fatalf("Run error = %v, reported %q; want the failure passed to OnFailed and returned", err, reported)
+		}
+	})
+
+	t.Run("callback error", func(t *testing.T) {
+		stream := handlerStream(
+			`{"type":"response.output_text.delta","sequence_number":1,"output_index":0,"content_index":0,"delta":"a"}`,
+			`{"type":"response.output_text.delta","sequence_number":2,"output_index":0,"content_index":0,"delta":"b"}`,
+		)
+		defer func() { _ = stream.Close() }()
+
+		stop := errors.New("stop")
+		response, err := stream.Run(&StreamHandler{
+			OnTextDelta: func(TextDeltaEvent) error { return stop },
+		})
+		if !errors.Is(err, stop) || response.OutputText() != "a" {
+			t.Fatalf("Run = %q, %v; want the first delta and the callback error", response.OutputText(), err)
+		}
+	})
+}
+
+func TestStream_RunUnknownWithoutSequence(t *testing.T) {
+	stream := handlerStream(
+		`{"type":"response.output_text.delta","sequence_number":1,"output_index":0,"content_index":0,"delta":"a"}`,
+		`{"type":"response.keepalive"}`,
+		`{"type":"response.output_text.delta","sequence_number":2,"output_index":0,"content_index":0,"delta":"b"}`,
+	)
+	defer func() { _ = stream.Close() }()
+
+	var unknown []EventType
+	response, err := stream.Run(&StreamHandler{
+		OnUnknown: func(e UnknownEvent) error { unknown = append(unknown, e.Type); return nil },
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(unknown) != 1 || unknown[0] != "response.keepalive" || response.OutputText() != "ab" {
+		t.Fatalf("unknown = %v, output = %q; want the unknown event dispatched and the deltas kept", unknown, response.OutputText())
+	}
+}
@@ -0,0 +1,255 @@
+package responses
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity/api"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/types"
+)
+
+// DefaultRunnerMaxSteps is the number of responses a Runner creates in one
+// run when MaxSteps is not set.
+const DefaultRunnerMaxSteps = 10
+
+// ErrMaxSteps is returned by Runner.Run when the model still calls functions
+// after the maximum number of steps.
+var ErrMaxSteps = errors.New("runner reached the maximum number of steps")
+
+// ErrNoFunctionCalls is returned by Runner.Run when a response requires
+// action but contains no function calls to run.
+var ErrNoFunctionCalls = errors.New("response requires action but has no function calls")
+
+// FunctionHandler runs a function call. It receives the JSON arguments chosen
+// by the model and returns the output sent back to it.
+type FunctionHandler func(ctx context.Context, arguments json.RawMessage) (string, error)
+
+// Runner runs the function calling loop of the Responses API. It creates a
+// response, runs the function calls in its output with the registered
+// handlers, and resubmits the conversation with their outputs until the
+// model answers without calling a function.
+//
+// Registered functions are sent as function tools alongside the tools of the
+// parameters, so server-side tools such as web_search and fetch_url keep
+// working. The function calls of one step run concurrently. A handler error
+// or an unknown function does not stop the run: the error is sent to the
+// model as the call output.
+type Runner struct {
+	// MaxSteps is the maximum number of responses created in a run. Zero
+	// means DefaultRunnerMaxSteps.
+	MaxSteps int
+
+	// Stream creates each response with CreateStream instead of Create.
+	Stream bool
+
+	// Handler receives the events of each streamed response.
+	Handler *StreamHandler
+
+	service   *Service
+	mu        sync.RWMutex
+	functions []FunctionTool
+	handlers  map[string]FunctionHandler
+}
+
+// RunResult is the outcome of a Runner run.
+type RunResult struct {
+	// Response is the last response, which holds the final answer when the
+	// run succeeds.
+	Response *CreateResponse
+
+	// Steps holds every response created during the run.
+	Steps []*CreateResponse
+
+	// Input holds the conversation after the last step: the input of the
+	// parameters followed by the messages, function calls and function call
+	// outputs of every step.
+	Input []InputItem
+}
+
+// NewRunner creates a runner that creates responses with service.
+func NewRunner(service *Service) *Runner {
+	return &Runner{
+		service:  service,
+		handlers: make(map[string]FunctionHandler),
+	}
+}
+
+// Register declares tool as a function tool and sets its handler. A function
+// registered twice is replaced.
+func (r *Runner) Register(tool FunctionTool, handler FunctionHandler) {
+	tool.Type = ToolTypeFunction
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.handlers[tool.Name]; ok {
+		for i := range r.functions {
+			if r.functions[i].Name == tool.Name {
+				r.functions[i] = tool
+			}
+		}
+	} else {
+		r.functions = append(r.functions, tool)
+	}
+	r.handlers[tool.Name] = handler
+}
+
+// Run runs the function calling loop for params, which are not modified. It
+// returns the result of the run, which is also returned with an error if the
+// run fails or reaches MaxSteps with ErrMaxSteps.
+func (r *Runner) Run(ctx context.Context, params *CreateParams, opts ...api.RequestOption) (*RunResult, error) {
+	if params == nil {
+		return nil, fmt.Errorf("params cannot be nil")
+	}
+	maxSteps := r.MaxSteps
+	if maxSteps <= 0 {
+		maxSteps = DefaultRunnerMaxSteps
+	}
+
+	request := *params
+	request.Stream = nil
+	request.Tools = r.tools(params.Tools)
+	result := &RunResult{Input: inputItems(params.Input)}
+	for step := 0; step < maxSteps; step++ {
+		request.Input = Input{Items: result.Input}
+		response, err := r.create(ctx, &request, opts)
+		if response != nil {
+			result.Response = response
+			result.Steps = append(result.Steps, response)
+		}
+		if err != nil {
+			return result, err
+		}
+		if response.Status == StatusFailed {
+			info := ErrorInfo{Message: "no error details"}
+			if response.Error != nil {
+				info = *response.Error
+			}
+			return result, &ResponseFailedError{ErrorInfo: info}
+		}
+
+		var calls []FunctionCallOutputItem
+		for _, item := range response.Output {
+			if message, ok := item.AsMessage(); ok && messageText(message) != "" {
+				result.Input = append(result.Input, NewInputItemFromMessage(InputMessage{
+					Content: InputMessageContent{Text: types.String(messageText(message))},
+					Role:    InputMessageRoleAssistant,
+					Type:    InputMessageTypeMessage,
+				}))
+			}
+			if call, ok := item.AsFunctionCall(); ok {
+				calls = append(calls, *call)
+				result.Input = append(result.Input, NewInputItemFromFunctionCall(FunctionCallInput{
+					Arguments:        call.Arguments,
+					CallID:           call.CallID,
+					Name:             call.Name,
+					Type:             InputItemTypeFunctionCall,
+					ThoughtSignature: call.ThoughtSignature,
+				}))
+			}
+		}
+		if len(calls) == 0 {
+			if response.Status == StatusRequiresAction {
+				return result, ErrNoFunctionCalls
+			}
+			return result, nil
+		}
+
+		for i, output := range r.callFunctions(ctx, calls) {
+			result.Input = append(result.Input, NewInputItemFromFunctionCallOutput(FunctionCallOutputInput{
+				CallID: calls[i].CallID,
+				Output: output,
+				Type:   InputItemTypeFunctionCallOutput,
+				Name:   types.String(calls[i].Name),
+			}))
+		}
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+	}
+	return result, ErrMaxSteps
+}
+
+// tools returns the tools of the parameters followed by the registered
+// functions they do not declare.
+func (r *Runner) tools(declared []Tool) []Tool {
+	tools := append([]Tool(nil), declared...)
+	names := make(map[string]bool)
+	for _, tool := range declared {
+		if function, ok := tool.AsFunction(); ok {
+			names[function.Name] = true
+		}
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, function := range r.functions {
+		if !names[function.Name] {
+			tools = append(tools, NewToolFromFunction(function))
+		}
+	}
+	return tools
+}
+
+func (r *Runner) create(ctx context.Context, params *CreateParams, opts []api.RequestOption) (*CreateResponse, error) {
+	if !r.Stream {
+		return r.service.Create(ctx, params, opts...)
+	}
+
+	request := *params
+	stream, err := r.service.CreateStream(ctx, &request, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = stream.Close() }()
+	return stream.Run(r.Handler)
+}
+
+func (r *Runner) callFunctions(ctx context.Context, calls []FunctionCallOutputItem) []string {
+	outputs := make([]string, len(calls))
+	var wg sync.WaitGroup
+	for i, call := range calls {
+		wg.Add(1)
+		go func(i int, call FunctionCallOutputItem) {
+			defer wg.Done()
+			outputs[i] = r.callFunction(ctx, call)
+		}(i, call)
+	}
+	wg.Wait()
+	return outputs
+}
+
+func (r *Runner) callFunction(ctx context.Context, call FunctionCallOutputItem) string {
+	r.mu.RLock()
+	handler := r.handlers[call.Name]
+	r.mu.RUnlock()
+	if handler == nil {
+		return fmt.Sprintf("error: unknown function %q", call.Name)
+	}
+
+	arguments := json.RawMessage(call.Arguments)
+	if call.Arguments == "" {
+		arguments = json.RawMessage("{}")
+	}
+	output, err := handler(ctx, arguments)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return output
+}
+
+func inputItems(input Input) []InputItem {
+	if input.Text != nil {
+		return []InputItem{NewInputItemFromMessage(InputMessage{
+			Content: InputMessageContent{Text: input.Text},
+			Role:    InputMessageRoleUser,
+			Type:    InputMessageTypeMessage,
+		})}
+	}
+	return append([]InputItem(nil), input.Items...)
+}
+
+func messageText(message *MessageOutputItem) string {
+	response := CreateResponse{Output: []OutputItem{NewOutputItemFromMessage(*message)}}
+	return response.OutputText()
+}
@@ -0,0 +1,188 @@
+package responses
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	internalhttp "github.com/ZaguanLabs/perplexity-go/perplexity/internal/http"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/types"
+)
+
+type runnerRequest struct {
+	Input          []map[string]any `json:"input"`
+	Tools          []map[string]any `json:"tools"`
+	ResponseFormat *ResponseFormat  `json:"response_format"`
+}
+
+// runnerServer replies with the scripted response outputs in order and
+// records each request.
+func runnerServer(t *testing.T, outputs ...string) (*Service, *[]runnerRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []runnerRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			runnerRequest
+			Stream bool `json:"stream"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		mu.Lock()
+		requests = append(requests, body.runnerRequest)
+		output := outputs[min(len(requests), len(outputs))-1]
+		mu.Unlock()
+
+		status := "completed"
+		if len(requests) < len(outputs) {
+			status = "requires_action"
+		}
+		response := fmt.Sprintf(`{"id":"resp","model":"sonar-pro","object":"response","status":%q,"output":%s}`, status, output)
+		if body.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "data: {\"type\":\"response.completed\",\"sequence_number\":1,\"response\":%s}\n\ndata: [DONE]\n\n", response)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, response)
+	}))
+	t.Cleanup(server.Close)
+
+	client := internalhttp.NewClient(server.Client(), server.URL, "test-api-key", 0, nil, "test-agent", nil)
+	return NewService(client), &requests
+}
+
+const weatherCallsOutput = `[` +
+	`{"type":"search_results","results":[]},` +
+	`{"type":"function_call","id":"fc_1","call_id":"call_1","name":"get_weather","arguments":"{\"city\":\"Paris\"}","status":"completed"},` +
+	`{"type":"function_call","id":"fc_2","call_id":"call_2","name":"get_time","arguments":"","status":"completed"}]`
+
+const answerOutput = `[{"type":"message","id":"msg_1","role":"assistant","status":"completed","content":[{"type":"output_text","text":"Sunny at noon."}]}]`
+
+func TestRunner_Run(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		t.Run(fmt.Sprintf("stream=%v", stream), func(t *testing.T) {
+			service, requests := runnerServer(t, weatherCallsOutput, answerOutput)
+
+			runner := NewRunner(service)
+			runner.Stream = stream
+			completed := 0
+			runner.Handler = &StreamHandler{OnCompleted: func(ResponseCompletedEvent) error { completed++; return nil }}
+			runner.Register(FunctionTool{Name: "get_weather", Parameters: map[string]any{"type": "object"}}, func(ctx context.Context, arguments json.RawMessage) (string, error) {
+				var args struct{ City string }
+				if err := json.Unmarshal(arguments, &args); err != nil {
+					return "", err
+				}
+				return "sunny in " + args.City, nil
+			})
+			runner.Register(FunctionTool{Name: "get_time"}, func(ctx context.Context, arguments json.RawMessage) (string, error) {
+				if string(arguments) != "{}" {
+					return "", fmt.Errorf("arguments = %s", arguments)
+				}
+				return "noon", nil
+			})
+
+			params := &CreateParams{
+				Input: Input{Text: types.String("Weather and time?")},
+				Model: types.String("sonar-pro"),
+				Tools: []Tool{NewToolFromWebSearch(WebSearchTool{Type: ToolTypeWebSearch})},
+			}
+			result, err := runner.Run(context.Background(), params)
+			if err != nil {
+				t.Fatalf("Run failed: %v", err)
+			}
+
+			if result.Response.OutputText() != "Sunny at noon." || len(result.Steps) != 2 {
+				t.Fatalf("result = %+v", result)
+			}
+			if stream && completed != 2 {
+				t.Fatalf("OnCompleted called %d times, want 2", completed)
+			}
+			if len(params.Tools) != 1 || params.Input.Text == nil || params.Stream != nil {
+				t.Fatalf("params were modified: %+v", params)
+			}
+
+			first := (*requests)[0]
+			if len(first.Tools) != 3 || first.Tools[0]["type"] != "web_search" || first.Tools[1]["name"] != "get_weather" || first.Tools[2]["type"] != "function" {
+				t.Fatalf("tools = %v, want web_search followed by the registered functions", first.Tools)
+			}
+			second := (*requests)[1].Input
+			if len(second) != 5 {
+				t.Fatalf("second input = %v, want message, 2 calls and 2 outputs", second)
+			}
+			if second[0]["role"] != "user" || second[1]["type"] != "function_call" || second[1]["call_id"] != "call_1" {
+				t.Fatalf("second input = %v", second)
+			}
+			if second[3]["type"] != "function_call_output" || second[3]["output"] != "sunny in Paris" || second[4]["output"] != "noon" {
+				t.Fatalf("function outputs = %v, %v", second[3], second[4])
+			}
+			if len(result.Input) != 6 {
+				t.Fatalf("len(Input) = %d, want the final answer appended", len(result.Input))
+			}
+		})
+	}
+}
+
+func TestRunner_Errors(t *testing.T) {
+	t.Run("max steps", func(t *testing.T) {
+		service, requests := runnerServer(t, weatherCallsOutput, weatherCallsOutput, weatherCallsOutput)
+		runner := NewRunner(service)
+		runner.MaxSteps = 2
+
+		result, err := runner.Run(context.Background(), &CreateParams{Input: Input{Text: types.String("hi")}})
+		if !errors.Is(err, ErrMaxSteps) || len(*requests) != 2 || len(result.Steps) != 2 {
+			t.Fatalf("Run = %d steps, %v; want ErrMaxSteps after 2 requests", len(result.Steps), err)
+		}
+		outputs := (*requests)[1].Input
+		if outputs[3]["output"] != `error: unknown function "get_weather"` {
+			t.Fatalf("unknown function output = %v", outputs[3]["output"])
+		}
+	})
+
+	t.Run("failed response", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"id":"resp","status":"failed","output":[],"error":{"message":"boom"}}`)
+		}))
+		defer server.Close()
+		runner := NewRunner(NewService(internalhttp.NewClient(server.Client(), server.URL, "test-api-key", 0, nil, "test-agent", nil)))
+
+		_, err := runner.Run(context.Background(), &CreateParams{Input: Input{Text: types.String("hi")}})
+		var failed *ResponseFailedError
+		if !errors.As(err, &failed) || failed.Message != "boom" {
+			t.Fatalf("Run error = %v, want *ResponseFailedError", err)
+		}
+	})
+
+	t.Run("failed response without error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"id":"resp","status":"failed","output":[]}`)
+		}))
+		defer server.Close()
+		runner := NewRunner(NewService(internalhttp.NewClient(server.Client(), server.URL, "test-api-key", 0, nil, "test-agent", nil)))
+
+		_, err := runner.Run(context.Background(), &CreateParams{Input: Input{Text: types.String("hi")}})
+		var failed *ResponseFailedError
+		if !errors.As(err, &failed) {
+			t.Fatalf("Run error = %v, want *ResponseFailedError", err)
+		}
+	})
+
+	t.Run("requires action without calls", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"id":"resp","status":"requires_action","output":%s}`, answerOutput)
+		}))
+		defer server.Close()
+		runner := NewRunner(NewService(internalhttp.NewClient(server.Client(), server.URL, "test-api-key", 0, nil, "test-agent", nil)))
+
+		result, err := runner.Run(context.Background(), &CreateParams{Input: Input{Text: types.String("hi")}})
+		if !errors.Is(err, ErrNoFunctionCalls) || len(result.Steps) != 1 {
+			t.Fatalf("Run = %d steps, %v; want ErrNoFunctionCalls", len(result.Steps), err)
+		}
+	})
+}
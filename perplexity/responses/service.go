@@ -8,6 +8,7 @@ import (
 
 	"github.com/ZaguanLabs/perplexity-go/perplexity/api"
 	internalhttp "github.com/ZaguanLabs/perplexity-go/perplexity/internal/http"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/internal/sse"
 )
 
 type Service struct {
@@ -49,10 +50,12 @@ func (s *Service) createWithResponse(ctx context.Context, params *CreateParams,
 	}
 
 	req := &internalhttp.Request{
-		Method:  http.MethodPost,
-		Path:    "/v1/responses",
-		Body:    params,
-		Options: api.ApplyRequestOptions(opts),
+		Operation: "responses.create",
+		Method:    http.MethodPost,
+		Path:      "/v1/responses",
+		Body:      params,
+		Options:   api.ApplyRequestOptions(opts),
+		Usage:     parseUsage,
 	}
 
 	resp, err := s.client.Do(ctx, req)
@@ -80,10 +83,11 @@ func (s *Service) CreateStream(ctx context.Context, params *CreateParams, opts .
 	params.Stream = &streamEnabled
 
 	req := &internalhttp.Request{
-		Method:  http.MethodPost,
-		Path:    "/v1/responses",
-		Body:    params,
-		Options: api.ApplyRequestOptions(opts),
+		Operation: "responses.create_stream",
+		Method:    http.MethodPost,
+		Path:      "/v1/responses",
+		Body:      params,
+		Options:   api.ApplyRequestOptions(opts),
 	}
 
 	resp, err := s.client.DoStream(ctx, req)
@@ -91,5 +95,55 @@ func (s *Service) CreateStream(ctx context.Context, params *CreateParams, opts .
 		return nil, fmt.Errorf("streaming request failed: %w", err)
 	}
 
-	return newStream(ctx, resp.Response), nil
+	stream := newStream(ctx, resp.Response)
+	stream.recordUsage = func(model string, usage *Usage) {
+		resp.RecordUsage(usageMetrics(model, usage))
+	}
+	if reconnects := s.client.StreamReconnects(req); reconnects > 0 {
+		stream.resume = sse.NewResumer(reconnects)
+		stream.reopen = func(lastEventID string) (*http.Response, error) {
+			resumed, err := s.client.Resume(ctx, req, lastEventID)
+			if err != nil {
+				return nil, err
+			}
+			stream.mu.Lock()
+			stream.recordUsage = func(model string, usage *Usage) {
+				resumed.RecordUsage(usageMetrics(model, usage))
+			}
+			stream.mu.Unlock()
+			return resumed.Response, nil
+		}
+	}
+	return stream, nil
+}
+
+// parseUsage extracts usage from a response body.
+func parseUsage(body []byte) *api.UsageMetrics {
+	var result struct {
+		Model string `json:"model"`
+		Usage *Usage `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || result.Usage == nil {
+		return nil
+	}
+	metrics := usageMetrics(result.Model, result.Usage)
+	return &metrics
+}
+
+// usageMetrics converts response usage to the form reported to api.Metrics.
+func usageMetrics(model string, usage *Usage) api.UsageMetrics {
+	metrics := api.UsageMetrics{
+		Model:        model,
+		InputTokens:  usage.InputTokens,
+		OutputTokens: usage.OutputTokens,
+		TotalTokens:  usage.TotalTokens,
+		Raw:          usage,
+	}
+	if usage.Cost != nil {
+		metrics.InputCost = usage.Cost.InputCost
+		metrics.OutputCost = usage.Cost.OutputCost
+		metrics.TotalCost = usage.Cost.TotalCost
+		metrics.Currency = usage.Cost.Currency
+	}
+	return metrics
 }
@@ -3,11 +3,16 @@ package responses
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/ZaguanLabs/perplexity-go/perplexity/api"
 	internalhttp "github.com/ZaguanLabs/perplexity-go/perplexity/internal/http"
 	"github.com/ZaguanLabs/perplexity-go/perplexity/types"
 )
@@ -111,6 +116,58 @@ func TestService_CreateStream(t *testing.T) {
 	}
 }
 
+func TestStream_CloseUnblocksNext(t *testing.T) {
+	body, writer := io.Pipe()
+	defer writer.Close()
+	stream := newStream(context.Background(), &http.Response{StatusCode: http.StatusOK, Body: body, Header: make(http.Header)})
+
+	go func() {
+		_, _ = io.WriteString(writer, "data: {\"sequence_number\":1,\"type\":\"response.output_text.delta\",\"delta\":\"Hello\"}\n\n")
+	}()
+	if _, err := stream.Next(); err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := stream.Next()
+		errc <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	_ = stream.Close()
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, api.ErrStreamClosed) {
+			t.Fatalf("Next error = %v, want api.ErrStreamClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Next still blocked after Close")
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("Err = %v, want nil after Close", err)
+	}
+	for range stream.Iter() {
+		t.Fatal("Iter yielded an event after Close")
+	}
+}
+
+func TestStream_ErrAfterFailure(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader("data: {not json}\n\n")),
+		Header:     make(http.Header),
+	}
+	stream := newStream(context.Background(), resp)
+	defer func() { _ = stream.Close() }()
+
+	for range stream.Iter() {
+	}
+	if err := stream.Err(); err == nil {
+		t.Fatal("expected Err to report the failed event")
+	}
+}
+
 func TestService_CreateValidation(t *testing.T) {
 	service := NewService(internalhttp.NewClient(&http.Client{}, "https://example.com", "test-api-key", 0, nil, "test-agent", nil))
 
@@ -197,3 +254,57 @@ func TestOutputItem_JSONVariant(t *testing.T) {
 		t.Fatalf("CallID = %s, want call_1", fc.CallID)
 	}
 }
+
+func TestService_CreateStream_ResumeBySequence(t *testing.T) {
+	// Sequence numbers may start at 0 or 1.
+	for _, first := range []int{0, 1} {
+		t.Run(fmt.Sprintf("from_%d", first), func(t *testing.T) {
+			var requests []*http.Request
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests = append(requests, r)
+				w.Header().Set("Content-Type", "text/event-stream")
+				delta := func(sequence int, text string) {
+					fmt.Fprintf(w, "retry: 1\ndata: {\"sequence_number\":%d,\"type\":\"response.output_text.delta\",\"delta\":%q}\n\n", sequence, text)
+				}
+				// Events carry no IDs, so the server restarts the stream and the
+				// client skips the sequence numbers it has already returned.
+				delta(first, "a")
+				if len(requests) == 1 {
+					w.(http.Flusher).Flush()
+					panic(http.ErrAbortHandler)
+				}
+				delta(first+1, "b")
+				delta(first+2, "c")
+				_, _ = w.Write([]byte("data: [DONE]\n\n"))
+			}))
+			defer server.Close()
+
+			service := NewService(internalhttp.NewClient(server.Client(), server.URL, "test-api-key", 0, nil, "test-agent", nil))
+			stream, err := service.CreateStream(context.Background(), &CreateParams{Input: Input{Text: types.String("hello")}}, api.WithStreamResume(2))
+			if err != nil {
+				t.Fatalf("CreateStream failed: %v", err)
+			}
+			defer func() { _ = stream.Close() }()
+
+			var text strings.Builder
+			for {
+				event, err := stream.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Next failed: %v", err)
+				}
+				if delta, ok := event.AsTextDelta(); ok {
+					text.WriteString(delta.Delta)
+				}
+			}
+			if text.String() != "abc" {
+				t.Errorf("text = %q, want abc", text.String())
+			}
+			if len(requests) != 2 || requests[1].Header.Get("Last-Event-ID") != "" {
+				t.Errorf("requests = %d, want one reconnect without Last-Event-ID", len(requests))
+			}
+		})
+	}
+}
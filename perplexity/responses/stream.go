@@ -6,81 +6,242 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 
+	"github.com/ZaguanLabs/perplexity-go/perplexity/api"
 	"github.com/ZaguanLabs/perplexity-go/perplexity/internal/sse"
 )
 
+// Stream is a stream of response events.
+//
+// A stream is read by one goroutine at a time: Next, Recv and Iter must not
+// be called concurrently. Close and Err are safe to call from any goroutine.
+// Close interrupts a Next that is waiting for data, which then returns
+// api.ErrStreamClosed. The stream is also closed when its context ends, and
+// Next then returns the context's error.
 type Stream struct {
-	decoder  *sse.Decoder
-	response *http.Response
-	ctx      context.Context
-	err      error
+	decoder *sse.Decoder
+	ctx     context.Context
+
+	// mu guards the fields below, which Close and Err access from other
+	// goroutines.
+	mu        sync.Mutex
+	response  *http.Response
+	err       error
+	closed    bool
+	done      chan struct{}
+	stopWatch func() bool
+
+	// usage is the last usage reported by the stream, passed to recordUsage
+	// once the stream ends or is closed.
+	usage       *Usage
+	usageModel  string
+	recordUsage func(model string, usage *Usage)
+
+	// resume and reopen reconnect the stream after a dropped connection.
+	// They are nil unless stream resumption is enabled. Once sequenced is
+	// set, events at or below lastSequence are skipped after a reconnect.
+	resume       *sse.Resumer
+	reopen       func(lastEventID string) (*http.Response, error)
+	lastSequence int
+	sequenced    bool
 }
 
 func newStream(ctx context.Context, resp *http.Response) *Stream {
-	return &Stream{
+	s := &Stream{
 		decoder:  sse.NewDecoder(resp.Body),
 		response: resp,
 		ctx:      ctx,
+		done:     make(chan struct{}),
 	}
+	s.stopWatch = context.AfterFunc(ctx, func() { s.Close() })
+	return s
 }
 
 func (s *Stream) Next() (*StreamEvent, error) {
-	if s.err != nil {
-		return nil, s.err
+	s.mu.Lock()
+	err := s.err
+	closed := s.closed
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
 	}
-
-	select {
-	case <-s.ctx.Done():
-		s.err = s.ctx.Err()
-		return nil, s.err
-	default:
+	if closed {
+		return nil, s.end(api.ErrStreamClosed)
+	}
+	if err := s.ctx.Err(); err != nil {
+		return nil, s.end(err)
 	}
 
-	event, err := s.decoder.Decode()
-	if err != nil {
-		if err == io.EOF {
-			s.err = io.EOF
+	for {
+		event, err := s.nextEvent()
+		if err != nil {
+			return nil, s.end(err)
 		}
-		return nil, err
-	}
 
-	if event.IsDone() {
-		s.err = io.EOF
-		return nil, io.EOF
+		if event.IsDone() {
+			return nil, s.end(io.EOF)
+		}
+
+		if event.IsError() {
+			return nil, s.end(fmt.Errorf("stream error: %s", event.Data))
+		}
+
+		data, err := event.ParseJSON()
+		if err != nil {
+			return nil, s.end(fmt.Errorf("failed to parse event data: %w", err))
+		}
+
+		var chunk StreamEvent
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return nil, s.end(fmt.Errorf("failed to unmarshal chunk: %w", err))
+		}
+		if s.resume != nil {
+			sequence := chunk.SequenceNumber()
+			if s.resume.Reconnects() > 0 && s.sequenced && sequence <= s.lastSequence {
+				continue
+			}
+			if !s.sequenced || sequence > s.lastSequence {
+				s.lastSequence = sequence
+				s.sequenced = true
+			}
+		}
+		s.observeUsage(chunk)
+
+		return &chunk, nil
 	}
+}
 
-	if event.IsError() {
-		s.err = fmt.Errorf("stream error: %s", event.Data)
-		return nil, s.err
+// end records the error that ended the stream and returns it. A read that
+// failed because the context ended or the stream was closed reports that
+// cause instead of the read error.
+func (s *Stream) end(err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if err != io.EOF {
+		if ctxErr := s.ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		} else if s.closed {
+			err = api.ErrStreamClosed
+		}
 	}
+	s.err = err
+	if err == io.EOF {
+		s.flushUsage()
+	}
+	return err
+}
 
-	data, err := event.ParseJSON()
-	if err != nil {
-		s.err = fmt.Errorf("failed to parse event data: %w", err)
-		return nil, s.err
+// nextEvent decodes the next event, reopening the stream after a dropped
+// connection when resumption is enabled. Events repeated by the server after
+// a reconnect are skipped.
+func (s *Stream) nextEvent() (*sse.Event, error) {
+	for {
+		event, err := s.decoder.Decode()
+		if err == nil {
+			if s.resume != nil && s.resume.Observe(event) {
+				continue
+			}
+			return event, nil
+		}
+		if s.reopen == nil || !s.resume.Wait(s.ctx, err) {
+			return nil, err
+		}
+		resp, reopenErr := s.reopen(s.resume.LastEventID())
+		if reopenErr != nil {
+			return nil, fmt.Errorf("failed to resume stream: %w", reopenErr)
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			resp.Body.Close()
+			return nil, api.ErrStreamClosed
+		}
+		previous := s.response
+		s.response = resp
+		s.mu.Unlock()
+		previous.Body.Close()
+		s.decoder = sse.NewDecoder(resp.Body)
 	}
+}
 
-	var chunk StreamEvent
-	if err := json.Unmarshal(data, &chunk); err != nil {
-		s.err = fmt.Errorf("failed to unmarshal chunk: %w", err)
-		return nil, s.err
+func (s *Stream) observeUsage(event StreamEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var response *CreateResponse
+	switch v := event.value.(type) {
+	case ResponseCreatedEvent:
+		response = v.Response
+	case ResponseInProgressEvent:
+		response = v.Response
+	case ResponseCompletedEvent:
+		response = v.Response
+	case SearchResultsEvent:
+		if v.Usage != nil {
+			s.usage = v.Usage
+		}
+	}
+	if response != nil && response.Usage != nil {
+		s.usage = response.Usage
+		s.usageModel = response.Model
 	}
+}
 
-	return &chunk, nil
+// flushUsage reports the last usage seen. The caller must hold s.mu.
+func (s *Stream) flushUsage() {
+	if s.recordUsage != nil && s.usage != nil {
+		s.recordUsage(s.usageModel, s.usage)
+	}
+	s.usage = nil
 }
 
 func (s *Stream) Recv() (*StreamEvent, error) {
 	return s.Next()
 }
 
+// Err returns the error that ended the stream. It returns nil while the
+// stream is open, after it ended with [DONE], and after it was closed by the
+// caller.
+func (s *Stream) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == io.EOF || s.err == api.ErrStreamClosed {
+		return nil
+	}
+	return s.err
+}
+
+// Close closes the stream. It may be called more than once and from any
+// goroutine.
 func (s *Stream) Close() error {
-	if s.response != nil && s.response.Body != nil {
-		return s.response.Body.Close()
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	s.flushUsage()
+	resp := s.response
+	s.mu.Unlock()
+
+	if s.stopWatch != nil {
+		s.stopWatch()
+	}
+	if resp != nil && resp.Body != nil {
+		return resp.Body.Close()
 	}
 	return nil
 }
 
+// Iter returns a channel that yields stream events. The channel is closed
+// when the stream ends, fails, or is closed, or its context ends; Err then
+// reports whether the stream failed. A consumer that stops reading early
+// must call Close, which stops the goroutine feeding the channel.
 func (s *Stream) Iter() <-chan *StreamEvent {
 	ch := make(chan *StreamEvent)
 	go func() {
@@ -92,7 +253,7 @@ func (s *Stream) Iter() <-chan *StreamEvent {
 			}
 			select {
 			case ch <- chunk:
-			case <-s.ctx.Done():
+			case <-s.done:
 				return
 			}
 		}
@@ -0,0 +1,121 @@
+package responses
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity/api"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/internal/structured"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/jsonschema"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/types"
+)
+
+// Validate checks the JSON document output against the schema. Mismatches
+// are returned as a jsonschema.ValidationErrors with the path of each value.
+func (f JSONSchemaFormat) Validate(output []byte) error {
+	return jsonschema.Validate(f.Schema, output)
+}
+
+// StructuredResult is the result of CreateStructured.
+type StructuredResult[T any] struct {
+	// Value is the output text parsed into T.
+	Value T
+
+	// Response is the response that produced Value.
+	Response *CreateResponse
+
+	// Attempts is the number of responses requested, including retries.
+	Attempts int
+}
+
+// StructuredOption configures CreateStructured.
+type StructuredOption func(*structuredOptions)
+
+type structuredOptions struct {
+	retries        int
+	requestOptions []api.RequestOption
+}
+
+// WithStructuredRetries sets how many times CreateStructured asks the model
+// again after an output that cannot be parsed or does not match the schema.
+// The default is 2.
+func WithStructuredRetries(n int) StructuredOption {
+	return func(o *structuredOptions) {
+		o.retries = max(n, 0)
+	}
+}
+
+// WithStructuredRequestOptions sets the request options of every response
+// requested by CreateStructured.
+func WithStructuredRequestOptions(opts ...api.RequestOption) StructuredOption {
+	return func(o *structuredOptions) {
+		o.requestOptions = append(o.requestOptions, opts...)
+	}
+}
+
+// CreateStructured requests a response whose output text is a JSON document
+// matching the schema of T, and parses it into T. The response format of
+// params is replaced with the schema of T; params are not modified.
+//
+// <think> blocks and markdown code fences around the document are removed
+// before parsing. When the output cannot be parsed or does not match the
+// schema, the output and the error are added to the input and the response
+// is requested again. Once the retries are exhausted, the error is an
+// *api.StructuredOutputError.
+func CreateStructured[T any](ctx context.Context, service *Service, params *CreateParams, opts ...StructuredOption) (*StructuredResult[T], error) {
+	if params == nil {
+		return nil, fmt.Errorf("params cannot be nil")
+	}
+	options := structuredOptions{retries: structured.DefaultRetries}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	schema, err := jsonschema.For[T]()
+	if err != nil {
+		return nil, err
+	}
+	request := *params
+	request.Stream = nil
+	request.ResponseFormat = &ResponseFormat{
+		Type: ResponseFormatTypeJSONSchema,
+		JSONSchema: &JSONSchemaFormat{
+			Name:   structured.SchemaName[T](),
+			Schema: schema,
+		},
+	}
+
+	var input []InputItem
+	for attempt := 1; ; attempt++ {
+		response, err := service.Create(ctx, &request, options.requestOptions...)
+		if err != nil {
+			return nil, err
+		}
+
+		text := response.OutputText()
+		value, err := structured.Decode[T](text, schema)
+		if err == nil {
+			return &StructuredResult[T]{Value: value, Response: response, Attempts: attempt}, nil
+		}
+		if attempt > options.retries {
+			return nil, &api.StructuredOutputError{Attempts: attempt, Content: text, Err: err}
+		}
+
+		if input == nil {
+			input = inputItems(params.Input)
+		}
+		input = append(input,
+			NewInputItemFromMessage(InputMessage{
+				Content: InputMessageContent{Text: types.String(text)},
+				Role:    InputMessageRoleAssistant,
+				Type:    InputMessageTypeMessage,
+			}),
+			NewInputItemFromMessage(InputMessage{
+				Content: InputMessageContent{Text: types.String(structured.Feedback(err))},
+				Role:    InputMessageRoleUser,
+				Type:    InputMessageTypeMessage,
+			}),
+		)
+		request.Input = Input{Items: input}
+	}
+}
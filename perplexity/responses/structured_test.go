@@ -0,0 +1,84 @@
+package responses
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ZaguanLabs/perplexity-go/perplexity/api"
+	"github.com/ZaguanLabs/perplexity-go/perplexity/types"
+)
+
+type forecast struct {
+	City string `json:"city"`
+	High int    `json:"high"`
+}
+
+func textOutput(text string) string {
+	return `[{"type":"message","id":"msg_1","role":"assistant","status":"completed","content":[{"type":"output_text","text":` + text + `}]}]`
+}
+
+func TestCreateStructured(t *testing.T) {
+	service, requests := runnerServer(t,
+		textOutput(`"`+"```json\\n"+`{\"city\":\"Paris\"}\n`+"```"+`"`),
+		textOutput(`"<think>Add the high.</think>{\"city\":\"Paris\",\"high\":21}"`),
+	)
+
+	params := &CreateParams{Model: types.String("sonar-pro"), Input: Input{Items: inputItems(Input{Text: types.String("Forecast for Paris?")})}}
+	result, err := CreateStructured[forecast](context.Background(), service, params)
+	if err != nil {
+		t.Fatalf("CreateStructured failed: %v", err)
+	}
+	if result.Value != (forecast{City: "Paris", High: 21}) || result.Attempts != 2 || result.Response == nil {
+		t.Errorf("result = %+v", result)
+	}
+	if params.ResponseFormat != nil || len(params.Input.Items) != 1 {
+		t.Error("params were modified")
+	}
+
+	if len(*requests) != 2 {
+		t.Fatalf("requests = %d, want 2", len(*requests))
+	}
+	format := (*requests)[0].ResponseFormat
+	if format == nil || format.Type != ResponseFormatTypeJSONSchema || format.JSONSchema.Name != "forecast" || format.JSONSchema.Schema["type"] != "object" {
+		t.Errorf("response_format = %+v", format)
+	}
+	input := (*requests)[1].Input
+	if len(input) != 3 || input[0]["content"] != "Forecast for Paris?" || input[1]["role"] != "assistant" || input[2]["role"] != "user" {
+		t.Fatalf("retry input = %v", input)
+	}
+	if feedback, _ := input[2]["content"].(string); !strings.Contains(feedback, `missing required property "high"`) {
+		t.Errorf("feedback = %q", feedback)
+	}
+}
+
+func TestCreateStructured_RetriesExhausted(t *testing.T) {
+	service, requests := runnerServer(t, textOutput(`"no JSON here"`))
+
+	params := &CreateParams{Input: Input{Items: inputItems(Input{Text: types.String("Forecast for Paris?")})}}
+	_, err := CreateStructured[forecast](context.Background(), service, params, WithStructuredRetries(0))
+	var structuredErr *api.StructuredOutputError
+	if !errors.As(err, &structuredErr) {
+		t.Fatalf("error = %v, want StructuredOutputError", err)
+	}
+	if structuredErr.Attempts != 1 || structuredErr.Content != "no JSON here" || len(*requests) != 1 {
+		t.Errorf("error = %+v after %d requests", structuredErr, len(*requests))
+	}
+}
+
+func TestJSONSchemaFormat_Validate(t *testing.T) {
+	format := JSONSchemaFormat{
+		Name: "forecast",
+		Schema: map[string]any{
+			"type":  "array",
+			"items": map[string]any{"type": "integer", "minimum": 0},
+		},
+	}
+	if err := format.Validate([]byte(`[1, 2]`)); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+	if err := format.Validate([]byte(`[1, -2]`)); err == nil || err.Error() != "$[1]: value -2 is less than the minimum 0" {
+		t.Errorf("error = %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package responses
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 )
@@ -646,6 +647,22 @@ type ReasoningStoppedEvent struct {
 	Thought        *string   `json:"thought,omitempty"`
 }
 
+// UnknownEvent is a stream event of a type this package does not know. Raw
+// holds the complete event.
+type UnknownEvent struct {
+	SequenceNumber int             `json:"sequence_number"`
+	Type           EventType       `json:"type"`
+	Raw            json.RawMessage `json:"-"`
+}
+
+func (e UnknownEvent) MarshalJSON() ([]byte, error) {
+	if len(e.Raw) > 0 {
+		return e.Raw, nil
+	}
+	type event UnknownEvent
+	return json.Marshal(event(e))
+}
+
 type StreamEvent struct {
 	value any
 }
@@ -671,6 +688,15 @@ func (e *StreamEvent) UnmarshalJSON(data []byte) error {
 		string(EventTypeReasoningFetchURLResults): func() any { return &FetchURLResultsEvent{} },
 		string(EventTypeReasoningStopped):         func() any { return &ReasoningStoppedEvent{} },
 	})
+	var unknown *unknownTypeError
+	if errors.As(err, &unknown) {
+		event := UnknownEvent{Raw: append(json.RawMessage(nil), data...)}
+		if err := json.Unmarshal(data, &event); err != nil {
+			return err
+		}
+		e.value = event
+		return nil
+	}
 	if err != nil {
 		return err
 	}
@@ -678,6 +704,44 @@ func (e *StreamEvent) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// SequenceNumber returns the sequence number of the event.
+func (e StreamEvent) SequenceNumber() int {
+	switch v := e.value.(type) {
+	case ResponseCreatedEvent:
+		return v.SequenceNumber
+	case ResponseInProgressEvent:
+		return v.SequenceNumber
+	case ResponseCompletedEvent:
+		return v.SequenceNumber
+	case ResponseFailedEvent:
+		return v.SequenceNumber
+	case OutputItemAddedEvent:
+		return v.SequenceNumber
+	case OutputItemDoneEvent:
+		return v.SequenceNumber
+	case TextDeltaEvent:
+		return v.SequenceNumber
+	case TextDoneEvent:
+		return v.SequenceNumber
+	case ReasoningStartedEvent:
+		return v.SequenceNumber
+	case SearchQueriesEvent:
+		return v.SequenceNumber
+	case SearchResultsEvent:
+		return v.SequenceNumber
+	case FetchURLQueriesEvent:
+		return v.SequenceNumber
+	case FetchURLResultsEvent:
+		return v.SequenceNumber
+	case ReasoningStoppedEvent:
+		return v.SequenceNumber
+	case UnknownEvent:
+		return v.SequenceNumber
+	default:
+		return 0
+	}
+}
+
 func (e StreamEvent) AsResponseCreated() (*ResponseCreatedEvent, bool) {
 	v, ok := e.value.(ResponseCreatedEvent)
 	if ok {
@@ -790,6 +854,14 @@ func (e StreamEvent) AsReasoningStopped() (*ReasoningStoppedEvent, bool) {
 	return nil, false
 }
 
+func (e StreamEvent) AsUnknown() (*UnknownEvent, bool) {
+	v, ok := e.value.(UnknownEvent)
+	if ok {
+		return &v, true
+	}
+	return nil, false
+}
+
 func marshalUnionValue(value any) ([]byte, error) {
 	if value == nil {
 		return []byte("null"), nil
@@ -806,7 +878,7 @@ func unmarshalByTypeField(data []byte, mapping map[string]func() any) (any, erro
 	}
 	factory := mapping[envelope.Type]
 	if factory == nil {
-		return nil, fmt.Errorf("unknown discriminator type %q", envelope.Type)
+		return nil, &unknownTypeError{typ: envelope.Type}
 	}
 	variant := factory()
 	if err := json.Unmarshal(data, variant); err != nil {
@@ -815,6 +887,14 @@ func unmarshalByTypeField(data []byte, mapping map[string]func() any) (any, erro
 	return variant, nil
 }
 
+type unknownTypeError struct {
+	typ string
+}
+
+func (e *unknownTypeError) Error() string {
+	return fmt.Sprintf("unknown discriminator type %q", e.typ)
+}
+
 func dereferenceVariant(value any) any {
 	switch v := value.(type) {
 	case *InputMessage:
@@ -48,10 +48,11 @@ func (s *Service) Create(ctx context.Context, params *SearchParams, opts ...api.
 	}
 
 	req := &http.Request{
-		Method:  "POST",
-		Path:    "/search",
-		Body:    params,
-		Options: api.ApplyRequestOptions(opts),
+		Operation: "search.create",
+		Method:    "POST",
+		Path:      "/search",
+		Body:      params,
+		Options:   api.ApplyRequestOptions(opts),
 	}
 
 	resp, err := s.client.Do(ctx, req)
@@ -104,10 +105,11 @@ func (s *Service) createWithResponse(ctx context.Context, params *SearchParams,
 		}
 	}
 	req := &http.Request{
-		Method:  "POST",
-		Path:    "/search",
-		Body:    params,
-		Options: api.ApplyRequestOptions(opts),
+		Operation: "search.create",
+		Method:    "POST",
+		Path:      "/search",
+		Body:      params,
+		Options:   api.ApplyRequestOptions(opts),
 	}
 	resp, err := s.client.Do(ctx, req)
 	if err != nil {
@@ -25,6 +25,14 @@
 //		},
 //	}
 //
+// # Reasoning
+//
+// SplitThink separates the <think> blocks of reasoning models from the
+// answer, and ThinkSplitter does the same for content that arrives in
+// stream deltas:
+//
+//	reasoning, answer := result.Choices[0].Message.SplitThink()
+//
 // # Helper Functions
 //
 // The package provides helper functions for creating pointers to primitive types:
@@ -3,6 +3,7 @@ package types
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 // Role represents a chat message role.
@@ -60,6 +61,24 @@ type StructuredContent []ContentChunk
 
 func (StructuredContent) isMessageContent() {}
 
+// ContentText returns the text of message content, joining the text chunks
+// of structured content. Other chunks are skipped.
+func ContentText(content MessageContent) string {
+	switch content := content.(type) {
+	case TextContent:
+		return string(content)
+	case StructuredContent:
+		var b strings.Builder
+		for _, chunk := range content {
+			if text, ok := chunk.(TextChunk); ok {
+				b.WriteString(text.Text)
+			}
+		}
+		return b.String()
+	}
+	return ""
+}
+
 // ContentChunk represents a single chunk of structured content.
 type ContentChunk interface {
 	isContentChunk()
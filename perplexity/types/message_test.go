@@ -263,3 +263,20 @@ func TestPointerHelpers(t *testing.T) {
 		}
 	})
 }
+
+func TestContentText(t *testing.T) {
+	if got := ContentText(TextContent("plain")); got != "plain" {
+		t.Errorf("ContentText(TextContent) = %q", got)
+	}
+	structured := StructuredContent{
+		TextChunk{Type: "text", Text: "Hello, "},
+		ImageChunk{Type: "image_url"},
+		TextChunk{Type: "text", Text: "world"},
+	}
+	if got := ContentText(structured); got != "Hello, world" {
+		t.Errorf("ContentText(StructuredContent) = %q, want Hello, world", got)
+	}
+	if got := ContentText(nil); got != "" {
+		t.Errorf("ContentText(nil) = %q", got)
+	}
+}
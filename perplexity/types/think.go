@@ -0,0 +1,110 @@
+package types
+
+import "strings"
+
+const (
+	thinkOpen  = "<think>"
+	thinkClose = "</think>"
+)
+
+// SplitThink separates the <think> blocks of reasoning models from the
+// answer in content. It returns the text of the blocks and the text outside
+// them. Whitespace at the start of a block and after a think block that
+// leads the answer is dropped, and a block that is not closed extends to the
+// end of content.
+func SplitThink(content string) (reasoning, answer string) {
+	var splitter ThinkSplitter
+	reasoning, answer = splitter.Write(content)
+	restReasoning, restAnswer := splitter.Flush()
+	return reasoning + restReasoning, answer + restAnswer
+}
+
+// SplitThink separates the reasoning and the answer in the text of the
+// message content. See SplitThink.
+func (m ChatMessage) SplitThink() (reasoning, answer string) {
+	return SplitThink(ContentText(m.Content))
+}
+
+// ThinkSplitter separates <think> blocks from the answer in content that
+// arrives in deltas, such as the chunks of a stream, where a tag may be
+// split across deltas. The zero value is ready to use.
+type ThinkSplitter struct {
+	inThink   bool
+	skipSpace bool
+	answered  bool
+	pending   string
+}
+
+// Write returns the reasoning and answer text of delta. Text that may be the
+// start of a tag is held back until the next delta or Flush.
+func (s *ThinkSplitter) Write(delta string) (reasoning, answer string) {
+	var reasoningText, answerText strings.Builder
+	emit := func(text string) {
+		if s.inThink {
+			reasoningText.WriteString(text)
+		} else {
+			answerText.WriteString(text)
+			s.answered = s.answered || text != ""
+		}
+	}
+
+	text := s.pending + delta
+	s.pending = ""
+	for text != "" {
+		if s.skipSpace {
+			text = strings.TrimLeft(text, " \t\r\n")
+			if text == "" {
+				break
+			}
+			s.skipSpace = false
+		}
+
+		tag := thinkOpen
+		if s.inThink {
+			tag = thinkClose
+		}
+		if i := strings.Index(text, tag); i >= 0 {
+			emit(text[:i])
+			text = text[i+len(tag):]
+			s.inThink = !s.inThink
+			// Keep the whitespace that separates the answer around a block
+			// in the middle of it.
+			s.skipSpace = s.inThink || !s.answered
+			continue
+		}
+
+		held := partialTag(text, tag)
+		emit(text[:len(text)-held])
+		s.pending = text[len(text)-held:]
+		break
+	}
+	return reasoningText.String(), answerText.String()
+}
+
+// Flush returns the text held back by Write, once no more deltas will
+// arrive.
+func (s *ThinkSplitter) Flush() (reasoning, answer string) {
+	pending := s.pending
+	s.pending = ""
+	if s.inThink {
+		return pending, ""
+	}
+	return "", pending
+}
+
+// InThink reports whether the text written so far ends inside a <think>
+// block.
+func (s *ThinkSplitter) InThink() bool {
+	return s.inThink
+}
+
+// partialTag returns the length of the longest suffix of text that is a
+// proper prefix of tag.
+func partialTag(text, tag string) int {
+	for n := min(len(tag)-1, len(text)); n > 0; n-- {
+		if strings.HasSuffix(text, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
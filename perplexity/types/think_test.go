@@ -0,0 +1,69 @@
+package types
+
+import "testing"
+
+func TestSplitThink(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		reasoning string
+		answer    string
+	}{
+		{"no think", "Paris.", "", "Paris."},
+		{"think", "<think>\nThe capital.\n</think>\n\nParis.", "The capital.\n", "Paris."},
+		{"two blocks", "<think>a</think>Paris<think>b</think> is the capital.", "ab", "Paris is the capital."},
+		{"middle block", "Paris<think>\nhmm\n</think>\nis the capital.", "hmm\n", "Paris\nis the capital."},
+		{"unclosed", "<think>Still thinking", "Still thinking", ""},
+		{"lone close", "Paris.</think>", "", "Paris.</think>"},
+		{"partial tag", "Paris <thi", "", "Paris <thi"},
+		{"empty", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reasoning, answer := SplitThink(tt.content)
+			if reasoning != tt.reasoning || answer != tt.answer {
+				t.Errorf("SplitThink(%q) = %q, %q, want %q, %q", tt.content, reasoning, answer, tt.reasoning, tt.answer)
+			}
+		})
+	}
+
+	message := ChatMessage{Content: StructuredContent{TextChunk{Type: "text", Text: "<think>Hmm</think>"}, TextChunk{Type: "text", Text: "Rome."}}}
+	if reasoning, answer := message.SplitThink(); reasoning != "Hmm" || answer != "Rome." {
+		t.Errorf("ChatMessage.SplitThink() = %q, %q", reasoning, answer)
+	}
+}
+
+func TestThinkSplitter(t *testing.T) {
+	content := "<think>\nThe user asks 1 < 2.</think>\n\nYes, 1 < 2 <t."
+	// Every split of content into two deltas gives the result of SplitThink.
+	for _, content := range []string{content, "<think>a</think>Paris<think>b</think> is the capital."} {
+		wantReasoning, wantAnswer := SplitThink(content)
+		for i := 0; i <= len(content); i++ {
+			var splitter ThinkSplitter
+			var reasoning, answer string
+			for _, delta := range []string{content[:i], content[i:]} {
+				r, a := splitter.Write(delta)
+				reasoning += r
+				answer += a
+			}
+			r, a := splitter.Flush()
+			reasoning += r
+			answer += a
+			if reasoning != wantReasoning || answer != wantAnswer {
+				t.Fatalf("split of %q at %d = %q, %q, want %q, %q", content, i, reasoning, answer, wantReasoning, wantAnswer)
+			}
+		}
+	}
+	wantReasoning, wantAnswer := SplitThink(content)
+	if wantReasoning != "The user asks 1 < 2." || wantAnswer != "Yes, 1 < 2 <t." {
+		t.Errorf("SplitThink = %q, %q", wantReasoning, wantAnswer)
+	}
+
+	var splitter ThinkSplitter
+	if reasoning, answer := splitter.Write("<thi"); reasoning != "" || answer != "" || splitter.InThink() {
+		t.Errorf("partial tag written as %q, %q", reasoning, answer)
+	}
+	if reasoning, _ := splitter.Write("nk>Hmm"); reasoning != "Hmm" || !splitter.InThink() {
+		t.Errorf("reasoning = %q, in think = %v", reasoning, splitter.InThink())
+	}
+}
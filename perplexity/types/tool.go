@@ -8,6 +8,10 @@ type ToolCall struct {
 	// Function contains the function call details (optional).
 	Function *ToolCallFunction `json:"function,omitempty"`
 
+	// Index is the position of the tool call in the message. It is set on
+	// streamed tool call deltas, which carry a fragment of the call (optional).
+	Index *int `json:"index,omitempty"`
+
 	// Type is the type of tool call (optional).
 	Type *ToolCallType `json:"type,omitempty"`
 }